@@ -0,0 +1,85 @@
+package adminauth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// minTokenLength is the shortest admin token Init accepts
+const minTokenLength = 16
+
+// credential is one admin and their API token
+type credential struct {
+	name  string
+	token []byte
+}
+
+var (
+	mu          sync.RWMutex
+	credentials []credential
+)
+
+// Init loads admin API tokens from a comma-separated list of name:token pairs, as set in
+// ADMIN_API_TOKENS. The name identifies the admin in audit records. An empty list leaves the
+// authenticated admin endpoints closed to everyone.
+func Init(spec string) error {
+	var loaded []credential
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, token, ok := strings.Cut(entry, ":")
+		name, token = strings.TrimSpace(name), strings.TrimSpace(token)
+		if !ok || name == "" {
+			return fmt.Errorf("admin token entries must be name:token pairs")
+		}
+		if len(token) < minTokenLength {
+			return fmt.Errorf("admin token for %q must be at least %d characters", name, minTokenLength)
+		}
+		if seen[name] {
+			return fmt.Errorf("admin %q is listed more than once", name)
+		}
+		seen[name] = true
+		loaded = append(loaded, credential{name: name, token: []byte(token)})
+	}
+
+	if len(loaded) == 0 {
+		log.Println("ADMIN_API_TOKENS not set. Authenticated admin endpoints are disabled.")
+	} else {
+		log.Printf("Loaded %d admin API token(s)", len(loaded))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	credentials = loaded
+	return nil
+}
+
+// Authenticate returns the name of the admin whose token is in the request's
+// "Authorization: Bearer" header
+func Authenticate(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	presented := []byte(strings.TrimSpace(token))
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	// Compare against every token so the time taken does not reveal which one nearly matched
+	name := ""
+	for _, c := range credentials {
+		if subtle.ConstantTimeCompare(presented, c.token) == 1 {
+			name = c.name
+		}
+	}
+	return name, name != ""
+}
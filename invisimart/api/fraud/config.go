@@ -0,0 +1,222 @@
+package fraud
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"invisimart-api/money"
+)
+
+// Config is the fraud rules file. Each rule that fires adds its weight to the order's score,
+// and a rule with no weight is disabled. Amounts are decimal strings and windows are Go
+// durations such as "1h".
+type Config struct {
+	// ReviewThreshold is the score at which an order is held for review; zero never holds one
+	ReviewThreshold int   `json:"reviewThreshold"`
+	Rules           Rules `json:"rules"`
+}
+
+// Rules holds the settings of every rule, keyed by rule name
+type Rules struct {
+	EmailVelocity   VelocityRule        `json:"emailVelocity"`
+	PhoneVelocity   VelocityRule        `json:"phoneVelocity"`
+	IPVelocity      VelocityRule        `json:"ipVelocity"`
+	Amount          AmountRule          `json:"amount"`
+	CountryMismatch CountryMismatchRule `json:"countryMismatch"`
+	DistinctCards   DistinctCardsRule   `json:"distinctCards"`
+}
+
+// VelocityRule fires when more than MaxOrders orders, counting the new one, share an email
+// address, phone number or client IP within Window
+type VelocityRule struct {
+	Weight    int    `json:"weight"`
+	Window    string `json:"window"`
+	MaxOrders int    `json:"maxOrders"`
+
+	window time.Duration
+}
+
+// AmountRule scores large orders. Only the highest tier the total exceeds applies.
+type AmountRule struct {
+	Tiers []AmountTier `json:"tiers"`
+}
+
+// AmountTier adds Weight to orders whose total is over the Over amount
+type AmountTier struct {
+	Over   string `json:"over"`
+	Weight int    `json:"weight"`
+
+	over money.Money
+}
+
+// CountryMismatchRule fires when the billing address is in a different country from the one
+// the card was issued in, as reported by the payment processor, or from the one the client IP
+// is in. IPCountries maps networks in CIDR notation, such as "81.2.69.0/24", to ISO 3166
+// country codes; the most specific network containing the IP wins. A country that cannot be
+// told is not compared.
+type CountryMismatchRule struct {
+	Weight      int               `json:"weight"`
+	IPCountries map[string]string `json:"ipCountries"`
+
+	networks []ipNetwork
+}
+
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// ipNetwork is a parsed IPCountries entry
+type ipNetwork struct {
+	prefix  netip.Prefix
+	country string
+}
+
+// DistinctCardsRule fires when more than MaxCards different cards, counting the new order's,
+// are used with one email address within Window
+type DistinctCardsRule struct {
+	Weight   int    `json:"weight"`
+	Window   string `json:"window"`
+	MaxCards int    `json:"maxCards"`
+
+	window time.Duration
+}
+
+// DefaultConfig holds for review a burst of orders from one customer, orders from many cards,
+// and very large orders
+func DefaultConfig() *Config {
+	config := &Config{
+		ReviewThreshold: 50,
+		Rules: Rules{
+			EmailVelocity: VelocityRule{Weight: 30, Window: "1h", MaxOrders: 5},
+			PhoneVelocity: VelocityRule{Weight: 30, Window: "1h", MaxOrders: 5},
+			IPVelocity:    VelocityRule{Weight: 20, Window: "1h", MaxOrders: 10},
+			Amount: AmountRule{Tiers: []AmountTier{
+				{Over: "1000.00", Weight: 20},
+				{Over: "5000.00", Weight: 50},
+			}},
+			CountryMismatch: CountryMismatchRule{Weight: 20},
+			DistinctCards:   DistinctCardsRule{Weight: 40, Window: "24h", MaxCards: 3},
+		},
+	}
+	if err := config.compile(); err != nil {
+		panic(fmt.Sprintf("invalid default fraud config: %v", err))
+	}
+	return config
+}
+
+// LoadConfig reads and validates a fraud rules file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read fraud config: %w", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse fraud config: %w", err)
+	}
+
+	if err := config.compile(); err != nil {
+		return nil, fmt.Errorf("invalid fraud config: %w", err)
+	}
+	return &config, nil
+}
+
+// compile parses the windows and amounts in the config and checks the limits
+func (c *Config) compile() error {
+	if c.ReviewThreshold < 0 {
+		return fmt.Errorf("reviewThreshold must not be negative")
+	}
+
+	velocity := []struct {
+		name string
+		rule *VelocityRule
+	}{
+		{RuleEmailVelocity, &c.Rules.EmailVelocity},
+		{RulePhoneVelocity, &c.Rules.PhoneVelocity},
+		{RuleIPVelocity, &c.Rules.IPVelocity},
+	}
+	for _, v := range velocity {
+		if v.rule.Weight == 0 {
+			continue
+		}
+		window, err := parseWindow(v.rule.Window)
+		if err != nil {
+			return fmt.Errorf("%s: %w", v.name, err)
+		}
+		if v.rule.MaxOrders <= 0 {
+			return fmt.Errorf("%s: maxOrders must be positive", v.name)
+		}
+		v.rule.window = window
+	}
+
+	for i := range c.Rules.Amount.Tiers {
+		tier := &c.Rules.Amount.Tiers[i]
+		over, err := money.Parse(tier.Over, money.DefaultCurrency)
+		if err != nil {
+			return fmt.Errorf("%s tier %d: %w", RuleAmount, i+1, err)
+		}
+		tier.over = over
+	}
+
+	mismatch := &c.Rules.CountryMismatch
+	mismatch.networks = nil
+	for network, country := range mismatch.IPCountries {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(network))
+		if err != nil {
+			return fmt.Errorf("%s: invalid network %q", RuleCountryMismatch, network)
+		}
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if !countryCodePattern.MatchString(country) {
+			return fmt.Errorf("%s: invalid country %q for %s", RuleCountryMismatch, country, network)
+		}
+		mismatch.networks = append(mismatch.networks, ipNetwork{prefix: prefix.Masked(), country: country})
+	}
+
+	if cards := &c.Rules.DistinctCards; cards.Weight != 0 {
+		window, err := parseWindow(cards.Window)
+		if err != nil {
+			return fmt.Errorf("%s: %w", RuleDistinctCards, err)
+		}
+		if cards.MaxCards <= 0 {
+			return fmt.Errorf("%s: maxCards must be positive", RuleDistinctCards)
+		}
+		cards.window = window
+	}
+	return nil
+}
+
+func parseWindow(value string) (time.Duration, error) {
+	window, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid window %q", value)
+	}
+	if window <= 0 {
+		return 0, fmt.Errorf("window must be positive, got %q", value)
+	}
+	return window, nil
+}
+
+// ipCountry returns the country of the most specific network containing ip, or "" when none
+// does or ip is not an address
+func (r *CountryMismatchRule) ipCountry(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap().WithZone("")
+
+	var best *ipNetwork
+	for i, network := range r.networks {
+		if network.prefix.Contains(addr) && (best == nil || network.prefix.Bits() > best.prefix.Bits()) {
+			best = &r.networks[i]
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.country
+}
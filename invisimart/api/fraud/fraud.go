@@ -0,0 +1,246 @@
+package fraud
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"invisimart-api/money"
+	"invisimart-api/pricing"
+)
+
+// Rule names, as used in the config file and in recorded signals
+const (
+	RuleEmailVelocity   = "emailVelocity"
+	RulePhoneVelocity   = "phoneVelocity"
+	RuleIPVelocity      = "ipVelocity"
+	RuleAmount          = "amount"
+	RuleCountryMismatch = "countryMismatch"
+	RuleDistinctCards   = "distinctCards"
+)
+
+// Identifiers that past orders are counted by
+const (
+	KeyEmail = "email"
+	KeyPhone = "phone"
+	KeyIP    = "ip"
+)
+
+// minSecretLength is the shortest hashing secret Init accepts
+const minSecretLength = 32
+
+// Order is what the rules see of an order being placed. The phone number and card are only
+// seen as hashes from Hash. CardCountry is the ISO 3166 code of the country the card was
+// issued in, as reported by the payment processor, or "" when it is not known.
+type Order struct {
+	Email           string
+	PhoneHash       string
+	CardFingerprint string
+	CardCountry     string
+	ClientIP        string
+	Total           money.Money
+	BillingAddress  string
+}
+
+// History answers questions about orders placed before the one being screened
+type History interface {
+	// CountOrders returns how many orders placed within window have the given email address,
+	// phone hash or client IP, depending on key
+	CountOrders(key, value string, window time.Duration) (int, error)
+	// CountCards returns how many different cards were used with an email address within
+	// window, including fingerprint
+	CountCards(email, fingerprint string, window time.Duration) (int, error)
+}
+
+// Signal is a rule that fired for an order
+type Signal struct {
+	Rule   string `json:"rule"`
+	Weight int    `json:"weight"`
+	Detail string `json:"detail"`
+}
+
+// Assessment is the outcome of screening an order
+type Assessment struct {
+	Score     int      `json:"score"`
+	Threshold int      `json:"threshold"`
+	Signals   []Signal `json:"signals"`
+}
+
+// Review reports whether the order scored high enough to be held for review
+func (a Assessment) Review() bool {
+	return a.Threshold > 0 && a.Score >= a.Threshold
+}
+
+var (
+	mu         sync.Mutex
+	configPath string
+	modTime    time.Time
+	current    = DefaultConfig()
+	secret     []byte
+)
+
+// Init loads fraud rules from path, or uses the built-in defaults when path is empty. Like
+// the pricing rules, the file is re-read whenever it changes. hashSecret keys the hashes of
+// phone and card numbers; without one a random key is generated, so orders placed before a
+// restart no longer count towards the phone and card rules.
+func Init(path, hashSecret string) error {
+	var key []byte
+	switch {
+	case hashSecret == "":
+		key = make([]byte, minSecretLength)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("failed to generate fraud hash secret: %w", err)
+		}
+		log.Println("FRAUD_HASH_SECRET not set. Phone and card history will not survive a restart.")
+	case len(hashSecret) < minSecretLength:
+		return fmt.Errorf("fraud hash secret must be at least %d characters", minSecretLength)
+	default:
+		key = []byte(hashSecret)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	secret = key
+	configPath = path
+	if path == "" {
+		current = DefaultConfig()
+		return nil
+	}
+	return reloadLocked()
+}
+
+// config returns the current rules, reloading them first if the file has changed. A file
+// that fails to load leaves the previous rules in place.
+func config() *Config {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if configPath != "" {
+		if info, err := os.Stat(configPath); err == nil && !info.ModTime().Equal(modTime) {
+			if err := reloadLocked(); err != nil {
+				log.Printf("Failed to reload fraud config, keeping previous rules: %v", err)
+			}
+		}
+	}
+	return current
+}
+
+func reloadLocked() error {
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return err
+	}
+	loaded, err := LoadConfig(configPath)
+	if err != nil {
+		modTime = info.ModTime()
+		return err
+	}
+	current = loaded
+	modTime = info.ModTime()
+	log.Printf("Loaded fraud config from %s", configPath)
+	return nil
+}
+
+// Hash returns a keyed hash of a phone or card number, so past orders can be matched without
+// storing the number itself. kind keeps hashes of different kinds of value apart.
+func Hash(kind, value string) string {
+	if value == "" {
+		return ""
+	}
+
+	mu.Lock()
+	mac := hmac.New(sha256.New, secret)
+	mu.Unlock()
+
+	mac.Write([]byte(kind + ":" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Evaluate screens an order against the current rules
+func Evaluate(order Order, history History) (Assessment, error) {
+	return config().Evaluate(order, history)
+}
+
+// Evaluate screens an order against these rules, adding the weight of every rule that fires
+// to its score
+func (c *Config) Evaluate(order Order, history History) (Assessment, error) {
+	assessment := Assessment{Threshold: c.ReviewThreshold, Signals: []Signal{}}
+	fire := func(rule string, weight int, format string, args ...interface{}) {
+		assessment.Score += weight
+		assessment.Signals = append(assessment.Signals, Signal{Rule: rule, Weight: weight, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	velocity := []struct {
+		name  string
+		rule  VelocityRule
+		key   string
+		value string
+		what  string
+	}{
+		{RuleEmailVelocity, c.Rules.EmailVelocity, KeyEmail, order.Email, "this email address"},
+		{RulePhoneVelocity, c.Rules.PhoneVelocity, KeyPhone, order.PhoneHash, "this phone number"},
+		{RuleIPVelocity, c.Rules.IPVelocity, KeyIP, order.ClientIP, "this IP address"},
+	}
+	for _, v := range velocity {
+		if v.rule.Weight == 0 || v.value == "" {
+			continue
+		}
+		previous, err := history.CountOrders(v.key, v.value, v.rule.window)
+		if err != nil {
+			return Assessment{}, fmt.Errorf("%s: %w", v.name, err)
+		}
+		if orders := previous + 1; orders > v.rule.MaxOrders {
+			fire(v.name, v.rule.Weight, "%d orders from %s within %s (limit %d)", orders, v.what, v.rule.Window, v.rule.MaxOrders)
+		}
+	}
+
+	// Tiers are not sorted, so find the highest one the total is over
+	var tier *AmountTier
+	for i, t := range c.Rules.Amount.Tiers {
+		if t.Weight == 0 || t.over.Currency != order.Total.Currency || order.Total.Cmp(t.over) <= 0 {
+			continue
+		}
+		if tier == nil || t.over.Cmp(tier.over) > 0 {
+			tier = &c.Rules.Amount.Tiers[i]
+		}
+	}
+	if tier != nil {
+		fire(RuleAmount, tier.Weight, "Order total %s is over %s", order.Total, tier.over)
+	}
+
+	if rule := c.Rules.CountryMismatch; rule.Weight != 0 {
+		if billing := pricing.ParseAddress(order.BillingAddress).Country; billing != "" {
+			var mismatches []string
+			if card := strings.ToUpper(order.CardCountry); card != "" && card != billing {
+				mismatches = append(mismatches, "card issued in "+card)
+			}
+			if ip := rule.ipCountry(order.ClientIP); ip != "" && ip != billing {
+				mismatches = append(mismatches, "IP address in "+ip)
+			}
+			if len(mismatches) > 0 {
+				fire(RuleCountryMismatch, rule.Weight, "Billing country %s does not match %s", billing, strings.Join(mismatches, " and "))
+			}
+		}
+	}
+
+	if rule := c.Rules.DistinctCards; rule.Weight != 0 && order.Email != "" && order.CardFingerprint != "" {
+		cards, err := history.CountCards(order.Email, order.CardFingerprint, rule.window)
+		if err != nil {
+			return Assessment{}, fmt.Errorf("%s: %w", RuleDistinctCards, err)
+		}
+		if cards > rule.MaxCards {
+			fire(RuleDistinctCards, rule.Weight, "%d different cards used with this email address within %s (limit %d)",
+				cards, rule.Window, rule.MaxCards)
+		}
+	}
+
+	return assessment, nil
+}
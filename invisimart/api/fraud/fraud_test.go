@@ -0,0 +1,70 @@
+package fraud
+
+import "testing"
+
+func TestCountryMismatch(t *testing.T) {
+	config := &Config{ReviewThreshold: 50, Rules: Rules{
+		CountryMismatch: CountryMismatchRule{Weight: 20, IPCountries: map[string]string{
+			"81.2.0.0/16":   "gb",
+			"81.2.69.0/24":  "FR",
+			"2a02:c7f::/32": "GB",
+		}},
+	}}
+	if err := config.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		address string
+		card    string
+		ip      string
+		want    int
+	}{
+		{"everything in the US", "500 Broadway, Los Angeles, CA 90012", "US", "203.0.113.7", 0},
+		{"foreign card", "500 Broadway, Los Angeles, CA 90012", "GB", "", 20},
+		{"foreign IP", "500 Broadway, Los Angeles, CA 90012", "US", "81.2.1.1", 20},
+		{"foreign card and IP fire once", "500 Broadway, Los Angeles, CA 90012", "GB", "81.2.1.1", 20},
+		{"matching card and IP", "10 Downing St, London SW1A 2AA, GB", "gb", "81.2.1.1", 0},
+		{"most specific network wins", "10 Downing St, London SW1A 2AA, GB", "GB", "81.2.69.10", 20},
+		{"IPv6 network", "10 Downing St, London SW1A 2AA, GB", "", "2a02:c7f:1::1", 0},
+		{"Canadian address with a US card", "290 Bremner Blvd, Toronto, ON M5V 3L9", "US", "", 20},
+		{"unknown billing country is not compared", "10 Downing St, London", "US", "81.2.1.1", 0},
+		{"unknown card and IP country", "290 Bremner Blvd, Toronto, ON M5V 3L9", "", "198.51.100.1", 0},
+		{"unparseable IP", "500 Broadway, Los Angeles, CA 90012", "", "unknown", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := Order{BillingAddress: tt.address, CardCountry: tt.card, ClientIP: tt.ip}
+			assessment, err := config.Evaluate(order, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if assessment.Score != tt.want {
+				t.Errorf("scored %d, want %d: %+v", assessment.Score, tt.want, assessment.Signals)
+			}
+		})
+	}
+}
+
+func TestCountryMismatchConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		ipCountries map[string]string
+		wantErr     bool
+	}{
+		{"no networks", nil, false},
+		{"valid network", map[string]string{"81.2.69.0/24": "GB"}, false},
+		{"host bits set", map[string]string{"81.2.69.1/24": "GB"}, false},
+		{"bare address", map[string]string{"81.2.69.1": "GB"}, true},
+		{"bad country", map[string]string{"81.2.69.0/24": "GBR"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Rules: Rules{CountryMismatch: CountryMismatchRule{Weight: 20, IPCountries: tt.ipCountries}}}
+			if err := config.compile(); (err != nil) != tt.wantErr {
+				t.Errorf("compile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package fulfillment
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Config is the fulfillment file: the policy that ranks locations and what it needs to know
+// about them. Locations missing from Locations can still ship; they are simply not online
+// and have no position.
+type Config struct {
+	Policy    string                    `json:"policy"`
+	Locations map[string]LocationConfig `json:"locations"`
+	// Regions places each region parsed from billing addresses, such as "CA", for the
+	// nearestStore policy
+	Regions map[string]Coordinates `json:"regions"`
+
+	policy Policy
+}
+
+// LocationConfig describes one stock location
+type LocationConfig struct {
+	// Online marks a warehouse that serves online orders rather than a walk-in store
+	Online   bool         `json:"online"`
+	Position *Coordinates `json:"position,omitempty"`
+}
+
+// Coordinates is a point in decimal degrees
+type Coordinates struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// DefaultConfig ships from whichever locations hold the most stock, with main-store as the
+// online warehouse, as the inventory endpoint reports it
+func DefaultConfig() *Config {
+	config := &Config{
+		Policy: PolicyMostStock,
+		Locations: map[string]LocationConfig{
+			"main-store": {Online: true},
+		},
+	}
+	if err := config.compile(); err != nil {
+		panic(fmt.Sprintf("invalid default fulfillment config: %v", err))
+	}
+	return config
+}
+
+// LoadConfig reads and validates a fulfillment file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read fulfillment config: %w", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse fulfillment config: %w", err)
+	}
+
+	if err := config.compile(); err != nil {
+		return nil, fmt.Errorf("invalid fulfillment config: %w", err)
+	}
+	return &config, nil
+}
+
+// compile checks the positions and builds the policy
+func (c *Config) compile() error {
+	if c.Policy == "" {
+		c.Policy = PolicyMostStock
+	}
+
+	for name, location := range c.Locations {
+		if location.Position != nil {
+			if err := location.Position.check(); err != nil {
+				return fmt.Errorf("location %s: %w", name, err)
+			}
+		}
+	}
+
+	regions := make(map[string]Coordinates, len(c.Regions))
+	for region, position := range c.Regions {
+		if err := position.check(); err != nil {
+			return fmt.Errorf("region %s: %w", region, err)
+		}
+		regions[strings.ToUpper(strings.TrimSpace(region))] = position
+	}
+	c.Regions = regions
+
+	policy, err := newPolicy(c.Policy, c)
+	if err != nil {
+		return err
+	}
+	c.policy = policy
+	return nil
+}
+
+func (p Coordinates) check() error {
+	if p.Latitude < -90 || p.Latitude > 90 {
+		return fmt.Errorf("latitude must be between -90 and 90, got %g", p.Latitude)
+	}
+	if p.Longitude < -180 || p.Longitude > 180 {
+		return fmt.Errorf("longitude must be between -180 and 180, got %g", p.Longitude)
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+package fulfillment
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"invisimart-api/pricing"
+)
+
+// maxSearchLocations bounds the exhaustive search for the fewest shipments, which tries every
+// combination of locations. Beyond it locations are picked greedily.
+const maxSearchLocations = 16
+
+// Line is a product and the quantity of it ordered
+type Line struct {
+	ProductID string
+	Quantity  int
+}
+
+// Stock is the stock on hand, by location and then product ID
+type Stock map[string]map[string]int
+
+// Order is what a policy sees of the order being allocated
+type Order struct {
+	Lines []Line
+	Stock Stock
+	// Region is the region parsed from the billing address, such as "CA", or ""
+	Region string
+}
+
+// held returns how many units of the ordered products a location has
+func (o Order) held(location string) int {
+	units := 0
+	for _, line := range o.Lines {
+		units += o.Stock[location][line.ProductID]
+	}
+	return units
+}
+
+// Item is a quantity of one product in a shipment
+type Item struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+}
+
+// Shipment is everything sent from one location
+type Shipment struct {
+	Location string `json:"location"`
+	Items    []Item `json:"items"`
+}
+
+// Allocation is where each line of an order ships from, one shipment per location, most
+// preferred location first. Policy names the policy that ranked the locations.
+type Allocation struct {
+	Policy    string
+	Shipments []Shipment
+}
+
+// Shortage is a product the locations together do not hold enough of
+type Shortage struct {
+	ProductID string
+	Requested int
+	Available int
+}
+
+// ShortageError is returned when the order cannot be filled from all locations combined
+type ShortageError struct {
+	Items []Shortage
+}
+
+func (e *ShortageError) Error() string {
+	return fmt.Sprintf("Insufficient stock for %d item(s)", len(e.Items))
+}
+
+var (
+	mu         sync.Mutex
+	configPath string
+	modTime    time.Time
+	current    = DefaultConfig()
+)
+
+// Init loads the fulfillment config from path, or uses the built-in default when path is
+// empty. Like the pricing rules, the file is re-read whenever it changes.
+func Init(path string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	configPath = path
+	if path == "" {
+		current = DefaultConfig()
+		return nil
+	}
+	return reloadLocked()
+}
+
+// config returns the current config, reloading it first if the file has changed. A file that
+// fails to load leaves the previous config in place.
+func config() *Config {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if configPath != "" {
+		if info, err := os.Stat(configPath); err == nil && !info.ModTime().Equal(modTime) {
+			if err := reloadLocked(); err != nil {
+				log.Printf("Failed to reload fulfillment config, keeping previous config: %v", err)
+			}
+		}
+	}
+	return current
+}
+
+func reloadLocked() error {
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return err
+	}
+	loaded, err := LoadConfig(configPath)
+	if err != nil {
+		modTime = info.ModTime()
+		return err
+	}
+	current = loaded
+	modTime = info.ModTime()
+	log.Printf("Loaded fulfillment config from %s", configPath)
+	return nil
+}
+
+// Allocate chooses where to ship an order from using the current config
+func Allocate(lines []Line, stock Stock, billingAddress string) (Allocation, error) {
+	return config().Allocate(lines, stock, billingAddress)
+}
+
+// Allocate chooses the locations that fill every line with the fewest shipments, breaking
+// ties with the policy's ranking. A line is only split between locations when no location
+// in the allocation holds all of it.
+func (c *Config) Allocate(lines []Line, stock Stock, billingAddress string) (Allocation, error) {
+	order := Order{Stock: stock, Region: pricing.ParseRegion(billingAddress)}
+	demand := make(map[string]int, len(lines))
+	for _, line := range lines {
+		if _, ok := demand[line.ProductID]; !ok {
+			order.Lines = append(order.Lines, Line{ProductID: line.ProductID})
+		}
+		demand[line.ProductID] += line.Quantity
+	}
+	for i := range order.Lines {
+		order.Lines[i].Quantity = demand[order.Lines[i].ProductID]
+	}
+
+	var shortages []Shortage
+	for _, line := range order.Lines {
+		available := 0
+		for _, held := range stock {
+			available += held[line.ProductID]
+		}
+		if available < line.Quantity {
+			shortages = append(shortages, Shortage{ProductID: line.ProductID, Requested: line.Quantity, Available: available})
+		}
+	}
+	if len(shortages) > 0 {
+		return Allocation{}, &ShortageError{Items: shortages}
+	}
+
+	// Only locations holding something the order needs are worth a shipment
+	var candidates []string
+	for location := range stock {
+		if order.held(location) > 0 {
+			candidates = append(candidates, location)
+		}
+	}
+	sort.Strings(candidates)
+	ranked := c.rank(order, candidates)
+
+	chosen := fewestLocations(order, ranked)
+	return Allocation{Policy: c.Policy, Shipments: assign(order, chosen)}, nil
+}
+
+// rank asks the policy to order the candidates. Anything the policy leaves out or makes up
+// is dropped or appended, so a faulty policy can only affect preference, never correctness.
+func (c *Config) rank(order Order, candidates []string) []string {
+	isCandidate := make(map[string]bool, len(candidates))
+	for _, location := range candidates {
+		isCandidate[location] = true
+	}
+
+	ranked := make([]string, 0, len(candidates))
+	for _, location := range c.policy.Rank(order, candidates) {
+		if isCandidate[location] {
+			ranked = append(ranked, location)
+			delete(isCandidate, location)
+		}
+	}
+	for _, location := range candidates {
+		if isCandidate[location] {
+			ranked = append(ranked, location)
+		}
+	}
+	return ranked
+}
+
+// fewestLocations returns the smallest set of locations that together hold every line. Sets
+// of the same size are tried in the ranking's order, so the first that covers the order is
+// the one the policy prefers most. The result keeps the ranking's order.
+func fewestLocations(order Order, ranked []string) []string {
+	if len(ranked) > maxSearchLocations {
+		return greedyLocations(order, ranked)
+	}
+
+	for size := 1; size <= len(ranked); size++ {
+		indexes := make([]int, size)
+		for i := range indexes {
+			indexes[i] = i
+		}
+		for {
+			set := make([]string, size)
+			for i, index := range indexes {
+				set[i] = ranked[index]
+			}
+			if covers(order, set) {
+				return set
+			}
+
+			// Advance to the next combination in lexicographic order
+			i := size - 1
+			for i >= 0 && indexes[i] == len(ranked)-size+i {
+				i--
+			}
+			if i < 0 {
+				break
+			}
+			indexes[i]++
+			for j := i + 1; j < size; j++ {
+				indexes[j] = indexes[j-1] + 1
+			}
+		}
+	}
+	// Unreachable once the shortage check has passed: all locations together cover the order
+	return ranked
+}
+
+// greedyLocations repeatedly adds the location holding most of what is still needed, taking
+// the better-ranked one on a tie
+func greedyLocations(order Order, ranked []string) []string {
+	remaining := make(map[string]int, len(order.Lines))
+	for _, line := range order.Lines {
+		remaining[line.ProductID] = line.Quantity
+	}
+
+	var chosen []string
+	used := make(map[string]bool)
+	for len(remaining) > 0 {
+		best, bestUnits := "", 0
+		for _, location := range ranked {
+			if used[location] {
+				continue
+			}
+			units := 0
+			for productID, needed := range remaining {
+				units += min(needed, order.Stock[location][productID])
+			}
+			if units > bestUnits {
+				best, bestUnits = location, units
+			}
+		}
+		if best == "" {
+			break
+		}
+		used[best] = true
+		chosen = append(chosen, best)
+		for productID, needed := range remaining {
+			if needed -= min(needed, order.Stock[best][productID]); needed == 0 {
+				delete(remaining, productID)
+			} else {
+				remaining[productID] = needed
+			}
+		}
+	}
+
+	// Keep the ranking's order
+	return rankBy(chosen, func(a, b string) bool { return indexOf(ranked, a) < indexOf(ranked, b) })
+}
+
+// covers reports whether the locations together hold every line
+func covers(order Order, locations []string) bool {
+	for _, line := range order.Lines {
+		held := 0
+		for _, location := range locations {
+			held += order.Stock[location][line.ProductID]
+		}
+		if held < line.Quantity {
+			return false
+		}
+	}
+	return true
+}
+
+// assign fills each line from the chosen locations: from the best-ranked one that holds all
+// of it, or else from each in turn until it is filled
+func assign(order Order, locations []string) []Shipment {
+	taken := make(map[string]map[string]int, len(locations))
+	for _, location := range locations {
+		taken[location] = make(map[string]int)
+	}
+	available := func(location, productID string) int {
+		return order.Stock[location][productID] - taken[location][productID]
+	}
+
+	items := make(map[string][]Item, len(locations))
+	for _, line := range order.Lines {
+		sources := locations
+		for _, location := range locations {
+			if available(location, line.ProductID) >= line.Quantity {
+				sources = []string{location}
+				break
+			}
+		}
+
+		needed := line.Quantity
+		for _, location := range sources {
+			quantity := min(needed, available(location, line.ProductID))
+			if quantity <= 0 {
+				continue
+			}
+			taken[location][line.ProductID] += quantity
+			items[location] = append(items[location], Item{ProductID: line.ProductID, Quantity: quantity})
+			if needed -= quantity; needed == 0 {
+				break
+			}
+		}
+	}
+
+	shipments := make([]Shipment, 0, len(locations))
+	for _, location := range locations {
+		if len(items[location]) > 0 {
+			shipments = append(shipments, Shipment{Location: location, Items: items[location]})
+		}
+	}
+	return shipments
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,214 @@
+package fulfillment
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestFewestLocations(t *testing.T) {
+	tests := []struct {
+		name   string
+		lines  []Line
+		stock  Stock
+		ranked []string
+		want   []string
+	}{
+		{
+			name:   "one location holds everything",
+			lines:  []Line{{"a", 2}, {"b", 1}},
+			stock:  Stock{"x": {"a": 1, "b": 5}, "y": {"a": 2, "b": 1}},
+			ranked: []string{"x", "y"},
+			want:   []string{"y"},
+		},
+		{
+			name:   "the better-ranked of two complete locations",
+			lines:  []Line{{"a", 1}},
+			stock:  Stock{"x": {"a": 1}, "y": {"a": 9}},
+			ranked: []string{"x", "y"},
+			want:   []string{"x"},
+		},
+		{
+			name:   "two locations beat the top-ranked three",
+			lines:  []Line{{"a", 1}, {"b", 1}, {"c", 1}},
+			stock:  Stock{"x": {"a": 1}, "y": {"b": 1}, "z": {"c": 1}, "w": {"a": 1, "b": 1}},
+			ranked: []string{"x", "y", "z", "w"},
+			want:   []string{"z", "w"},
+		},
+		{
+			name:   "a line split between locations",
+			lines:  []Line{{"a", 5}},
+			stock:  Stock{"x": {"a": 2}, "y": {"a": 2}, "z": {"a": 3}},
+			ranked: []string{"x", "y", "z"},
+			want:   []string{"x", "z"},
+		},
+		{
+			name:   "the set keeps the ranking's order",
+			lines:  []Line{{"a", 1}, {"b", 1}},
+			stock:  Stock{"x": {"b": 1}, "y": {"a": 1}},
+			ranked: []string{"y", "x"},
+			want:   []string{"y", "x"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fewestLocations(Order{Lines: tt.lines, Stock: tt.stock}, tt.ranked)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fewestLocations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFewestLocationsGreedy(t *testing.T) {
+	// More locations than the exhaustive search tries: each holds one unit, except one that
+	// holds half the order
+	stock := Stock{"big": {"a": 10}}
+	var ranked []string
+	for i := 0; i < maxSearchLocations+4; i++ {
+		location := fmt.Sprintf("store-%02d", i)
+		stock[location] = map[string]int{"a": 1}
+		ranked = append(ranked, location)
+	}
+	ranked = append(ranked, "big")
+
+	got := fewestLocations(Order{Lines: []Line{{"a", 12}}, Stock: stock}, ranked)
+	want := []string{"store-00", "store-01", "big"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fewestLocations = %v, want %v", got, want)
+	}
+}
+
+func TestAssign(t *testing.T) {
+	tests := []struct {
+		name      string
+		lines     []Line
+		stock     Stock
+		locations []string
+		want      []Shipment
+	}{
+		{
+			name:      "each line from the first location that holds all of it",
+			lines:     []Line{{"a", 2}, {"b", 1}},
+			stock:     Stock{"x": {"a": 1, "b": 1}, "y": {"a": 2, "b": 1}},
+			locations: []string{"x", "y"},
+			want: []Shipment{
+				{Location: "x", Items: []Item{{"b", 1}}},
+				{Location: "y", Items: []Item{{"a", 2}}},
+			},
+		},
+		{
+			name:      "a line no location holds is split in ranking order",
+			lines:     []Line{{"a", 5}},
+			stock:     Stock{"x": {"a": 2}, "y": {"a": 4}},
+			locations: []string{"x", "y"},
+			want: []Shipment{
+				{Location: "x", Items: []Item{{"a", 2}}},
+				{Location: "y", Items: []Item{{"a", 3}}},
+			},
+		},
+		{
+			name:      "a location without anything to send gets no shipment",
+			lines:     []Line{{"a", 1}},
+			stock:     Stock{"x": {"a": 1}, "y": {"a": 1}},
+			locations: []string{"x", "y"},
+			want:      []Shipment{{Location: "x", Items: []Item{{"a", 1}}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := assign(Order{Lines: tt.lines, Stock: tt.stock}, tt.locations)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("assign = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	stock := Stock{
+		"main-store":   {"a": 3, "b": 1},
+		"east-store":   {"a": 10, "b": 10},
+		"west-store":   {"a": 10, "b": 10},
+		"empty-store":  {"c": 5},
+		"online-store": {"a": 1, "b": 1},
+	}
+	config := &Config{
+		Locations: map[string]LocationConfig{
+			"online-store": {Online: true},
+			"east-store":   {Position: &Coordinates{Latitude: 40.7, Longitude: -74.0}},
+			"west-store":   {Position: &Coordinates{Latitude: 37.8, Longitude: -122.4}},
+		},
+		Regions: map[string]Coordinates{"ca": {Latitude: 36.8, Longitude: -119.4}},
+	}
+	tests := []struct {
+		policy  string
+		lines   []Line
+		address string
+		want    []Shipment
+	}{
+		{
+			policy: PolicyMostStock,
+			lines:  []Line{{"a", 1}, {"b", 1}},
+			// east-store and west-store hold the same; names break the tie
+			want: []Shipment{{Location: "east-store", Items: []Item{{"a", 1}, {"b", 1}}}},
+		},
+		{
+			policy: PolicyPreferOnline,
+			lines:  []Line{{"a", 1}, {"b", 1}},
+			want:   []Shipment{{Location: "online-store", Items: []Item{{"a", 1}, {"b", 1}}}},
+		},
+		{
+			policy: PolicyPreferOnline,
+			// Repeated lines are added together. The warehouse cannot fill them, and one
+			// shipment beats two.
+			lines: []Line{{"a", 1}, {"a", 1}},
+			want:  []Shipment{{Location: "east-store", Items: []Item{{"a", 2}}}},
+		},
+		{
+			policy:  PolicyNearestStore,
+			lines:   []Line{{"a", 4}},
+			address: "500 Broadway, Los Angeles, CA 90012",
+			want:    []Shipment{{Location: "west-store", Items: []Item{{"a", 4}}}},
+		},
+		{
+			policy:  PolicyNearestStore,
+			lines:   []Line{{"a", 4}},
+			address: "10 Downing St, London",
+			want:    []Shipment{{Location: "east-store", Items: []Item{{"a", 4}}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			config.Policy = tt.policy
+			if err := config.compile(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := config.Allocate(tt.lines, stock, tt.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Policy != tt.policy || !reflect.DeepEqual(got.Shipments, tt.want) {
+				t.Errorf("Allocate = %+v, want %s %+v", got, tt.policy, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocateShortage(t *testing.T) {
+	stock := Stock{"x": {"a": 2, "b": 5}, "y": {"a": 1}}
+	_, err := DefaultConfig().Allocate([]Line{{"a", 2}, {"b", 1}, {"a", 2}, {"c", 1}}, stock, "")
+
+	var shortage *ShortageError
+	if !errors.As(err, &shortage) {
+		t.Fatalf("Allocate error = %v, want a ShortageError", err)
+	}
+	want := []Shortage{
+		{ProductID: "a", Requested: 4, Available: 3},
+		{ProductID: "c", Requested: 1, Available: 0},
+	}
+	if !reflect.DeepEqual(shortage.Items, want) {
+		t.Errorf("shortages = %+v, want %+v", shortage.Items, want)
+	}
+}
@@ -0,0 +1,123 @@
+package fulfillment
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Built-in policy names, as used in the config file and recorded with each allocation
+const (
+	PolicyPreferOnline = "preferOnline"
+	PolicyNearestStore = "nearestStore"
+	PolicyMostStock    = "mostStock"
+)
+
+// Policy ranks the locations an order can ship from, most preferred first. Allocate always
+// uses as few shipments as it can; the policy decides between allocations with the same
+// number of shipments, and which location fills a line that several of them could.
+type Policy interface {
+	Rank(order Order, locations []string) []string
+}
+
+// PolicyFunc lets an ordinary function be used as a Policy
+type PolicyFunc func(order Order, locations []string) []string
+
+func (f PolicyFunc) Rank(order Order, locations []string) []string {
+	return f(order, locations)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]func(*Config) Policy{
+		PolicyMostStock:    func(*Config) Policy { return PolicyFunc(mostStock) },
+		PolicyPreferOnline: func(c *Config) Policy { return preferOnline{config: c} },
+		PolicyNearestStore: func(c *Config) Policy { return nearestStore{config: c} },
+	}
+)
+
+// Register makes a policy available to the config file under name. build is called with the
+// config each time a file naming the policy is loaded, so Register must be called before Init.
+func Register(name string, build func(*Config) Policy) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = build
+}
+
+func newPolicy(name string, c *Config) (Policy, error) {
+	registryMu.RLock()
+	build, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown fulfillment policy %q", name)
+	}
+	return build(c), nil
+}
+
+// mostStock prefers the locations holding the most units of the ordered products, which
+// leaves the smaller stores' shelves alone
+func mostStock(order Order, locations []string) []string {
+	return rankBy(locations, func(a, b string) bool {
+		return order.held(a) > order.held(b)
+	})
+}
+
+// preferOnline ships from online warehouses before stores, so walk-in stock stays on the
+// shelves. Between warehouses, and between stores, it prefers the most stock.
+type preferOnline struct {
+	config *Config
+}
+
+func (p preferOnline) Rank(order Order, locations []string) []string {
+	ranked := mostStock(order, locations)
+	return rankBy(ranked, func(a, b string) bool {
+		return p.config.Locations[a].Online && !p.config.Locations[b].Online
+	})
+}
+
+// nearestStore ships from the locations closest to the customer's region. Locations without
+// a position come after those with one, and when the region has no position the policy falls
+// back to mostStock.
+type nearestStore struct {
+	config *Config
+}
+
+func (p nearestStore) Rank(order Order, locations []string) []string {
+	ranked := mostStock(order, locations)
+	customer, ok := p.config.Regions[order.Region]
+	if !ok {
+		return ranked
+	}
+
+	distance := func(location string) float64 {
+		position := p.config.Locations[location].Position
+		if position == nil {
+			return math.Inf(1)
+		}
+		return distanceKm(customer, *position)
+	}
+	return rankBy(ranked, func(a, b string) bool {
+		return distance(a) < distance(b)
+	})
+}
+
+// rankBy returns a copy of locations stably sorted by less, so locations that less does not
+// tell apart keep their order
+func rankBy(locations []string, less func(a, b string) bool) []string {
+	ranked := append([]string(nil), locations...)
+	sort.SliceStable(ranked, func(i, j int) bool { return less(ranked[i], ranked[j]) })
+	return ranked
+}
+
+// earthRadiusKm is the mean radius of the Earth
+const earthRadiusKm = 6371.0
+
+// distanceKm is the great-circle distance between two points
+func distanceKm(a, b Coordinates) float64 {
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
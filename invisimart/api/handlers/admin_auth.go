@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+
+	"invisimart-api/adminauth"
+)
+
+// requireAdmin authenticates a request to an admin endpoint and returns the admin's name. It
+// writes a 401 and returns false if the request has no valid admin token.
+func requireAdmin(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name, ok := adminauth.Authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="invisimart-admin"`)
+		writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "A valid admin API token is required")
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"invisimart-api/db"
+	"invisimart-api/middleware"
+	"invisimart-api/notifications"
+	"invisimart-api/validation"
+	"invisimart-api/vault"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// GetAdminPurchaseHandler returns the full record of an order to an authenticated admin: the
+// guest view plus internal fields such as the invoice number, fraud score and guest lookup
+// lockout
+func GetAdminPurchaseHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	orderID, ok := parseOrderID(w, r, mux.Vars(r)["orderId"])
+	if !ok {
+		return
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to retrieve purchase", err)
+		return
+	}
+
+	response, err := loadPurchaseDetails(database, orderID)
+	if err == sql.ErrNoRows {
+		writeNotFound(w, r, "Purchase not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, "Failed to retrieve purchase", err)
+		return
+	}
+
+	var purchaseID, failedLookups int
+	var invoiceNumber, fraudScore sql.NullInt64
+	var lockedUntil, updatedAt sql.NullTime
+	var clientIP sql.NullString
+	var fraudSignals []byte
+	err = database.QueryRow(`
+		SELECT p.id, p.invoice_number, p.updated_at, p.client_ip, p.fraud_score, p.fraud_signals,
+			COALESCE(f.failed_attempts, 0), CASE WHEN f.locked_until > NOW() THEN f.locked_until END
+		FROM purchases p
+		LEFT JOIN order_lookup_failures f ON f.purchase_id = p.id
+		WHERE p.order_id = $1
+	`, orderID).Scan(&purchaseID, &invoiceNumber, &updatedAt, &clientIP, &fraudScore, &fraudSignals,
+		&failedLookups, &lockedUntil)
+	if err != nil {
+		writeInternalError(w, r, "Failed to retrieve purchase", err)
+		return
+	}
+
+	response["id"] = purchaseID
+	if updatedAt.Valid {
+		response["updatedAt"] = updatedAt.Time.Format(time.RFC3339)
+	}
+	if invoiceNumber.Valid {
+		response["invoiceNumber"] = invoiceNumber.Int64
+	}
+	lookup := map[string]interface{}{"failedAttempts": failedLookups}
+	if lockedUntil.Valid {
+		lookup["lockedUntil"] = lockedUntil.Time.Format(time.RFC3339)
+	}
+	response["guestLookup"] = lookup
+
+	// Orders placed before fraud screening have no score
+	if fraudScore.Valid {
+		screening := map[string]interface{}{"score": fraudScore.Int64, "signals": json.RawMessage(fraudSignals)}
+		if clientIP.Valid {
+			screening["clientIp"] = clientIP.String
+		}
+		response["fraud"] = screening
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// Fields that can be revealed, named as in PurchaseRequest
+const (
+	revealCustomerPhone = "customerPhone"
+	revealCreditCard    = "creditCard"
+)
+
+// maxRevealReasonLength bounds the reason stored in the audit record
+const maxRevealReasonLength = 500
+
+// RevealRequest asks for encrypted fields of an order to be decrypted. Reason is stored in
+// the audit record.
+type RevealRequest struct {
+	Fields []string `json:"fields"`
+	Reason string   `json:"reason"`
+}
+
+// RevealResponse holds the decrypted fields. Card numbers are masked to their last four digits.
+type RevealResponse struct {
+	OrderID    string            `json:"orderId"`
+	Fields     map[string]string `json:"fields"`
+	RevealedBy string            `json:"revealedBy"`
+	RevealedAt string            `json:"revealedAt"`
+	AuditID    int64             `json:"auditId"`
+}
+
+// validateRevealRequest checks the requested fields and reason, trimming the reason
+func validateRevealRequest(req *RevealRequest) validation.Errors {
+	var errs validation.Errors
+
+	if len(req.Fields) == 0 {
+		errs.Add("fields", validation.CodeRequired, "At least one field is required")
+	}
+	seen := make(map[string]bool)
+	for i, field := range req.Fields {
+		name := fmt.Sprintf("fields[%d]", i)
+		switch {
+		case field != revealCustomerPhone && field != revealCreditCard:
+			errs.Addf(name, validation.CodeUnsupportedValue, "%q cannot be revealed; use %s or %s",
+				field, revealCustomerPhone, revealCreditCard)
+		case seen[field]:
+			errs.Addf(name, validation.CodeDuplicate, "%s is listed more than once", field)
+		}
+		seen[field] = true
+	}
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if errs.Required("reason", req.Reason, "Reason") {
+		errs.MaxLength("reason", req.Reason, "Reason", maxRevealReasonLength)
+	}
+	return errs
+}
+
+// RevealPurchaseFieldsHandler decrypts an order's phone number or card for an authenticated
+// admin. Every reveal is recorded in purchase_reveal_audit before anything is returned.
+func RevealPurchaseFieldsHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	orderID, ok := parseOrderID(w, r, mux.Vars(r)["orderId"])
+	if !ok {
+		return
+	}
+
+	var req RevealRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidBody(w, r, err)
+		return
+	}
+	if errs := validateRevealRequest(&req); len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	if !vault.IsAvailable() {
+		writeError(w, r, http.StatusServiceUnavailable, CodeServiceUnavailable,
+			"Vault is not available, so customer data cannot be decrypted")
+		return
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to reveal customer data", err)
+		return
+	}
+
+	var purchaseID int
+	var phone, card string
+	err = database.QueryRow(`
+		SELECT id, customer_phone_encrypted, credit_card_encrypted FROM purchases WHERE order_id = $1
+	`, orderID).Scan(&purchaseID, &phone, &card)
+	if err == sql.ErrNoRows {
+		writeNotFound(w, r, "Purchase not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, "Failed to reveal customer data", err)
+		return
+	}
+	ciphertexts := map[string]string{revealCustomerPhone: phone, revealCreditCard: card}
+
+	revealed := make(map[string]string, len(req.Fields))
+	for _, field := range req.Fields {
+		ciphertext := ciphertexts[field]
+		if vault.IsMockCiphertext(ciphertext) {
+			writeError(w, r, http.StatusConflict, CodeConflict,
+				fmt.Sprintf("%s was stored while Vault was unavailable and cannot be decrypted", field))
+			return
+		}
+
+		plaintext, err := vault.DecryptData(transitKey, ciphertext)
+		if err != nil {
+			writeInternalError(w, r, "Failed to decrypt customer data", err)
+			return
+		}
+		if field == revealCreditCard {
+			// The full card number never leaves this function
+			plaintext = notifications.MaskCard(plaintext)
+		}
+		revealed[field] = plaintext
+	}
+
+	// Record the reveal before responding; if the audit record cannot be written, nothing is returned
+	var auditID int64
+	var revealedAt time.Time
+	err = database.QueryRow(`
+		INSERT INTO purchase_reveal_audit (purchase_id, order_id, revealed_by, fields, reason, request_id)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+		RETURNING id, created_at
+	`, purchaseID, orderID, admin, pq.Array(req.Fields), req.Reason, middleware.RequestID(r)).Scan(&auditID, &revealedAt)
+	if err != nil {
+		writeInternalError(w, r, "Failed to record reveal", err)
+		return
+	}
+
+	log.Printf("Admin %s revealed %s of order %s (audit %d)", admin, strings.Join(req.Fields, ", "), orderID, auditID)
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, RevealResponse{
+		OrderID:    orderID,
+		Fields:     revealed,
+		RevealedBy: admin,
+		RevealedAt: revealedAt.Format(time.RFC3339),
+		AuditID:    auditID,
+	})
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+
+	"invisimart-api/notifications"
+	"invisimart-api/validation"
+)
+
+// CardSummary describes the card an order was paid with. It is stored in clear next to the
+// Transit ciphertext, so past orders can be shown without decrypting anything.
+type CardSummary struct {
+	Brand    string `json:"brand,omitempty"`
+	Last4    string `json:"last4"`
+	ExpMonth int    `json:"expMonth,omitempty"`
+	ExpYear  int    `json:"expYear,omitempty"`
+}
+
+// Masked returns the card for display, such as "Visa **** 4242"
+func (c CardSummary) Masked() string {
+	masked := notifications.MaskCard(c.Last4)
+	if name := validation.BrandName(c.Brand); name != "" {
+		return name + " " + masked
+	}
+	return masked
+}
+
+// Expiry returns the expiry as MM/YYYY, or "" if none was given
+func (c CardSummary) Expiry() string {
+	if c.ExpMonth == 0 || c.ExpYear == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%02d/%d", c.ExpMonth, c.ExpYear)
+}
+
+// cardColumns are the card columns of purchases, in storedCard field order
+const cardColumns = "card_brand, card_last4, card_exp_month, card_exp_year"
+
+// storedCard receives the card columns of a purchase row
+type storedCard struct {
+	brand, last4      sql.NullString
+	expMonth, expYear sql.NullInt64
+}
+
+// summary returns the stored card, or nil for orders placed before cards were recorded
+func (c storedCard) summary() *CardSummary {
+	if !c.last4.Valid {
+		return nil
+	}
+	return &CardSummary{
+		Brand:    c.brand.String,
+		Last4:    c.last4.String,
+		ExpMonth: int(c.expMonth.Int64),
+		ExpYear:  int(c.expYear.Int64),
+	}
+}
+
+// cardLast4 returns the last four digits of a normalized card number
+func cardLast4(number string) string {
+	if len(number) < 4 {
+		return ""
+	}
+	return number[len(number)-4:]
+}
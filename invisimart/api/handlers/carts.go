@@ -0,0 +1,620 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"invisimart-api/db"
+	"invisimart-api/money"
+	"invisimart-api/validation"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Cart statuses
+const (
+	CartActive    = "active"
+	CartConverted = "converted"
+	CartExpired   = "expired"
+)
+
+const (
+	// defaultCartTTL is used when CART_TTL is unset or invalid
+	defaultCartTTL = 72 * time.Hour
+
+	// defaultCartSweepInterval is used when CART_SWEEP_INTERVAL is unset or invalid
+	defaultCartSweepInterval = 5 * time.Minute
+
+	// maxCartLineQuantity caps a single cart line
+	maxCartLineQuantity = 99
+)
+
+// CartItemRequest adds or updates a cart line
+type CartItemRequest struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+}
+
+// CreateCartRequest is the optional body of POST /carts
+type CreateCartRequest struct {
+	CustomerEmail string            `json:"customerEmail"`
+	Items         []CartItemRequest `json:"items"`
+}
+
+// CartCheckoutRequest is the body of POST /carts/{id}/checkout; the items come from the cart
+type CartCheckoutRequest struct {
+	CustomerName    string `json:"customerName"`
+	CustomerEmail   string `json:"customerEmail"`
+	CustomerPhone   string `json:"customerPhone"`
+	CreditCard      string `json:"creditCard"`
+	CardExpiryMonth int    `json:"cardExpiryMonth,omitempty"`
+	CardExpiryYear  int    `json:"cardExpiryYear,omitempty"`
+	BillingAddress  string `json:"billingAddress"`
+	Location        string `json:"location,omitempty"`
+	PromoCode       string `json:"promoCode,omitempty"`
+	Currency        string `json:"currency,omitempty"`
+}
+
+// CartLine is a cart item with its live price and availability
+type CartLine struct {
+	ProductID string      `json:"productId"`
+	Name      string      `json:"name"`
+	Image     string      `json:"image"`
+	Quantity  int         `json:"quantity"`
+	UnitPrice money.Money `json:"unitPrice"`
+	LineTotal money.Money `json:"lineTotal"`
+	Available int         `json:"available"`
+	InStock   bool        `json:"inStock"`
+}
+
+// Cart is the response for every cart endpoint
+type Cart struct {
+	ID            string      `json:"id"`
+	Status        string      `json:"status"`
+	CustomerEmail string      `json:"customerEmail,omitempty"`
+	OrderID       string      `json:"orderId,omitempty"`
+	Items         []CartLine  `json:"items"`
+	ItemCount     int         `json:"itemCount"`
+	Subtotal      money.Money `json:"subtotal"`
+	Currency      string      `json:"currency"`
+	CreatedAt     string      `json:"createdAt"`
+	UpdatedAt     string      `json:"updatedAt"`
+	ExpiresAt     string      `json:"expiresAt"`
+}
+
+// cartStateError is returned when a cart exists but can no longer be changed
+type cartStateError struct {
+	Status string
+}
+
+func (e *cartStateError) Error() string {
+	return fmt.Sprintf("Cart is %s and can no longer be changed", e.Status)
+}
+
+// cartLineLimitError is returned when adding to a cart line would take it over
+// maxCartLineQuantity
+type cartLineLimitError struct {
+	ProductID string
+}
+
+func (e *cartLineLimitError) Error() string {
+	return fmt.Sprintf("A cart line can hold at most %d units of product %s", maxCartLineQuantity, e.ProductID)
+}
+
+// cartTTL returns how long an idle cart lives, read from CART_TTL
+func cartTTL() time.Duration {
+	return durationFromEnv("CART_TTL", defaultCartTTL)
+}
+
+// CartSweepInterval returns how often expired carts are swept, read from CART_SWEEP_INTERVAL
+func CartSweepInterval() time.Duration {
+	return durationFromEnv("CART_SWEEP_INTERVAL", defaultCartSweepInterval)
+}
+
+// durationFromEnv reads a positive Go duration from an environment variable
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s %q, using %v", name, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// CreateCartHandler creates a new cart, optionally with initial items
+func CreateCartHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateCartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeInvalidBody(w, r, err)
+		return
+	}
+	var errs validation.Errors
+	for i, item := range req.Items {
+		checkCartItem(&errs, fmt.Sprintf("items[%d].", i), item)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to create cart", err)
+		return
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		writeInternalError(w, r, "Failed to create cart", err)
+		return
+	}
+	defer tx.Rollback()
+
+	cartID := uuid.New().String()
+	_, err = tx.Exec(`
+		INSERT INTO carts (id, customer_email, status, expires_at)
+		VALUES ($1, NULLIF($2, ''), $3, NOW() + $4 * INTERVAL '1 second')
+	`, cartID, req.CustomerEmail, CartActive, int64(cartTTL().Seconds()))
+	if err != nil {
+		writeInternalError(w, r, "Failed to create cart", err)
+		return
+	}
+
+	for _, item := range req.Items {
+		if err := addCartItem(tx, cartID, item); err != nil {
+			writeCartError(w, r, err, "Failed to create cart")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, r, "Failed to create cart", err)
+		return
+	}
+
+	writeCart(w, r, database, cartID, http.StatusCreated)
+}
+
+// GetCartHandler returns a cart with live prices and availability
+func GetCartHandler(w http.ResponseWriter, r *http.Request) {
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to retrieve cart", err)
+		return
+	}
+
+	writeCart(w, r, database, mux.Vars(r)["id"], http.StatusOK)
+}
+
+// AddCartItemHandler adds a quantity of a product to a cart
+func AddCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	var item CartItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		writeInvalidBody(w, r, err)
+		return
+	}
+	var errs validation.Errors
+	if checkCartItem(&errs, "", item); len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	modifyCart(w, r, mux.Vars(r)["id"], func(tx *sql.Tx, cartID string) error {
+		return addCartItem(tx, cartID, item)
+	})
+}
+
+// UpdateCartItemHandler sets the quantity of a cart line; zero removes it
+func UpdateCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var body struct {
+		Quantity int `json:"quantity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeInvalidBody(w, r, err)
+		return
+	}
+	var errs validation.Errors
+	switch {
+	case body.Quantity < 0:
+		errs.Add("quantity", validation.CodeInvalidQuantity, "Quantity must be zero or a positive whole number")
+	case body.Quantity > maxCartLineQuantity:
+		errs.Addf("quantity", validation.CodeQuantityTooLarge, "Quantity must be at most %d", maxCartLineQuantity)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	modifyCart(w, r, vars["id"], func(tx *sql.Tx, cartID string) error {
+		if body.Quantity == 0 {
+			return removeCartItem(tx, cartID, vars["productId"])
+		}
+		return setCartItem(tx, cartID, vars["productId"], body.Quantity)
+	})
+}
+
+// RemoveCartItemHandler removes a product from a cart
+func RemoveCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	modifyCart(w, r, vars["id"], func(tx *sql.Tx, cartID string) error {
+		return removeCartItem(tx, cartID, vars["productId"])
+	})
+}
+
+// CheckoutCartHandler converts a cart into a purchase through the same path as POST /purchase.
+// The cart is marked converted in the purchase transaction, so it can only be checked out once.
+func CheckoutCartHandler(w http.ResponseWriter, r *http.Request) {
+	cartID := mux.Vars(r)["id"]
+
+	var req CartCheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidBody(w, r, err)
+		return
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to check out cart", err)
+		return
+	}
+
+	status, err := activeCartStatus(database, cartID)
+	if err != nil {
+		writeCartError(w, r, err, "Failed to check out cart")
+		return
+	}
+	if status != CartActive {
+		writeError(w, r, http.StatusGone, CodeGone, (&cartStateError{Status: status}).Error())
+		return
+	}
+
+	rows, err := database.Query(`SELECT product_id, quantity FROM cart_items WHERE cart_id = $1 ORDER BY id`, cartID)
+	if err != nil {
+		writeInternalError(w, r, "Failed to check out cart", err)
+		return
+	}
+	defer rows.Close()
+
+	purchase := PurchaseRequest{
+		CustomerName:    req.CustomerName,
+		CustomerEmail:   req.CustomerEmail,
+		CustomerPhone:   req.CustomerPhone,
+		CreditCard:      req.CreditCard,
+		CardExpiryMonth: req.CardExpiryMonth,
+		CardExpiryYear:  req.CardExpiryYear,
+		BillingAddress:  req.BillingAddress,
+		Location:        req.Location,
+		PromoCode:       req.PromoCode,
+		Currency:        req.Currency,
+	}
+	for rows.Next() {
+		var item PurchaseItem
+		if err := rows.Scan(&item.ProductID, &item.Quantity); err != nil {
+			writeInternalError(w, r, "Failed to check out cart", err)
+			return
+		}
+		purchase.Items = append(purchase.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, r, "Failed to check out cart", err)
+		return
+	}
+	rows.Close()
+
+	processPurchase(w, r, purchase, func(tx *sql.Tx, purchaseID int, orderID string) error {
+		result, err := tx.Exec(`
+			UPDATE carts SET status = $1, order_id = $2, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $3 AND status = $4 AND expires_at > NOW()
+		`, CartConverted, orderID, cartID, CartActive)
+		if err != nil {
+			return fmt.Errorf("failed to convert cart: %w", err)
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return &conflictError{Message: "Cart was checked out or expired during checkout"}
+		}
+		log.Printf("Cart converted - CartID: %s, OrderID: %s", cartID, orderID)
+		return nil
+	})
+}
+
+// modifyCart locks an active cart, applies change, extends its expiry and writes the updated cart
+func modifyCart(w http.ResponseWriter, r *http.Request, cartID string, change func(tx *sql.Tx, cartID string) error) {
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to update cart", err)
+		return
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		writeInternalError(w, r, "Failed to update cart", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var status string
+	var expired bool
+	err = tx.QueryRow(`
+		SELECT status, expires_at <= NOW() FROM carts WHERE id = $1 FOR UPDATE
+	`, cartID).Scan(&status, &expired)
+	if err == sql.ErrNoRows {
+		writeNotFound(w, r, "Cart not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, "Failed to update cart", err)
+		return
+	}
+	if expired && status == CartActive {
+		status = CartExpired
+	}
+	if status != CartActive {
+		writeError(w, r, http.StatusGone, CodeGone, (&cartStateError{Status: status}).Error())
+		return
+	}
+
+	if err := change(tx, cartID); err != nil {
+		writeCartError(w, r, err, "Failed to update cart")
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE carts SET updated_at = CURRENT_TIMESTAMP, expires_at = NOW() + $1 * INTERVAL '1 second'
+		WHERE id = $2
+	`, int64(cartTTL().Seconds()), cartID)
+	if err != nil {
+		writeInternalError(w, r, "Failed to update cart", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, r, "Failed to update cart", err)
+		return
+	}
+
+	writeCart(w, r, database, cartID, http.StatusOK)
+}
+
+// checkCartItem records the problems with an item to add, naming its fields after prefix,
+// such as "items[2]."
+func checkCartItem(errs *validation.Errors, prefix string, item CartItemRequest) {
+	errs.Required(prefix+"productId", item.ProductID, "Product ID")
+	switch {
+	case item.Quantity <= 0:
+		errs.Add(prefix+"quantity", validation.CodeInvalidQuantity, "Quantity must be a positive whole number")
+	case item.Quantity > maxCartLineQuantity:
+		errs.Addf(prefix+"quantity", validation.CodeQuantityTooLarge, "Quantity must be at most %d", maxCartLineQuantity)
+	}
+}
+
+// addCartItem adds to a cart line, creating it if needed
+func addCartItem(tx *sql.Tx, cartID string, item CartItemRequest) error {
+	if err := ensureProductExists(tx, item.ProductID); err != nil {
+		return err
+	}
+
+	var quantity int
+	err := tx.QueryRow(`
+		INSERT INTO cart_items (cart_id, product_id, quantity)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (cart_id, product_id) DO UPDATE
+		SET quantity = cart_items.quantity + EXCLUDED.quantity, updated_at = CURRENT_TIMESTAMP
+		RETURNING quantity
+	`, cartID, item.ProductID, item.Quantity).Scan(&quantity)
+	if err != nil {
+		return fmt.Errorf("failed to add cart item: %w", err)
+	}
+	if quantity > maxCartLineQuantity {
+		return &cartLineLimitError{ProductID: item.ProductID}
+	}
+	return nil
+}
+
+// setCartItem sets the quantity of a cart line, creating it if needed
+func setCartItem(tx *sql.Tx, cartID, productID string, quantity int) error {
+	if err := ensureProductExists(tx, productID); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO cart_items (cart_id, product_id, quantity)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (cart_id, product_id) DO UPDATE
+		SET quantity = EXCLUDED.quantity, updated_at = CURRENT_TIMESTAMP
+	`, cartID, productID, quantity)
+	if err != nil {
+		return fmt.Errorf("failed to update cart item: %w", err)
+	}
+	return nil
+}
+
+// removeCartItem deletes a cart line; removing a product that is not in the cart is a no-op
+func removeCartItem(tx *sql.Tx, cartID, productID string) error {
+	_, err := tx.Exec(`DELETE FROM cart_items WHERE cart_id = $1 AND product_id = $2`, cartID, productID)
+	if err != nil {
+		return fmt.Errorf("failed to remove cart item: %w", err)
+	}
+	return nil
+}
+
+func ensureProductExists(tx *sql.Tx, productID string) error {
+	var exists bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM products WHERE product_id = $1)`, productID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to look up product %s: %w", productID, err)
+	}
+	if !exists {
+		return &unknownProductError{ProductID: productID}
+	}
+	return nil
+}
+
+// activeCartStatus returns a cart's status, reporting active carts past their expiry as expired
+func activeCartStatus(database *sql.DB, cartID string) (string, error) {
+	var status string
+	var expired bool
+	err := database.QueryRow(`SELECT status, expires_at <= NOW() FROM carts WHERE id = $1`, cartID).Scan(&status, &expired)
+	if err != nil {
+		return "", err
+	}
+	if expired && status == CartActive {
+		return CartExpired, nil
+	}
+	return status, nil
+}
+
+// loadCart reads a cart with live prices from products and availability from inventory.
+// Prices are shown in the base currency; checkout converts them to the order currency.
+func loadCart(database *sql.DB, cartID string) (*Cart, error) {
+	var cart Cart
+	var customerEmail, orderID sql.NullString
+	var createdAt, updatedAt, expiresAt time.Time
+	var expired bool
+	err := database.QueryRow(`
+		SELECT id, status, customer_email, order_id, created_at, updated_at, expires_at, expires_at <= NOW()
+		FROM carts WHERE id = $1
+	`, cartID).Scan(&cart.ID, &cart.Status, &customerEmail, &orderID, &createdAt, &updatedAt, &expiresAt, &expired)
+	if err != nil {
+		return nil, err
+	}
+	if expired && cart.Status == CartActive {
+		cart.Status = CartExpired
+	}
+	cart.CustomerEmail = customerEmail.String
+	cart.OrderID = orderID.String
+	cart.CreatedAt = createdAt.Format(time.RFC3339)
+	cart.UpdatedAt = updatedAt.Format(time.RFC3339)
+	cart.ExpiresAt = expiresAt.Format(time.RFC3339)
+
+	rows, err := database.Query(`
+		SELECT ci.product_id, p.name, p.image, p.price, p.currency, ci.quantity,
+			COALESCE((SELECT SUM(i.stock) FROM inventory i WHERE i.product_id = ci.product_id), 0)
+		FROM cart_items ci
+		JOIN products p ON p.product_id = ci.product_id
+		WHERE ci.cart_id = $1
+		ORDER BY ci.id
+	`, cartID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cart items: %w", err)
+	}
+	defer rows.Close()
+
+	rates := newRateCache(database)
+	cart.Items = []CartLine{}
+	for rows.Next() {
+		var line CartLine
+		var listed string
+		if err := rows.Scan(&line.ProductID, &line.Name, &line.Image, &line.UnitPrice, &listed, &line.Quantity, &line.Available); err != nil {
+			return nil, fmt.Errorf("failed to scan cart item: %w", err)
+		}
+		if line.UnitPrice, err = rates.basePrice(line.UnitPrice.In(listed)); err != nil {
+			return nil, fmt.Errorf("failed to convert price of product %s: %w", line.ProductID, err)
+		}
+		line.LineTotal = line.UnitPrice.Mul(int64(line.Quantity))
+		line.InStock = line.Available >= line.Quantity
+		cart.Subtotal = cart.Subtotal.Add(line.LineTotal)
+		cart.ItemCount += line.Quantity
+		cart.Items = append(cart.Items, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate cart items: %w", err)
+	}
+
+	cart.Currency = cart.Subtotal.Currency
+	if cart.Currency == "" {
+		cart.Currency = money.DefaultCurrency
+	}
+	return &cart, nil
+}
+
+func writeCart(w http.ResponseWriter, r *http.Request, database *sql.DB, cartID string, status int) {
+	cart, err := loadCart(database, cartID)
+	if err == sql.ErrNoRows {
+		writeNotFound(w, r, "Cart not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, "Failed to retrieve cart", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(cart); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// writeCartError maps errors from cart operations to responses
+func writeCartError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	var unknown *unknownProductError
+	var limit *cartLineLimitError
+	switch {
+	case err == sql.ErrNoRows:
+		writeNotFound(w, r, "Cart not found")
+	case errors.As(err, &unknown):
+		writeError(w, r, http.StatusBadRequest, CodeUnknownProduct, err.Error())
+	case errors.As(err, &limit):
+		var errs validation.Errors
+		errs.Add("quantity", validation.CodeQuantityTooLarge, err.Error())
+		writeValidationErrors(w, r, errs)
+	default:
+		writeInternalError(w, r, message, err)
+	}
+}
+
+// SweepExpiredCarts marks active carts past their expiry as expired. Expired carts and their
+// items are kept for abandonment analysis.
+func SweepExpiredCarts() (int64, error) {
+	database, err := db.GetDB()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := database.Exec(`
+		UPDATE carts SET status = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE status = $2 AND expires_at <= NOW()
+	`, CartExpired, CartActive)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire carts: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// StartCartSweeper expires idle carts every interval until ctx is cancelled
+func StartCartSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := SweepExpiredCarts()
+			if err != nil {
+				log.Printf("Cart sweeper failed: %v", err)
+				continue
+			}
+			if expired > 0 {
+				log.Printf("Cart sweeper expired %d cart(s)", expired)
+			}
+		}
+	}
+}
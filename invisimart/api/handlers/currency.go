@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"invisimart-api/money"
+)
+
+// baseCurrency is the currency orders are priced in before conversion. The pricing rules,
+// promotions and fraud thresholds are all amounts in this currency.
+const baseCurrency = money.DefaultCurrency
+
+// exchangeRate is a rate read from exchange_rates. ID is zero for the identity rate.
+type exchangeRate struct {
+	money.Rate
+	ID            int
+	EffectiveFrom time.Time
+}
+
+// ExchangeRateInfo is the rate an order was converted at, kept on the order for audit
+type ExchangeRateInfo struct {
+	BaseCurrency  string `json:"baseCurrency"`
+	Currency      string `json:"currency"`
+	Rate          string `json:"rate"`
+	EffectiveFrom string `json:"effectiveFrom,omitempty"`
+}
+
+// unsupportedCurrencyError is returned when no exchange rate converts to a currency
+type unsupportedCurrencyError struct {
+	Currency string
+}
+
+func (e *unsupportedCurrencyError) Error() string {
+	return fmt.Sprintf("Currency %s is not supported", e.Currency)
+}
+
+// lookupExchangeRate returns the rate in effect now from one currency to another. A rate
+// stored the other way round is inverted and rounded to the eight places stored on orders.
+func lookupExchangeRate(q queryRower, from, to string) (*exchangeRate, error) {
+	if from == to {
+		return &exchangeRate{Rate: money.Identity(from)}, nil
+	}
+
+	rate, err := queryExchangeRate(q, from, to)
+	if err != sql.ErrNoRows {
+		return rate, err
+	}
+
+	rate, err = queryExchangeRate(q, to, from)
+	if err == sql.ErrNoRows {
+		// Report the currency that is not the base one, since the base is always supported
+		if to == baseCurrency {
+			return nil, &unsupportedCurrencyError{Currency: from}
+		}
+		return nil, &unsupportedCurrencyError{Currency: to}
+	}
+	if err != nil {
+		return nil, err
+	}
+	inverse, err := money.ParseRate(from, to, rate.Inverse().String())
+	if err != nil {
+		return nil, err
+	}
+	rate.Rate = inverse
+	return rate, nil
+}
+
+// queryExchangeRate reads the latest stored base/quote rate that has taken effect
+func queryExchangeRate(q queryRower, base, quote string) (*exchangeRate, error) {
+	var rate exchangeRate
+	var value string
+	err := q.QueryRow(`
+		SELECT id, rate::text, effective_from FROM exchange_rates
+		WHERE base_currency = $1 AND quote_currency = $2 AND effective_from <= NOW()
+		ORDER BY effective_from DESC
+		LIMIT 1
+	`, base, quote).Scan(&rate.ID, &value, &rate.EffectiveFrom)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			err = fmt.Errorf("failed to load exchange rate %s/%s: %w", base, quote, err)
+		}
+		return nil, err
+	}
+	if rate.Rate, err = money.ParseRate(base, quote, value); err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// rateCache looks each currency pair up at most once, for responses that convert many prices
+type rateCache struct {
+	q     queryRower
+	rates map[[2]string]money.Rate
+}
+
+func newRateCache(q queryRower) *rateCache {
+	return &rateCache{q: q, rates: make(map[[2]string]money.Rate)}
+}
+
+// rate returns the rate from one currency to another
+func (c *rateCache) rate(from, to string) (money.Rate, error) {
+	key := [2]string{from, to}
+	if rate, ok := c.rates[key]; ok {
+		return rate, nil
+	}
+
+	rate, err := lookupExchangeRate(c.q, from, to)
+	if err != nil {
+		return money.Rate{}, err
+	}
+	c.rates[key] = rate.Rate
+	return rate.Rate, nil
+}
+
+// basePrice converts a product price from the currency it is listed in to the base currency
+func (c *rateCache) basePrice(price money.Money) (money.Money, error) {
+	rate, err := c.rate(price.Currency, baseCurrency)
+	if err != nil {
+		return money.Money{}, err
+	}
+	return rate.Convert(price), nil
+}
+
+// catalogPrice converts a product price to the currency a customer asked for. It goes through
+// the base currency, the way checkout prices an order, so the price shown is the price charged.
+func (c *rateCache) catalogPrice(price money.Money, currency string) (money.Money, error) {
+	base, err := c.basePrice(price)
+	if err != nil {
+		return money.Money{}, err
+	}
+	rate, err := c.rate(baseCurrency, currency)
+	if err != nil {
+		return money.Money{}, err
+	}
+	return rate.Convert(base), nil
+}
+
+// info describes the rate for a response, or returns nil for the identity rate
+func (r *exchangeRate) info() *ExchangeRateInfo {
+	if r.IsIdentity() {
+		return nil
+	}
+	info := &ExchangeRateInfo{BaseCurrency: r.From, Currency: r.To, Rate: r.String()}
+	if !r.EffectiveFrom.IsZero() {
+		info.EffectiveFrom = r.EffectiveFrom.UTC().Format(time.RFC3339)
+	}
+	return info
+}
+
+// negotiateCurrency picks the currency to show catalog prices in: the "currency" query
+// parameter, or else the most preferred supported currency in the Accept-Currency header,
+// or else the base currency. An unsupported "currency" parameter is refused with 400, while
+// an unsupported header entry is skipped. It writes the error response and returns false on
+// failure.
+func negotiateCurrency(w http.ResponseWriter, r *http.Request, rates *rateCache) (string, bool) {
+	w.Header().Add("Vary", "Accept-Currency")
+
+	if requested := r.URL.Query().Get("currency"); requested != "" {
+		currency := strings.ToUpper(strings.TrimSpace(requested))
+		if !money.ValidCurrency(currency) {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest,
+				fmt.Sprintf("currency must be an ISO 4217 code such as EUR, got %q", requested))
+			return "", false
+		}
+		if _, err := rates.rate(baseCurrency, currency); err != nil {
+			writeCurrencyError(w, r, err, "Failed to convert prices")
+			return "", false
+		}
+		return currency, true
+	}
+
+	for _, currency := range acceptedCurrencies(r.Header.Get("Accept-Currency")) {
+		if currency == "*" {
+			return baseCurrency, true
+		}
+		_, err := rates.rate(baseCurrency, currency)
+		if err == nil {
+			return currency, true
+		}
+		var unsupported *unsupportedCurrencyError
+		if !errors.As(err, &unsupported) {
+			writeInternalError(w, r, "Failed to convert prices", err)
+			return "", false
+		}
+	}
+	return baseCurrency, true
+}
+
+// acceptedCurrencies returns the currencies in an Accept-Currency header, most preferred
+// first, leaving out those with q=0
+func acceptedCurrencies(header string) []string {
+	type preference struct {
+		currency string
+		q        float64
+	}
+	var preferences []preference
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		currency := strings.ToUpper(strings.TrimSpace(params[0]))
+		if currency != "*" && !money.ValidCurrency(currency) {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			preferences = append(preferences, preference{currency: currency, q: q})
+		}
+	}
+
+	// Equal preferences keep the order they were listed in
+	sort.SliceStable(preferences, func(i, j int) bool { return preferences[i].q > preferences[j].q })
+	currencies := make([]string, 0, len(preferences))
+	for _, p := range preferences {
+		currencies = append(currencies, p.currency)
+	}
+	return currencies
+}
+
+// writeCurrencyError refuses an unsupported currency with 400 and reports anything else as
+// an internal error
+func writeCurrencyError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	var unsupported *unsupportedCurrencyError
+	if errors.As(err, &unsupported) {
+		writeError(w, r, http.StatusBadRequest, CodeUnsupportedCurrency,
+			unsupported.Error()+"; no exchange rate is in effect for it")
+		return
+	}
+	writeInternalError(w, r, message, err)
+}
+
+// rateColumns are the currency columns of purchases, in storedRate field order
+const rateColumns = "currency, base_currency, exchange_rate::text, exchange_rate_effective_from"
+
+// storedRate receives the currency columns of a purchase row. Amounts on the order are read
+// as the default currency and relabelled with currency.
+type storedRate struct {
+	currency, base, rate string
+	effectiveFrom        sql.NullTime
+}
+
+// info describes the rate the order was converted at, or returns nil for an order in the base
+// currency
+func (s storedRate) info() *ExchangeRateInfo {
+	if s.currency == s.base {
+		return nil
+	}
+	info := &ExchangeRateInfo{BaseCurrency: s.base, Currency: s.currency, Rate: s.rate}
+	if s.effectiveFrom.Valid {
+		info.EffectiveFrom = s.effectiveFrom.Time.UTC().Format(time.RFC3339)
+	}
+	return info
+}
@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 	"os"
 	"time"
 
 	"invisimart-api/db"
+	"invisimart-api/middleware"
 )
 
 type DatabaseHealthResponse struct {
@@ -44,7 +46,8 @@ func TestDBHandler(w http.ResponseWriter, r *http.Request) {
 	database, err := db.GetDB()
 	if err != nil {
 		response.Status = "unhealthy"
-		response.Message = "Failed to get database connection: " + err.Error()
+		response.Message = "Failed to get database connection"
+		log.Printf("Database health check failed to get a connection: %v (request_id=%s)", err, middleware.RequestID(r))
 		response.ResponseTime = time.Since(startTime).String()
 
 		w.Header().Set("Content-Type", "application/json")
@@ -55,7 +58,8 @@ func TestDBHandler(w http.ResponseWriter, r *http.Request) {
 
 	if err := database.Ping(); err != nil {
 		response.Status = "unhealthy"
-		response.Message = "Failed to ping database: " + err.Error()
+		response.Message = "Failed to ping database"
+		log.Printf("Database health check ping failed: %v (request_id=%s)", err, middleware.RequestID(r))
 		response.ResponseTime = time.Since(startTime).String()
 
 		w.Header().Set("Content-Type", "application/json")
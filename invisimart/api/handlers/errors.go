@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"invisimart-api/middleware"
+)
+
+// Stable error codes returned in the "code" member of every problem response. Clients should
+// branch on these rather than on the human-readable title or detail.
+const (
+	CodeInvalidRequest           = "invalid_request"
+	CodeUnauthorized             = "unauthorized"
+	CodeValidationFailed         = "validation_failed"
+	CodeNotFound                 = "not_found"
+	CodeMethodNotAllowed         = "method_not_allowed"
+	CodeNotAcceptable            = "not_acceptable"
+	CodeConflict                 = "conflict"
+	CodeGone                     = "gone"
+	CodeInvalidOrderID           = "invalid_order_id"
+	CodeUnknownProduct           = "unknown_product"
+	CodePriceMismatch            = "price_mismatch"
+	CodeInsufficientStock        = "insufficient_stock"
+	CodeInvalidStatusTransition  = "invalid_status_transition"
+	CodePromoCodeRejected        = "promo_code_rejected"
+	CodeUnsupportedCurrency      = "unsupported_currency"
+	CodeIdempotencyKeyReused     = "idempotency_key_reused"
+	CodeIdempotencyKeyInProgress = "idempotency_key_in_progress"
+	CodeTooManyRequests          = "too_many_requests"
+	CodePaymentDeclined          = "payment_declined"
+	CodePaymentTimeout           = "payment_timeout"
+	CodePaymentProcessorError    = "payment_processor_error"
+	CodeServiceUnavailable       = "service_unavailable"
+	CodeInternal                 = "internal_error"
+)
+
+// problemTitles is the short, fixed summary of each error code
+var problemTitles = map[string]string{
+	CodeInvalidRequest:           "Invalid request",
+	CodeUnauthorized:             "Authentication required",
+	CodeValidationFailed:         "Validation failed",
+	CodeNotFound:                 "Resource not found",
+	CodeMethodNotAllowed:         "Method not allowed",
+	CodeNotAcceptable:            "Not acceptable",
+	CodeConflict:                 "Conflict with current state",
+	CodeGone:                     "Resource no longer available",
+	CodeInvalidOrderID:           "Invalid order ID",
+	CodeUnknownProduct:           "Unknown product",
+	CodePriceMismatch:            "Price has changed",
+	CodeInsufficientStock:        "Insufficient stock",
+	CodeInvalidStatusTransition:  "Invalid status transition",
+	CodePromoCodeRejected:        "Promo code rejected",
+	CodeUnsupportedCurrency:      "Unsupported currency",
+	CodeIdempotencyKeyReused:     "Idempotency key reused",
+	CodeIdempotencyKeyInProgress: "Idempotency key in progress",
+	CodeTooManyRequests:          "Too many requests",
+	CodePaymentDeclined:          "Payment declined",
+	CodePaymentTimeout:           "Payment timed out",
+	CodePaymentProcessorError:    "Payment processor error",
+	CodeServiceUnavailable:       "Service unavailable",
+	CodeInternal:                 "Internal server error",
+}
+
+// problemTypePrefix turns an error code into the problem type URI
+const problemTypePrefix = "urn:invisimart:problem:"
+
+// Problem is an RFC 7807 problem details response. Extensions holds additional members, such
+// as the list of invalid fields, that are written alongside the standard ones.
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Code       string
+	RequestID  string
+	Extensions map[string]interface{}
+}
+
+// MarshalJSON writes the standard members and the extensions as one flat object
+func (p Problem) MarshalJSON() ([]byte, error) {
+	body := make(map[string]interface{}, len(p.Extensions)+7)
+	for name, value := range p.Extensions {
+		body[name] = value
+	}
+	body["type"] = p.Type
+	body["title"] = p.Title
+	body["status"] = p.Status
+	body["code"] = p.Code
+	if p.Detail != "" {
+		body["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		body["instance"] = p.Instance
+	}
+	if p.RequestID != "" {
+		body["requestId"] = p.RequestID
+	}
+	return json.Marshal(body)
+}
+
+// newProblem builds a problem for a request. detail is shown to the client, so it must never
+// contain internal error text.
+func newProblem(r *http.Request, status int, code, detail string) Problem {
+	title, ok := problemTitles[code]
+	if !ok {
+		title = http.StatusText(status)
+	}
+	return Problem{
+		Type:      problemTypePrefix + code,
+		Title:     title,
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: middleware.RequestID(r),
+	}
+}
+
+// writeProblemResponse writes a problem as application/problem+json
+func writeProblemResponse(w http.ResponseWriter, problem Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		log.Printf("Failed to encode problem response: %v", err)
+	}
+}
+
+// writeError responds with a client-facing error
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	writeProblemResponse(w, newProblem(r, status, code, detail))
+}
+
+// writeInternalError logs err with the request ID and responds with a generic 500 whose
+// detail is the sanitized message
+func writeInternalError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	problem := newProblem(r, http.StatusInternalServerError, CodeInternal, message)
+	log.Printf("%s: %v (request_id=%s)", message, err, problem.RequestID)
+	writeProblemResponse(w, problem)
+}
+
+// writeInvalidBody rejects a request body that could not be decoded. The decoder's message
+// only describes the client's JSON, so it is safe to return.
+func writeInvalidBody(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body: "+err.Error())
+}
+
+// writeNotFound responds with 404 for a missing resource
+func writeNotFound(w http.ResponseWriter, r *http.Request, detail string) {
+	writeError(w, r, http.StatusNotFound, CodeNotFound, detail)
+}
+
+// NotFoundHandler answers requests that match no route
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeNotFound(w, r, "No endpoint matches this path")
+}
+
+// MethodNotAllowedHandler answers requests to a known path with an unsupported method
+func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method+" is not supported for this endpoint")
+}
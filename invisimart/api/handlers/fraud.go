@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"invisimart-api/db"
+	"invisimart-api/fraud"
+	"invisimart-api/money"
+	"invisimart-api/payments"
+	"invisimart-api/validation"
+
+	"github.com/gorilla/mux"
+)
+
+// Hash kinds for fraud.Hash
+const (
+	fraudHashPhone = "phone"
+	fraudHashCard  = "card"
+)
+
+// maxReviewReasonLength bounds the reason recorded with a review decision
+const maxReviewReasonLength = 500
+
+// fraudHistory answers the fraud rules' questions about past orders inside the purchase
+// transaction
+type fraudHistory struct {
+	tx *sql.Tx
+}
+
+// fraudHistoryColumns maps a fraud.History key to the purchases column it is matched against
+var fraudHistoryColumns = map[string]string{
+	fraud.KeyEmail: "LOWER(customer_email)",
+	fraud.KeyPhone: "customer_phone_hash",
+	fraud.KeyIP:    "client_ip",
+}
+
+func (h fraudHistory) CountOrders(key, value string, window time.Duration) (int, error) {
+	column, ok := fraudHistoryColumns[key]
+	if !ok {
+		return 0, fmt.Errorf("unknown fraud history key %q", key)
+	}
+	if key == fraud.KeyEmail {
+		value = strings.ToLower(value)
+	}
+
+	var count int
+	err := h.tx.QueryRow(`
+		SELECT COUNT(*) FROM purchases
+		WHERE `+column+` = $1 AND created_at >= NOW() - $2::integer * INTERVAL '1 second'
+	`, value, int(window.Seconds())).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count orders by %s: %w", key, err)
+	}
+	return count, nil
+}
+
+func (h fraudHistory) CountCards(email, fingerprint string, window time.Duration) (int, error) {
+	var count int
+	err := h.tx.QueryRow(`
+		SELECT COUNT(*) FROM (
+			SELECT card_fingerprint FROM purchases
+			WHERE LOWER(customer_email) = LOWER($1) AND card_fingerprint IS NOT NULL
+				AND created_at >= NOW() - $3::integer * INTERVAL '1 second'
+			UNION
+			SELECT $2
+		) cards
+	`, email, fingerprint, int(window.Seconds())).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count cards: %w", err)
+	}
+	return count, nil
+}
+
+// screenPurchase scores a new order against the fraud rules. It takes a lock on the
+// customer's email address until the transaction ends, so a burst of concurrent orders is
+// counted one after another rather than all slipping past the velocity rules together.
+func screenPurchase(tx *sql.Tx, order fraud.Order) (fraud.Assessment, error) {
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('fraud:' || LOWER($1)))`, order.Email); err != nil {
+		return fraud.Assessment{}, fmt.Errorf("failed to lock customer for fraud screening: %w", err)
+	}
+	return fraud.Evaluate(order, fraudHistory{tx: tx})
+}
+
+// clientIP returns the address the request came from. X-Forwarded-For is only believed when
+// TRUST_PROXY_HEADERS is true, as it is when the API runs behind a load balancer.
+func clientIP(r *http.Request) string {
+	if strings.ToLower(os.Getenv("TRUST_PROXY_HEADERS")) == "true" {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			if ip := net.ParseIP(strings.TrimSpace(first)); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// ReviewDecisionRequest is the body of the approve and reject endpoints. Reason is recorded
+// in the status timeline and is required to reject.
+type ReviewDecisionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ReviewDecisionResponse is returned after an order held for review is approved or rejected.
+// Adjustment describes the restock and release of payment on rejection.
+type ReviewDecisionResponse struct {
+	OrderID    string              `json:"orderId"`
+	Status     string              `json:"status"`
+	ReviewedBy string              `json:"reviewedBy"`
+	Payment    *PaymentInfo        `json:"payment,omitempty"`
+	Adjustment *AdjustmentResponse `json:"adjustment,omitempty"`
+	Timeline   []StatusChange      `json:"timeline"`
+}
+
+// ApprovePurchaseHandler releases an order held for review: the authorized payment is
+// captured and the order becomes paid
+func ApprovePurchaseHandler(w http.ResponseWriter, r *http.Request) {
+	decideReview(w, r, StatusPaid)
+}
+
+// RejectPurchaseHandler refuses an order held for review: it is cancelled, its items are
+// restocked and the authorization is voided
+func RejectPurchaseHandler(w http.ResponseWriter, r *http.Request) {
+	decideReview(w, r, StatusCancelled)
+}
+
+// decideReview moves an order out of review to the given status on behalf of an admin
+func decideReview(w http.ResponseWriter, r *http.Request, targetStatus string) {
+	admin, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	orderID, ok := parseOrderID(w, r, mux.Vars(r)["orderId"])
+	if !ok {
+		return
+	}
+
+	var req ReviewDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeInvalidBody(w, r, err)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	var errs validation.Errors
+	if targetStatus == StatusCancelled {
+		errs.Required("reason", req.Reason, "Reason")
+	}
+	errs.MaxLength("reason", req.Reason, "Reason", maxReviewReasonLength)
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to review purchase", err)
+		return
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		writeInternalError(w, r, "Failed to review purchase", err)
+		return
+	}
+	defer tx.Rollback()
+
+	purchaseID, status, err := lockPurchase(tx, orderID)
+	if err == sql.ErrNoRows {
+		writeNotFound(w, r, "Purchase not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, "Failed to review purchase", err)
+		return
+	}
+	if status != StatusReview {
+		writeError(w, r, http.StatusConflict, CodeConflict,
+			fmt.Sprintf("Order %s is not held for review; its status is %s", orderID, status))
+		return
+	}
+
+	response := ReviewDecisionResponse{OrderID: orderID, Status: targetStatus, ReviewedBy: admin}
+	var capture bool
+	if targetStatus == StatusCancelled {
+		adjustment, err := applyAdjustment(tx, purchaseID, orderID, status, AdjustmentCancel, AdjustmentRequest{
+			Reason:    "Rejected in fraud review: " + req.Reason,
+			ChangedBy: admin,
+		})
+		if err != nil {
+			writeAdjustmentError(w, r, err)
+			return
+		}
+		response.Adjustment = adjustment
+	} else {
+		response.Payment, err = loadPaymentInfo(tx, purchaseID)
+		if err != nil {
+			writeInternalError(w, r, "Failed to review purchase", err)
+			return
+		}
+
+		// An authorized payment is captured once the approval is committed, so the order
+		// stays pending until the capture is recorded
+		capture = response.Payment != nil && response.Payment.Status == payments.StatusAuthorized
+		if capture {
+			response.Status = StatusPending
+		}
+		note := "Approved in fraud review"
+		if req.Reason != "" {
+			note += ": " + req.Reason
+		}
+		if err := transitionStatus(tx, purchaseID, status, response.Status, admin, note); err != nil {
+			writeInternalError(w, r, "Failed to review purchase", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, r, "Failed to review purchase", err)
+		return
+	}
+
+	// A rejection voids the authorization once the cancellation is committed
+	if response.Adjustment != nil {
+		if err := settleAdjustment(database, purchaseID, response.Adjustment); err != nil {
+			writeAdjustmentError(w, r, err)
+			return
+		}
+		response.Payment = response.Adjustment.Payment
+	}
+	if capture {
+		if err := captureApproved(database, purchaseID, orderID, response.Payment); err != nil {
+			var paymentErr *payments.Error
+			if errors.As(err, &paymentErr) {
+				writePaymentError(w, r, err)
+				return
+			}
+			writeInternalError(w, r, "Failed to review purchase", err)
+			return
+		}
+		response.Status = StatusPaid
+	}
+
+	log.Printf("Fraud review of order %s by %s: %s -> %s", orderID, admin, status, targetStatus)
+
+	response.Timeline, err = loadStatusTimeline(database, purchaseID)
+	if err != nil {
+		log.Printf("Failed to load status timeline: %v", err)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// captureApproved captures the payment of an order approved in fraud review, whose approval
+// was committed with the order pending, and records the capture. If the capture fails the
+// order is cancelled, as when a capture fails at checkout.
+func captureApproved(database *sql.DB, purchaseID int, orderID string, payment *PaymentInfo) error {
+	var totalAmount money.Money
+	var currency string
+	err := database.QueryRow(`SELECT total_amount, currency FROM purchases WHERE id = $1`, purchaseID).Scan(&totalAmount, &currency)
+	if err != nil {
+		return err
+	}
+	processor, err := payment.processor()
+	if err != nil {
+		return err
+	}
+	if err := processor.Capture(payment.Reference, totalAmount.In(currency)); err != nil {
+		abandonPurchase(database, orderID, "", err)
+		return err
+	}
+	payment.Status = payments.StatusCaptured
+
+	if err := recordApprovedCapture(database, purchaseID); err != nil {
+		log.Printf("Payment %s for order %s was captured but could not be recorded; reconcile it manually",
+			payment.Reference, orderID)
+		return err
+	}
+	return nil
+}
+
+// recordApprovedCapture moves an approved order from pending to paid once its payment has
+// been captured
+func recordApprovedCapture(database *sql.DB, purchaseID int) error {
+	tx, err := database.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow(`SELECT status FROM purchases WHERE id = $1 FOR UPDATE`, purchaseID).Scan(&status)
+	if err != nil {
+		return fmt.Errorf("failed to lock purchase: %w", err)
+	}
+	_, err = tx.Exec(`UPDATE purchases SET payment_status = $1 WHERE id = $2`, payments.StatusCaptured, purchaseID)
+	if err != nil {
+		return fmt.Errorf("failed to record capture: %w", err)
+	}
+	if err := transitionStatus(tx, purchaseID, status, StatusPaid, systemActor, "Payment captured"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"invisimart-api/fulfillment"
+)
+
+// Fulfillment is one shipment of an order: the items sent from one location
+type Fulfillment struct {
+	Location  string             `json:"location"`
+	Policy    string             `json:"policy"`
+	Items     []fulfillment.Item `json:"items"`
+	CreatedAt string             `json:"createdAt"`
+}
+
+// fulfillmentKey identifies the part of a product shipped from one location
+type fulfillmentKey struct {
+	Location  string
+	ProductID string
+}
+
+// splitItems turns priced items into the order lines to store, one per product and location
+// it ships from. A product is only split when no single location could send all of it.
+func splitItems(items []PurchaseItem, allocation fulfillment.Allocation) []PurchaseItem {
+	placed := make([]PurchaseItem, 0, len(items))
+	for _, item := range items {
+		for _, shipment := range allocation.Shipments {
+			for _, shipped := range shipment.Items {
+				if shipped.ProductID != item.ProductID {
+					continue
+				}
+				part := item
+				part.Quantity = shipped.Quantity
+				part.Location = shipment.Location
+				placed = append(placed, part)
+			}
+		}
+	}
+	return placed
+}
+
+// recordFulfillments writes one fulfillments row per shipment, with its items pointing at the
+// purchase_items rows they were stored as
+func recordFulfillments(tx *sql.Tx, purchaseID int, allocation fulfillment.Allocation, itemIDs map[fulfillmentKey]int) error {
+	for _, shipment := range allocation.Shipments {
+		var fulfillmentID int
+		err := tx.QueryRow(`
+			INSERT INTO fulfillments (purchase_id, location, policy)
+			VALUES ($1, $2, $3)
+			RETURNING id
+		`, purchaseID, shipment.Location, allocation.Policy).Scan(&fulfillmentID)
+		if err != nil {
+			return fmt.Errorf("failed to record fulfillment from %s: %w", shipment.Location, err)
+		}
+
+		for _, item := range shipment.Items {
+			_, err := tx.Exec(`
+				INSERT INTO fulfillment_items (fulfillment_id, purchase_item_id, product_id, quantity)
+				VALUES ($1, $2, $3, $4)
+			`, fulfillmentID, itemIDs[fulfillmentKey{Location: shipment.Location, ProductID: item.ProductID}],
+				item.ProductID, item.Quantity)
+			if err != nil {
+				return fmt.Errorf("failed to record fulfillment item: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// loadFulfillments returns the shipments of a purchase in the order they were allocated.
+// Orders placed before allocation was recorded have none.
+func loadFulfillments(database *sql.DB, purchaseID int) ([]Fulfillment, error) {
+	rows, err := database.Query(`
+		SELECT f.id, f.location, f.policy, f.created_at, fi.product_id, fi.quantity
+		FROM fulfillments f
+		JOIN fulfillment_items fi ON fi.fulfillment_id = f.id
+		WHERE f.purchase_id = $1
+		ORDER BY f.id, fi.id
+	`, purchaseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fulfillments: %w", err)
+	}
+	defer rows.Close()
+
+	fulfillments := []Fulfillment{}
+	lastID := 0
+	for rows.Next() {
+		var id int
+		var f Fulfillment
+		var createdAt time.Time
+		var item fulfillment.Item
+		if err := rows.Scan(&id, &f.Location, &f.Policy, &createdAt, &item.ProductID, &item.Quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan fulfillment: %w", err)
+		}
+		if id != lastID {
+			f.CreatedAt = createdAt.Format(time.RFC3339)
+			fulfillments = append(fulfillments, f)
+			lastID = id
+		}
+		last := &fulfillments[len(fulfillments)-1]
+		last.Items = append(last.Items, item)
+	}
+	return fulfillments, rows.Err()
+}
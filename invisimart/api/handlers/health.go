@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 	"time"
 )
@@ -37,7 +38,6 @@ func HealthHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Encode and send JSON response
 	if err := json.NewEncoder(w).Encode(health); err != nil {
-		http.Error(w, "Failed to encode health response", http.StatusInternalServerError)
-		return
+		log.Printf("Failed to encode health response: %v", err)
 	}
 }
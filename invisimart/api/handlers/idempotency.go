@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	// idempotencyKeyHeader is the request header clients use to make POST /purchase retry-safe
+	idempotencyKeyHeader = "Idempotency-Key"
+
+	// maxIdempotencyKeyLength matches the idempotency_key column size
+	maxIdempotencyKeyLength = 255
+
+	// defaultIdempotencyKeyTTL is used when IDEMPOTENCY_KEY_TTL is unset or invalid
+	defaultIdempotencyKeyTTL = 24 * time.Hour
+)
+
+// storedResponse is a previously committed response recorded against an idempotency key
+type storedResponse struct {
+	Fingerprint string
+	StatusCode  int
+	Body        []byte
+}
+
+// idempotencyKeyTTL returns how long idempotency keys are honored, read from IDEMPOTENCY_KEY_TTL
+func idempotencyKeyTTL() time.Duration {
+	value := os.Getenv("IDEMPOTENCY_KEY_TTL")
+	if value == "" {
+		return defaultIdempotencyKeyTTL
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		log.Printf("Invalid IDEMPOTENCY_KEY_TTL %q, using %v", value, defaultIdempotencyKeyTTL)
+		return defaultIdempotencyKeyTTL
+	}
+	return ttl
+}
+
+// requestFingerprint returns a stable hash of the decoded purchase request. Hashing the
+// re-encoded struct rather than the raw body means whitespace and key order don't matter.
+func requestFingerprint(req PurchaseRequest) (string, error) {
+	encoded, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode request for fingerprint: %w", err)
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// lookupIdempotencyKey returns the completed response stored for key, or nil if the key is
+// unknown, expired, or still held by an in-flight request
+func lookupIdempotencyKey(database *sql.DB, key string) (*storedResponse, error) {
+	var stored storedResponse
+	var statusCode sql.NullInt64
+	var body sql.NullString
+	err := database.QueryRow(`
+		SELECT request_fingerprint, status_code, response_body
+		FROM purchase_idempotency_keys
+		WHERE idempotency_key = $1 AND expires_at > NOW()
+	`, key).Scan(&stored.Fingerprint, &statusCode, &body)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up idempotency key: %w", err)
+	}
+	if !statusCode.Valid {
+		return nil, nil
+	}
+
+	stored.StatusCode = int(statusCode.Int64)
+	stored.Body = []byte(body.String)
+	return &stored, nil
+}
+
+// claimIdempotencyKey records key inside the purchase transaction. An expired row is replaced.
+// If another request holds a live claim the insert waits for that transaction to finish and
+// false is returned, in which case the caller should look the key up again and replay it.
+func claimIdempotencyKey(tx *sql.Tx, key, fingerprint string, ttl time.Duration) (bool, error) {
+	result, err := tx.Exec(`
+		INSERT INTO purchase_idempotency_keys (idempotency_key, request_fingerprint, expires_at)
+		VALUES ($1, $2, NOW() + $3 * INTERVAL '1 second')
+		ON CONFLICT (idempotency_key) DO UPDATE
+		SET request_fingerprint = EXCLUDED.request_fingerprint,
+			order_id = NULL,
+			status_code = NULL,
+			response_body = NULL,
+			created_at = CURRENT_TIMESTAMP,
+			expires_at = EXCLUDED.expires_at
+		WHERE purchase_idempotency_keys.expires_at <= NOW()
+	`, key, fingerprint, int64(ttl.Seconds()))
+	if err != nil {
+		return false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// saveIdempotentResponse stores the response for a claimed key in the same transaction as the order
+func saveIdempotentResponse(tx *sql.Tx, key, orderID string, statusCode int, body []byte) error {
+	_, err := tx.Exec(`
+		UPDATE purchase_idempotency_keys
+		SET order_id = $2, status_code = $3, response_body = $4
+		WHERE idempotency_key = $1
+	`, key, orderID, statusCode, string(body))
+	if err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// releaseIdempotencyKey forgets a claimed key whose order did not go through, so a retry with
+// the same key is processed again
+func releaseIdempotencyKey(tx *sql.Tx, key string) error {
+	if _, err := tx.Exec(`DELETE FROM purchase_idempotency_keys WHERE idempotency_key = $1`, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// writeIdempotentReplay replays a stored response, or rejects the request with 422 when the
+// same key was used with a different request body
+func writeIdempotentReplay(w http.ResponseWriter, r *http.Request, stored *storedResponse, fingerprint string) {
+	if stored.Fingerprint != fingerprint {
+		writeError(w, r, http.StatusUnprocessableEntity, CodeIdempotencyKeyReused,
+			"Idempotency-Key has already been used with a different request")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(stored.StatusCode)
+	w.Write(stored.Body)
+}
@@ -2,25 +2,31 @@ package handlers
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 	"time"
 
 	"invisimart-api/db"
+	"invisimart-api/money"
 
 	_ "github.com/lib/pq"
 )
 
+// defaultLowStockThreshold is the stock level at or below which a product is reported as low
+const defaultLowStockThreshold = 10
+
 type InventoryItem struct {
-	ID                 string    `json:"id"`
-	Name               string    `json:"name"`
-	Image              string    `json:"image"`
-	Price              float64   `json:"price"`
-	OnlineStock        int       `json:"onlineStock"`
-	InStoreStock       int       `json:"inStoreStock"`
-	LowStockThreshold  int       `json:"lowStockThreshold"`
-	LastUpdated        time.Time `json:"lastUpdated"`
-	OnlineInStock      bool      `json:"onlineInStock"`
-	InStoreInStock     bool      `json:"inStoreInStock"`
+	ID                string      `json:"id"`
+	Name              string      `json:"name"`
+	Image             string      `json:"image"`
+	Price             money.Money `json:"price"`
+	Currency          string      `json:"currency"`
+	OnlineStock       int         `json:"onlineStock"`
+	InStoreStock      int         `json:"inStoreStock"`
+	LowStockThreshold int         `json:"lowStockThreshold"`
+	LastUpdated       time.Time   `json:"lastUpdated"`
+	OnlineInStock     bool        `json:"onlineInStock"`
+	InStoreInStock    bool        `json:"inStoreInStock"`
 }
 
 // GetInventoryHandler returns inventory data from the database
@@ -28,7 +34,14 @@ func GetInventoryHandler(w http.ResponseWriter, r *http.Request) {
 	// Get database connection using the consolidated db package
 	database, err := db.GetDB()
 	if err != nil {
-		http.Error(w, "Failed to connect to database: "+err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, r, "Failed to retrieve inventory", err)
+		return
+	}
+
+	// Prices are shown in the currency asked for with ?currency= or Accept-Currency
+	rates := newRateCache(database)
+	currency, ok := negotiateCurrency(w, r, rates)
+	if !ok {
 		return
 	}
 
@@ -39,18 +52,19 @@ func GetInventoryHandler(w http.ResponseWriter, r *http.Request) {
 			p.name,
 			p.image,
 			p.price,
+			p.currency,
 			COALESCE(SUM(CASE WHEN i.location LIKE '%online%' OR i.location = 'main-store' THEN i.stock ELSE 0 END), 0) as online_stock,
 			COALESCE(SUM(CASE WHEN i.location != 'main-store' AND i.location NOT LIKE '%online%' THEN i.stock ELSE 0 END), 0) as in_store_stock,
 			COALESCE(MAX(i.updated_at), NOW()) as last_updated
 		FROM products p
 		LEFT JOIN inventory i ON p.product_id = i.product_id
-		GROUP BY p.product_id, p.name, p.image, p.price
+		GROUP BY p.product_id, p.name, p.image, p.price, p.currency
 		ORDER BY p.product_id
 	`
 
 	rows, err := database.Query(inventoryQuery)
 	if err != nil {
-		http.Error(w, "Failed to query inventory: "+err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, r, "Failed to retrieve inventory", err)
 		return
 	}
 	defer rows.Close()
@@ -58,13 +72,18 @@ func GetInventoryHandler(w http.ResponseWriter, r *http.Request) {
 	inventoryItems := []InventoryItem{}
 
 	for rows.Next() {
-		var productID, name, image string
-		var price float64
+		var productID, name, image, listed string
+		var price money.Money
 		var onlineStock, inStoreStock int
 		var lastUpdated time.Time
 
-		if err := rows.Scan(&productID, &name, &image, &price, &onlineStock, &inStoreStock, &lastUpdated); err != nil {
-			http.Error(w, "Failed to scan inventory row: "+err.Error(), http.StatusInternalServerError)
+		if err := rows.Scan(&productID, &name, &image, &price, &listed, &onlineStock, &inStoreStock, &lastUpdated); err != nil {
+			writeInternalError(w, r, "Failed to retrieve inventory", err)
+			return
+		}
+		price, err := rates.catalogPrice(price.In(listed), currency)
+		if err != nil {
+			writeInternalError(w, r, "Failed to convert inventory prices", err)
 			return
 		}
 
@@ -74,9 +93,10 @@ func GetInventoryHandler(w http.ResponseWriter, r *http.Request) {
 			Name:              name,
 			Image:             image,
 			Price:             price,
+			Currency:          price.Currency,
 			OnlineStock:       onlineStock,
 			InStoreStock:      inStoreStock,
-			LowStockThreshold: 10, // Default threshold
+			LowStockThreshold: defaultLowStockThreshold,
 			LastUpdated:       lastUpdated,
 			OnlineInStock:     onlineStock > 0,
 			InStoreInStock:    inStoreStock > 0,
@@ -87,8 +107,7 @@ func GetInventoryHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(inventoryItems); err != nil {
-		http.Error(w, "Failed to encode inventory: "+err.Error(), http.StatusInternalServerError)
-		return
+		log.Printf("Failed to encode response: %v", err)
 	}
 }
 
@@ -97,7 +116,7 @@ func GetInventoryEventsHandler(w http.ResponseWriter, r *http.Request) {
 	// Get database connection using the consolidated db package
 	database, err := db.GetDB()
 	if err != nil {
-		http.Error(w, "Failed to connect to database: "+err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, r, "Failed to retrieve inventory events", err)
 		return
 	}
 
@@ -112,19 +131,19 @@ func GetInventoryEventsHandler(w http.ResponseWriter, r *http.Request) {
 
 	rows, err := database.Query(eventsQuery)
 	if err != nil {
-		http.Error(w, "Failed to query inventory events: "+err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, r, "Failed to retrieve inventory events", err)
 		return
 	}
 	defer rows.Close()
 
 	type InventoryEvent struct {
-		ProductID       string    `json:"product_id"`
-		EventType       string    `json:"event_type"`
-		QuantityChange  int       `json:"quantity_change"`
-		PreviousStock   int       `json:"previous_stock"`
-		NewStock        int       `json:"new_stock"`
-		Location        string    `json:"location"`
-		CreatedAt       time.Time `json:"created_at"`
+		ProductID      string    `json:"product_id"`
+		EventType      string    `json:"event_type"`
+		QuantityChange int       `json:"quantity_change"`
+		PreviousStock  int       `json:"previous_stock"`
+		NewStock       int       `json:"new_stock"`
+		Location       string    `json:"location"`
+		CreatedAt      time.Time `json:"created_at"`
 	}
 
 	events := []InventoryEvent{}
@@ -133,7 +152,7 @@ func GetInventoryEventsHandler(w http.ResponseWriter, r *http.Request) {
 		var event InventoryEvent
 		if err := rows.Scan(&event.ProductID, &event.EventType, &event.QuantityChange,
 			&event.PreviousStock, &event.NewStock, &event.Location, &event.CreatedAt); err != nil {
-			http.Error(w, "Failed to scan inventory event: "+err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, r, "Failed to retrieve inventory events", err)
 			return
 		}
 		events = append(events, event)
@@ -141,7 +160,6 @@ func GetInventoryEventsHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(events); err != nil {
-		http.Error(w, "Failed to encode inventory events: "+err.Error(), http.StatusInternalServerError)
-		return
+		log.Printf("Failed to encode response: %v", err)
 	}
 }
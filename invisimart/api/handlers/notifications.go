@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"invisimart-api/notifications"
+	"invisimart-api/outbox"
+)
+
+// sendOrderConfirmation emails the customer when an order is placed. It runs from the outbox,
+// so a slow mail server never delays the purchase response and a failed send is retried.
+func sendOrderConfirmation(ctx context.Context, tx *sql.Tx, msg outbox.Message) error {
+	if !notifications.Enabled() {
+		return nil
+	}
+
+	var event orderPlacedEvent
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		return fmt.Errorf("failed to decode order event: %w", err)
+	}
+
+	// Amounts in the payload are bare numbers; the event carries their currency
+	currency := event.Currency
+	lines := make([]notifications.OrderLine, 0, len(event.Items))
+	for _, item := range event.Items {
+		unitPrice := item.UnitPrice.In(currency)
+		lines = append(lines, notifications.OrderLine{
+			Name:      item.ProductName,
+			Quantity:  item.Quantity,
+			UnitPrice: unitPrice,
+			Subtotal:  unitPrice.Mul(int64(item.Quantity)),
+		})
+	}
+
+	breakdown := event.Pricing
+	return notifications.SendOrderConfirmation(notifications.OrderConfirmation{
+		OrderID:        event.OrderID,
+		CustomerName:   event.CustomerName,
+		CustomerEmail:  event.CustomerEmail,
+		Items:          lines,
+		Subtotal:       breakdown.Subtotal.In(currency),
+		Discount:       breakdown.Discount.In(currency),
+		PromoCode:      breakdown.PromoCode,
+		Shipping:       breakdown.Shipping.In(currency),
+		ShippingMethod: breakdown.ShippingMethod,
+		Tax:            breakdown.Tax.In(currency),
+		Total:          breakdown.Total.In(currency),
+		MaskedCard:     event.MaskedCard,
+		PlacedAt:       event.PlacedAt,
+	})
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"invisimart-api/orderid"
+)
+
+// maxOrderIDAttempts bounds how many generated order IDs are tried before giving up
+const maxOrderIDAttempts = 5
+
+// newOrderID generates an order ID that no purchase has yet. The ID is needed before the
+// purchase transaction starts, because the card is authorized under it. The unique constraint
+// on purchases.order_id still rejects the rare ID taken by a concurrent order in between.
+func newOrderID(q queryRower) (string, error) {
+	return generateOrderID(func(orderID string) (bool, error) {
+		var taken bool
+		err := q.QueryRow(`SELECT EXISTS(SELECT 1 FROM purchases WHERE order_id = $1)`, orderID).Scan(&taken)
+		return taken, err
+	})
+}
+
+// generateOrderID returns the first generated order ID that taken reports as free, giving
+// up after maxOrderIDAttempts IDs
+func generateOrderID(taken func(orderID string) (bool, error)) (string, error) {
+	generator := orderid.Current()
+	for attempt := 1; ; attempt++ {
+		orderID, err := generator.Generate(time.Now())
+		if err != nil {
+			return "", err
+		}
+
+		inUse, err := taken(orderID)
+		if err != nil {
+			return "", fmt.Errorf("failed to check order ID: %w", err)
+		}
+		if !inUse {
+			return orderID, nil
+		}
+		if attempt >= maxOrderIDAttempts {
+			return "", fmt.Errorf("no free order ID after %d attempts", attempt)
+		}
+		log.Printf("Order ID %s is already taken, generating another (attempt %d)", orderID, attempt)
+	}
+}
+
+// parseOrderID validates an order ID from the request and returns it in canonical form,
+// writing a 400 if it is malformed. Malformed IDs never reach the database.
+func parseOrderID(w http.ResponseWriter, r *http.Request, raw string) (string, bool) {
+	if raw == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Order ID is required")
+		return "", false
+	}
+
+	orderID, err := orderid.Normalize(raw)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidOrderID, err.Error())
+		return "", false
+	}
+	return orderID, true
+}
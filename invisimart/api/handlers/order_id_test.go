@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"invisimart-api/orderid"
+)
+
+func TestGenerateOrderIDRetriesTakenIDs(t *testing.T) {
+	var tried []string
+	orderID, err := generateOrderID(func(orderID string) (bool, error) {
+		tried = append(tried, orderID)
+		return len(tried) < 3, nil
+	})
+	if err != nil {
+		t.Fatalf("generateOrderID() error = %v", err)
+	}
+	if len(tried) != 3 || orderID != tried[2] {
+		t.Errorf("generateOrderID() = %s after trying %v, want the third ID", orderID, tried)
+	}
+	if _, err := orderid.Normalize(orderID); err != nil {
+		t.Errorf("generateOrderID() returned invalid order ID %s: %v", orderID, err)
+	}
+}
+
+func TestGenerateOrderIDGivesUp(t *testing.T) {
+	attempts := 0
+	_, err := generateOrderID(func(string) (bool, error) {
+		attempts++
+		return true, nil
+	})
+	if err == nil {
+		t.Fatal("generateOrderID() succeeded with every order ID taken")
+	}
+	if attempts != maxOrderIDAttempts {
+		t.Errorf("attempts = %d, want %d", attempts, maxOrderIDAttempts)
+	}
+}
+
+func TestGenerateOrderIDReturnsLookupErrors(t *testing.T) {
+	lookupErr := errors.New("connection reset")
+	attempts := 0
+	_, err := generateOrderID(func(string) (bool, error) {
+		attempts++
+		return false, lookupErr
+	})
+	if !errors.Is(err, lookupErr) {
+		t.Errorf("generateOrderID() error = %v, want %v", err, lookupErr)
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"invisimart-api/ordertoken"
+)
+
+const (
+	defaultOrderLookupTokenTTL    = 30 * 24 * time.Hour
+	defaultOrderLookupMaxFailures = 5
+	defaultOrderLookupLockout     = 15 * time.Minute
+)
+
+// orderLookupMismatch is the detail for every failed guest lookup, so a response never
+// reveals whether the order exists or which credential was wrong
+const orderLookupMismatch = "No order matches this order ID and email address or lookup token"
+
+// OrderLookupTokenTTL is how long the lookup token returned with a new order stays valid,
+// from ORDER_LOOKUP_TOKEN_TTL
+func OrderLookupTokenTTL() time.Duration {
+	return durationFromEnv("ORDER_LOOKUP_TOKEN_TTL", defaultOrderLookupTokenTTL)
+}
+
+// orderLookupLockout is how long guest lookups of an order are refused once it has had too
+// many failed attempts
+func orderLookupLockout() time.Duration {
+	return durationFromEnv("ORDER_LOOKUP_LOCKOUT", defaultOrderLookupLockout)
+}
+
+// orderLookupMaxFailures is the number of failed guest lookups that locks an order
+func orderLookupMaxFailures() int {
+	value := os.Getenv("ORDER_LOOKUP_MAX_FAILURES")
+	if value == "" {
+		return defaultOrderLookupMaxFailures
+	}
+	failures, err := strconv.Atoi(value)
+	if err != nil || failures <= 0 {
+		log.Printf("Invalid ORDER_LOOKUP_MAX_FAILURES %q, using %d", value, defaultOrderLookupMaxFailures)
+		return defaultOrderLookupMaxFailures
+	}
+	return failures
+}
+
+// verifyGuestLookup checks that a guest looking up an order knows its email address (the
+// "email" query parameter) or holds its lookup token ("token"). A lookup token is signed, so
+// it cannot be guessed and is checked before anything else. Email guesses are counted per
+// order, and an order with too many failures refuses them for a while; the lockout never
+// blocks a valid token. It writes the error response and returns false if the lookup is
+// refused.
+func verifyGuestLookup(w http.ResponseWriter, r *http.Request, database *sql.DB, orderID string) bool {
+	query := r.URL.Query()
+	email, token := strings.TrimSpace(query.Get("email")), strings.TrimSpace(query.Get("token"))
+	if email == "" && token == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest,
+			"Provide the email address used for the order or its lookup token")
+		return false
+	}
+
+	if token != "" {
+		err := ordertoken.Verify(orderID, token, time.Now())
+		if errors.Is(err, ordertoken.ErrExpired) {
+			writeNotFound(w, r, "This lookup token has expired; look the order up with its email address instead")
+			return false
+		}
+		if errors.Is(err, ordertoken.ErrNotConfigured) {
+			writeInternalError(w, r, "Failed to retrieve purchase", err)
+			return false
+		}
+		if err != nil {
+			writeNotFound(w, r, orderLookupMismatch)
+			return false
+		}
+		return true
+	}
+
+	var purchaseID, failedAttempts, retryAfter int
+	var customerEmail string
+	err := database.QueryRow(`
+		SELECT p.id, p.customer_email, COALESCE(f.failed_attempts, 0),
+			COALESCE(CEIL(EXTRACT(EPOCH FROM f.locked_until - NOW())), 0)::integer
+		FROM purchases p
+		LEFT JOIN order_lookup_failures f ON f.purchase_id = p.id
+		WHERE p.order_id = $1
+	`, orderID).Scan(&purchaseID, &customerEmail, &failedAttempts, &retryAfter)
+	if err == sql.ErrNoRows {
+		writeNotFound(w, r, orderLookupMismatch)
+		return false
+	}
+	if err != nil {
+		writeInternalError(w, r, "Failed to retrieve purchase", err)
+		return false
+	}
+
+	if retryAfter > 0 {
+		writeLookupLocked(w, r, retryAfter)
+		return false
+	}
+
+	// Addresses are compared case-insensitively: customers rarely retype them exactly
+	if subtle.ConstantTimeCompare([]byte(strings.ToLower(email)), []byte(strings.ToLower(customerEmail))) == 1 {
+		return clearLookupFailures(w, r, database, purchaseID, failedAttempts)
+	}
+
+	retryAfter, err = recordLookupFailure(database, purchaseID)
+	if err != nil {
+		writeInternalError(w, r, "Failed to retrieve purchase", err)
+		return false
+	}
+	if retryAfter > 0 {
+		log.Printf("Guest email lookups of order %s locked after repeated failures", orderID)
+		writeLookupLocked(w, r, retryAfter)
+		return false
+	}
+	writeNotFound(w, r, orderLookupMismatch)
+	return false
+}
+
+// countLookupFailure adds one failed lookup to the failures an order has had so far. It returns
+// the new count and whether the order is now locked; once the count reaches maxFailures the
+// order is locked and the count starts again from zero.
+func countLookupFailure(failedAttempts, maxFailures int) (int, bool) {
+	failedAttempts++
+	if failedAttempts >= maxFailures {
+		return 0, true
+	}
+	return failedAttempts, false
+}
+
+// recordLookupFailure counts a failed guest lookup of a purchase, locking it when it reaches
+// the limit. It returns the number of seconds until the lock ends, or zero if the purchase
+// is not locked.
+func recordLookupFailure(database *sql.DB, purchaseID int) (int, error) {
+	tx, err := database.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to record lookup failure: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Concurrent failures for the same order queue on the row lock, so none is lost
+	_, err = tx.Exec(`
+		INSERT INTO order_lookup_failures (purchase_id, failed_attempts, updated_at)
+		VALUES ($1, 0, NOW())
+		ON CONFLICT (purchase_id) DO NOTHING
+	`, purchaseID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record lookup failure: %w", err)
+	}
+	var failedAttempts int
+	err = tx.QueryRow(`
+		SELECT failed_attempts FROM order_lookup_failures WHERE purchase_id = $1 FOR UPDATE
+	`, purchaseID).Scan(&failedAttempts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record lookup failure: %w", err)
+	}
+
+	failedAttempts, locked := countLookupFailure(failedAttempts, orderLookupMaxFailures())
+	retryAfter := 0
+	if locked {
+		retryAfter = int(orderLookupLockout().Seconds())
+	}
+	_, err = tx.Exec(`
+		UPDATE order_lookup_failures SET failed_attempts = $2,
+			locked_until = CASE WHEN $3 THEN NOW() + $4::integer * INTERVAL '1 second' ELSE locked_until END,
+			updated_at = NOW()
+		WHERE purchase_id = $1
+	`, purchaseID, failedAttempts, locked, retryAfter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record lookup failure: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to record lookup failure: %w", err)
+	}
+	return retryAfter, nil
+}
+
+// clearLookupFailures resets the failure count after a successful guest lookup. It returns
+// false, having written the error response, if the reset fails.
+func clearLookupFailures(w http.ResponseWriter, r *http.Request, database *sql.DB, purchaseID, failedAttempts int) bool {
+	if failedAttempts == 0 {
+		return true
+	}
+	if _, err := database.Exec(`DELETE FROM order_lookup_failures WHERE purchase_id = $1`, purchaseID); err != nil {
+		writeInternalError(w, r, "Failed to retrieve purchase", err)
+		return false
+	}
+	return true
+}
+
+// writeLookupLocked refuses an email lookup of a locked order with 429
+func writeLookupLocked(w http.ResponseWriter, r *http.Request, retryAfter int) {
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeError(w, r, http.StatusTooManyRequests, CodeTooManyRequests,
+		"Too many failed lookups for this order; try again later or use the order's lookup token")
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import "testing"
+
+func TestCountLookupFailure(t *testing.T) {
+	tests := []struct {
+		name           string
+		failedAttempts int
+		maxFailures    int
+		wantAttempts   int
+		wantLocked     bool
+	}{
+		{"first failure", 0, 5, 1, false},
+		{"below the limit", 3, 5, 4, false},
+		{"reaches the limit", 4, 5, 0, true},
+		{"already over a lowered limit", 7, 5, 0, true},
+		{"limit of one locks at once", 0, 1, 0, true},
+		{"count restarts after a lockout", 0, 3, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts, locked := countLookupFailure(tt.failedAttempts, tt.maxFailures)
+			if attempts != tt.wantAttempts || locked != tt.wantLocked {
+				t.Errorf("countLookupFailure(%d, %d) = %d, %v, want %d, %v",
+					tt.failedAttempts, tt.maxFailures, attempts, locked, tt.wantAttempts, tt.wantLocked)
+			}
+		})
+	}
+}
+
+func TestCountLookupFailureLocksEveryMaxFailures(t *testing.T) {
+	const maxFailures = 3
+	attempts, lockouts := 0, 0
+	for i := 1; i <= 9; i++ {
+		var locked bool
+		attempts, locked = countLookupFailure(attempts, maxFailures)
+		if locked {
+			lockouts++
+			if i%maxFailures != 0 {
+				t.Errorf("failure %d locked the order, want a lock every %d failures", i, maxFailures)
+			}
+		}
+	}
+	if lockouts != 3 {
+		t.Errorf("lockouts = %d, want 3", lockouts)
+	}
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"invisimart-api/db"
+	"invisimart-api/outbox"
+	"invisimart-api/payments"
+
+	"github.com/gorilla/mux"
+)
+
+// Order lifecycle statuses
+const (
+	StatusPending    = "pending"
+	StatusReview     = "review"
+	StatusPaid       = "paid"
+	StatusFulfilling = "fulfilling"
+	StatusShipped    = "shipped"
+	StatusDelivered  = "delivered"
+	StatusCancelled  = "cancelled"
+	StatusRefunded   = "refunded"
+)
+
+// statusTransitions lists the statuses each status may move to. Cancelled and refunded are terminal.
+// Orders held for fraud review leave review through the admin approve and reject endpoints; an
+// approved order waits in pending while its payment is captured.
+var statusTransitions = map[string][]string{
+	StatusPending:    {StatusPaid, StatusCancelled},
+	StatusReview:     {StatusPending, StatusPaid, StatusCancelled},
+	StatusPaid:       {StatusFulfilling, StatusCancelled, StatusRefunded},
+	StatusFulfilling: {StatusShipped, StatusCancelled, StatusRefunded},
+	StatusShipped:    {StatusDelivered, StatusRefunded},
+	StatusDelivered:  {StatusRefunded},
+	StatusCancelled:  {},
+	StatusRefunded:   {},
+}
+
+// systemActor is recorded as the actor for status changes made by the API itself
+const systemActor = "system"
+
+// StatusChange is a single entry in an order's status timeline
+type StatusChange struct {
+	FromStatus string `json:"fromStatus,omitempty"`
+	ToStatus   string `json:"toStatus"`
+	ChangedBy  string `json:"changedBy"`
+	Note       string `json:"note,omitempty"`
+	ChangedAt  string `json:"changedAt"`
+}
+
+// UpdateStatusRequest is the body of PATCH /purchase/{orderId}/status. The change is recorded
+// against the authenticated admin.
+type UpdateStatusRequest struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+// invalidTransitionError is returned when a status change is not allowed by the state machine
+type invalidTransitionError struct {
+	From string
+	To   string
+}
+
+func (e *invalidTransitionError) Error() string {
+	return fmt.Sprintf("Cannot change order status from %s to %s", e.From, e.To)
+}
+
+// isKnownStatus reports whether status is part of the order lifecycle
+func isKnownStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// canTransition reports whether an order may move from one status to another
+func canTransition(from, to string) bool {
+	for _, allowed := range statusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// lockPurchase locks a purchase row for update and returns its ID and current status
+func lockPurchase(tx *sql.Tx, orderID string) (int, string, error) {
+	var purchaseID int
+	var status string
+	err := tx.QueryRow(`SELECT id, status FROM purchases WHERE order_id = $1 FOR UPDATE`, orderID).Scan(&purchaseID, &status)
+	return purchaseID, status, err
+}
+
+// recordStatusChange appends an entry to the purchase status history
+func recordStatusChange(tx *sql.Tx, purchaseID int, from, to, changedBy, note string) error {
+	_, err := tx.Exec(`
+		INSERT INTO purchase_status_history (purchase_id, from_status, to_status, changed_by, note)
+		VALUES ($1, NULLIF($2, ''), $3, $4, NULLIF($5, ''))
+	`, purchaseID, from, to, changedBy, note)
+	if err != nil {
+		return fmt.Errorf("failed to record status change: %w", err)
+	}
+	return nil
+}
+
+// transitionStatus moves a locked purchase to a new status and records the change.
+// The caller must hold the row lock from lockPurchase.
+func transitionStatus(tx *sql.Tx, purchaseID int, from, to, changedBy, note string) error {
+	if !canTransition(from, to) {
+		return &invalidTransitionError{From: from, To: to}
+	}
+
+	var orderID string
+	err := tx.QueryRow(`
+		UPDATE purchases SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2
+		RETURNING order_id
+	`, to, purchaseID).Scan(&orderID)
+	if err != nil {
+		return fmt.Errorf("failed to update purchase status: %w", err)
+	}
+
+	if err := recordStatusChange(tx, purchaseID, from, to, changedBy, note); err != nil {
+		return err
+	}
+
+	return outbox.Write(tx, outboxOrderStatusChanged, orderID, orderStatusChangedEvent{
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		ChangedBy:  changedBy,
+		Note:       note,
+	})
+}
+
+// loadStatusTimeline returns the status history of a purchase, oldest first
+func loadStatusTimeline(database *sql.DB, purchaseID int) ([]StatusChange, error) {
+	rows, err := database.Query(`
+		SELECT COALESCE(from_status, ''), to_status, changed_by, COALESCE(note, ''), created_at
+		FROM purchase_status_history
+		WHERE purchase_id = $1
+		ORDER BY created_at, id
+	`, purchaseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query status history: %w", err)
+	}
+	defer rows.Close()
+
+	timeline := []StatusChange{}
+	for rows.Next() {
+		var change StatusChange
+		var changedAt time.Time
+		if err := rows.Scan(&change.FromStatus, &change.ToStatus, &change.ChangedBy, &change.Note, &changedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan status history: %w", err)
+		}
+		change.ChangedAt = changedAt.Format(time.RFC3339)
+		timeline = append(timeline, change)
+	}
+	return timeline, rows.Err()
+}
+
+// UpdatePurchaseStatusHandler moves an order to a new lifecycle status on behalf of an
+// authenticated admin. Cancelling and refunding restock the items and move money, so they go
+// through the cancel and refund endpoints instead.
+func UpdatePurchaseStatusHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	orderID, ok := parseOrderID(w, r, mux.Vars(r)["orderId"])
+	if !ok {
+		return
+	}
+
+	var req UpdateStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidBody(w, r, err)
+		return
+	}
+
+	if !isKnownStatus(req.Status) {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Unknown status: %s", req.Status))
+		return
+	}
+	if req.Status == StatusCancelled || req.Status == StatusRefunded {
+		writeError(w, r, http.StatusConflict, CodeInvalidStatusTransition,
+			fmt.Sprintf("Orders are %s through /purchase/{orderId}/cancel or /refund, which restock the items and return the payment", req.Status))
+		return
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to update purchase status", err)
+		return
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		writeInternalError(w, r, "Failed to update purchase status", err)
+		return
+	}
+	defer tx.Rollback()
+
+	purchaseID, current, err := lockPurchase(tx, orderID)
+	if err == sql.ErrNoRows {
+		writeNotFound(w, r, "Purchase not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, "Failed to update purchase status", err)
+		return
+	}
+
+	// Leaving review captures or voids the payment, which only the review endpoints do
+	if current == StatusReview {
+		writeError(w, r, http.StatusConflict, CodeInvalidStatusTransition,
+			"Orders held for review are approved or rejected through /admin/purchases/{orderId}/approve and /reject")
+		return
+	}
+
+	// A pending order whose payment is only authorized is still being captured, or its capture
+	// failed; marking it paid by hand would ship it without taking the money
+	if req.Status == StatusPaid {
+		payment, err := loadPaymentInfo(tx, purchaseID)
+		if err != nil {
+			writeInternalError(w, r, "Failed to update purchase status", err)
+			return
+		}
+		if payment != nil && payment.Status == payments.StatusAuthorized {
+			writeError(w, r, http.StatusConflict, CodeInvalidStatusTransition,
+				"The payment for this order has not been captured, so it cannot be marked paid")
+			return
+		}
+	}
+
+	if err := transitionStatus(tx, purchaseID, current, req.Status, admin, req.Note); err != nil {
+		var invalid *invalidTransitionError
+		if errors.As(err, &invalid) {
+			writeError(w, r, http.StatusConflict, CodeInvalidStatusTransition, err.Error())
+			return
+		}
+		writeInternalError(w, r, "Failed to update purchase status", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, r, "Failed to update purchase status", err)
+		return
+	}
+
+	log.Printf("Purchase status changed - OrderID: %s, %s -> %s, By: %s", orderID, current, req.Status, admin)
+
+	timeline, err := loadStatusTimeline(database, purchaseID)
+	if err != nil {
+		log.Printf("Failed to load status timeline: %v", err)
+	}
+
+	response := map[string]interface{}{
+		"orderId":  orderID,
+		"status":   req.Status,
+		"timeline": timeline,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"database/sql"
+	"time"
+
+	"invisimart-api/money"
+	"invisimart-api/outbox"
+	"invisimart-api/pricing"
+	"invisimart-api/validation"
+)
+
+// Outbox event types written by the purchase flow
+const (
+	outboxOrderPlaced        = "order.placed"
+	outboxOrderStatusChanged = "order.status_changed"
+)
+
+// Outbox handler names, recorded against each message as the handler succeeds
+const (
+	outboxHandlerConfirmationEmail = "confirmation_email"
+	outboxHandlerWebhooks          = "webhooks"
+)
+
+// orderPlacedEvent is the outbox payload of a new order. It carries everything its handlers
+// need, so they do not have to re-read the order. The card is stored masked.
+type orderPlacedEvent struct {
+	OrderID       string            `json:"orderId"`
+	Status        string            `json:"status"`
+	CustomerName  string            `json:"customerName"`
+	CustomerEmail string            `json:"customerEmail"`
+	MaskedCard    string            `json:"maskedCard,omitempty"`
+	Currency      string            `json:"currency"`
+	Items         []orderPlacedItem `json:"items"`
+	Pricing       pricing.Breakdown `json:"pricing"`
+	PlacedAt      time.Time         `json:"placedAt"`
+}
+
+type orderPlacedItem struct {
+	ProductID   string      `json:"productId"`
+	ProductName string      `json:"productName"`
+	Quantity    int         `json:"quantity"`
+	UnitPrice   money.Money `json:"unitPrice"`
+	Location    string      `json:"location,omitempty"`
+}
+
+// OutboxDispatchInterval is how often the outbox is polled for new events
+func OutboxDispatchInterval() time.Duration {
+	return durationFromEnv("OUTBOX_DISPATCH_INTERVAL", time.Second)
+}
+
+// OutboxRetention is how long processed outbox events are kept
+func OutboxRetention() time.Duration {
+	return durationFromEnv("OUTBOX_RETENTION", 7*24*time.Hour)
+}
+
+// RegisterOutboxHandlers subscribes the purchase side effects to their outbox events
+func RegisterOutboxHandlers() {
+	outbox.Register(outboxOrderPlaced, outboxHandlerConfirmationEmail, sendOrderConfirmation)
+	outbox.Register(outboxOrderPlaced, outboxHandlerWebhooks, publishOrderCreatedWebhook)
+	outbox.Register(outboxOrderStatusChanged, outboxHandlerWebhooks, publishStatusChangedWebhook)
+}
+
+// writeOrderPlaced records the order.placed event in the purchase transaction. items are the
+// stored order lines, each with the location it ships from.
+func writeOrderPlaced(tx *sql.Tx, orderID, status string, req PurchaseRequest, items []PurchaseItem,
+	breakdown pricing.Breakdown) error {
+	lines := make([]orderPlacedItem, 0, len(items))
+	for _, item := range items {
+		lines = append(lines, orderPlacedItem{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			Location:    item.Location,
+		})
+	}
+
+	return outbox.Write(tx, outboxOrderPlaced, orderID, orderPlacedEvent{
+		OrderID:       orderID,
+		Status:        status,
+		CustomerName:  req.CustomerName,
+		CustomerEmail: req.CustomerEmail,
+		MaskedCard:    CardSummary{Brand: validation.CardBrand(req.CreditCard), Last4: cardLast4(req.CreditCard)}.Masked(),
+		Currency:      breakdown.Total.Currency,
+		Items:         lines,
+		Pricing:       breakdown,
+		PlacedAt:      time.Now().UTC(),
+	})
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"invisimart-api/money"
+	"invisimart-api/payments"
+)
+
+// writePaymentError maps a processor failure to a response. Declines are the customer's to
+// fix; a timeout means the outcome is unknown, so the client should retry with the same
+// Idempotency-Key.
+func writePaymentError(w http.ResponseWriter, r *http.Request, err error) {
+	var paymentErr *payments.Error
+	switch {
+	case errors.As(err, &paymentErr) && paymentErr.Timeout():
+		writeError(w, r, http.StatusGatewayTimeout, CodePaymentTimeout, paymentErr.Error())
+	case errors.As(err, &paymentErr) && paymentErr.Code != payments.CodeInvalidReference:
+		problem := newProblem(r, http.StatusPaymentRequired, CodePaymentDeclined, paymentErr.Error())
+		problem.Extensions = map[string]interface{}{"declineCode": paymentErr.Code}
+		writeProblemResponse(w, problem)
+	default:
+		problem := newProblem(r, http.StatusBadGateway, CodePaymentProcessorError, "The payment could not be processed")
+		log.Printf("Payment processor error: %v (request_id=%s)", err, problem.RequestID)
+		writeProblemResponse(w, problem)
+	}
+}
+
+// releasePayment undoes a payment for an order that was not committed: an authorization is
+// voided and a capture is refunded in full. Failures are logged for manual reconciliation.
+func releasePayment(processor payments.Processor, payment *PaymentInfo, amount money.Money) {
+	var err error
+	if payment.Status == payments.StatusCaptured {
+		err = processor.Refund(payment.Reference, amount)
+	} else {
+		err = processor.Void(payment.Reference)
+	}
+	if err != nil {
+		log.Printf("Failed to release payment %s (%s) for an uncommitted order: %v", payment.Reference, payment.Status, err)
+		return
+	}
+	log.Printf("Released payment %s for an uncommitted order", payment.Reference)
+}
+
+// queryRower is satisfied by *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// loadPaymentInfo returns the payment recorded on a purchase, or nil if it has none
+func loadPaymentInfo(q queryRower, purchaseID int) (*PaymentInfo, error) {
+	var processor, reference, status sql.NullString
+	err := q.QueryRow(`
+		SELECT payment_processor, payment_reference, payment_status FROM purchases WHERE id = $1
+	`, purchaseID).Scan(&processor, &reference, &status)
+	if err != nil {
+		return nil, err
+	}
+	if !reference.Valid {
+		return nil, nil
+	}
+	return &PaymentInfo{Processor: processor.String, Reference: reference.String, Status: status.String}, nil
+}
+
+// processor returns the processor that took the payment. Captures, voids and refunds must go
+// back to it even after PAYMENT_PROCESSOR has changed.
+func (p *PaymentInfo) processor() (payments.Processor, error) {
+	return payments.ForName(p.Processor)
+}
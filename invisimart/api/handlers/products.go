@@ -3,32 +3,42 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"log"
 	"net/http"
 
 	"invisimart-api/db"
+	"invisimart-api/money"
 
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
 )
 
 type Product struct {
-	ID    string  `json:"id"`
-	Name  string  `json:"name"`
-	Image string  `json:"image"`
-	Price float64 `json:"price"`
-	Description *string `json:"description,omitempty"`
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Image       string      `json:"image"`
+	Price       money.Money `json:"price"`
+	Currency    string      `json:"currency"`
+	Description *string     `json:"description,omitempty"`
 }
 
 func ListProductsHandler(w http.ResponseWriter, r *http.Request) {
 	database, err := db.GetDB()
 	if err != nil {
-		http.Error(w, "Failed to get DB connection: "+err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, r, "Failed to retrieve products", err)
 		return
 	}
 
-	rows, err := database.Query("SELECT id, name, image, price FROM products")
+	// Prices are shown in the currency asked for with ?currency= or Accept-Currency
+	rates := newRateCache(database)
+	currency, ok := negotiateCurrency(w, r, rates)
+	if !ok {
+		return
+	}
+
+	rows, err := database.Query("SELECT id, name, image, price, currency FROM products")
 	if err != nil {
-		http.Error(w, "Failed to query products: "+err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, r, "Failed to retrieve products", err)
 		return
 	}
 	defer rows.Close()
@@ -36,17 +46,22 @@ func ListProductsHandler(w http.ResponseWriter, r *http.Request) {
 	products := []Product{}
 	for rows.Next() {
 		var p Product
-		if err := rows.Scan(&p.ID, &p.Name, &p.Image, &p.Price); err != nil {
-			http.Error(w, "Failed to scan product: "+err.Error(), http.StatusInternalServerError)
+		var listed string
+		if err := rows.Scan(&p.ID, &p.Name, &p.Image, &p.Price, &listed); err != nil {
+			writeInternalError(w, r, "Failed to retrieve products", err)
 			return
 		}
+		if p.Price, err = rates.catalogPrice(p.Price.In(listed), currency); err != nil {
+			writeInternalError(w, r, "Failed to convert product prices", err)
+			return
+		}
+		p.Currency = p.Price.Currency
 		products = append(products, p)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(products); err != nil {
-		http.Error(w, "Failed to encode products: "+err.Error(), http.StatusInternalServerError)
-		return
+		log.Printf("Failed to encode response: %v", err)
 	}
 }
 
@@ -56,30 +71,41 @@ func GetProductHandler(w http.ResponseWriter, r *http.Request) {
 	productID := vars["id"]
 
 	if productID == "" {
-		http.Error(w, "Product ID is required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Product ID is required")
 		return
 	}
 
 	database, err := db.GetDB()
 	if err != nil {
-		http.Error(w, "Failed to get DB connection: "+err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, r, "Failed to retrieve product", err)
+		return
+	}
+
+	rates := newRateCache(database)
+	currency, ok := negotiateCurrency(w, r, rates)
+	if !ok {
 		return
 	}
 
 	var p Product
-	err = database.QueryRow("SELECT id, name, image, price FROM products WHERE id = $1", productID).Scan(&p.ID, &p.Name, &p.Image, &p.Price)
+	var listed string
+	err = database.QueryRow("SELECT id, name, image, price, currency FROM products WHERE id = $1", productID).Scan(&p.ID, &p.Name, &p.Image, &p.Price, &listed)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			http.Error(w, "Product not found", http.StatusNotFound)
+			writeNotFound(w, r, "Product not found")
 			return
 		}
-		http.Error(w, "Failed to query product: "+err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, r, "Failed to retrieve product", err)
 		return
 	}
+	if p.Price, err = rates.catalogPrice(p.Price.In(listed), currency); err != nil {
+		writeInternalError(w, r, "Failed to convert product price", err)
+		return
+	}
+	p.Currency = p.Price.Currency
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(p); err != nil {
-		http.Error(w, "Failed to encode product: "+err.Error(), http.StatusInternalServerError)
-		return
+		log.Printf("Failed to encode response: %v", err)
 	}
 }
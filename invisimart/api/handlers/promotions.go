@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"invisimart-api/db"
+	"invisimart-api/money"
+	"invisimart-api/pricing"
+	"invisimart-api/promotions"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// promotionColumns is the column list read by scanPromotion
+const promotionColumns = `id, code, COALESCE(description, ''), discount_type, percent_off, amount_off,
+	COALESCE(buy_quantity, 0), COALESCE(get_quantity, 0), starts_at, ends_at,
+	max_redemptions, max_redemptions_per_customer, product_ids, categories,
+	active, redemption_count, created_at, updated_at`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPromotion reads a promotion selected with promotionColumns
+func scanPromotion(row rowScanner) (*promotions.Promotion, error) {
+	var p promotions.Promotion
+	var percentOff sql.NullString
+	var startsAt, endsAt sql.NullTime
+	var maxRedemptions, maxPerCustomer sql.NullInt64
+	var createdAt, updatedAt time.Time
+
+	err := row.Scan(&p.ID, &p.Code, &p.Description, &p.Type, &percentOff, &p.AmountOff,
+		&p.BuyQuantity, &p.GetQuantity, &startsAt, &endsAt,
+		&maxRedemptions, &maxPerCustomer, pq.Array(&p.ProductIDs), pq.Array(&p.Categories),
+		&p.Active, &p.RedemptionCount, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	p.PercentOff = percentOff.String
+	if startsAt.Valid {
+		p.StartsAt = &startsAt.Time
+	}
+	if endsAt.Valid {
+		p.EndsAt = &endsAt.Time
+	}
+	if maxRedemptions.Valid {
+		limit := int(maxRedemptions.Int64)
+		p.MaxRedemptions = &limit
+	}
+	if maxPerCustomer.Valid {
+		limit := int(maxPerCustomer.Int64)
+		p.MaxRedemptionsPerCustomer = &limit
+	}
+	if p.ProductIDs == nil {
+		p.ProductIDs = []string{}
+	}
+	if p.Categories == nil {
+		p.Categories = []string{}
+	}
+	p.CreatedAt = createdAt.Format(time.RFC3339)
+	p.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &p, nil
+}
+
+// applyPromotion validates a promo code inside the purchase transaction and computes its
+// discount. The promotion row is locked so concurrent orders cannot exceed its usage limits.
+func applyPromotion(tx *sql.Tx, code, customerEmail string, lines []pricing.Line) (*promotions.Promotion, pricing.Discount, error) {
+	return promotions.Redeem(promotionTx{tx}, code, customerEmail, lines, time.Now())
+}
+
+// promotionTx reads promotions for redemption inside a purchase transaction
+type promotionTx struct {
+	tx *sql.Tx
+}
+
+// LockPromotion loads a promotion by code and locks its row until the transaction ends
+func (p promotionTx) LockPromotion(code string) (*promotions.Promotion, error) {
+	promo, err := scanPromotion(p.tx.QueryRow(`
+		SELECT `+promotionColumns+` FROM promotions WHERE code = $1 FOR UPDATE
+	`, code))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return promo, err
+}
+
+// CountRedemptions counts a customer's past redemptions of a promotion
+func (p promotionTx) CountRedemptions(promotionID int, email string) (int, error) {
+	var count int
+	err := p.tx.QueryRow(`
+		SELECT COUNT(*) FROM promotion_redemptions
+		WHERE promotion_id = $1 AND LOWER(customer_email) = LOWER($2)
+	`, promotionID, email).Scan(&count)
+	return count, err
+}
+
+// recordRedemption stores that an order used a promotion and bumps its usage count
+func recordRedemption(tx *sql.Tx, promo *promotions.Promotion, purchaseID int, customerEmail string, amount money.Money) error {
+	_, err := tx.Exec(`
+		INSERT INTO promotion_redemptions (promotion_id, purchase_id, customer_email, discount_amount)
+		VALUES ($1, $2, $3, $4)
+	`, promo.ID, purchaseID, customerEmail, amount)
+	if err != nil {
+		return fmt.Errorf("failed to record promotion redemption: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE promotions SET redemption_count = redemption_count + 1 WHERE id = $1
+	`, promo.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update promotion usage: %w", err)
+	}
+	return nil
+}
+
+// ListPromotionsHandler returns every promotion, newest first
+func ListPromotionsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to list promotions", err)
+		return
+	}
+
+	rows, err := database.Query(`SELECT ` + promotionColumns + ` FROM promotions ORDER BY created_at DESC, id DESC`)
+	if err != nil {
+		writeInternalError(w, r, "Failed to list promotions", err)
+		return
+	}
+	defer rows.Close()
+
+	list := []*promotions.Promotion{}
+	for rows.Next() {
+		promo, err := scanPromotion(rows)
+		if err != nil {
+			writeInternalError(w, r, "Failed to list promotions", err)
+			return
+		}
+		list = append(list, promo)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// GetPromotionHandler returns a single promotion by ID
+func GetPromotionHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid promotion ID")
+		return
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to retrieve promotion", err)
+		return
+	}
+
+	promo, err := scanPromotion(database.QueryRow(`SELECT `+promotionColumns+` FROM promotions WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		writeNotFound(w, r, "Promotion not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, "Failed to retrieve promotion", err)
+		return
+	}
+
+	writePromotion(w, http.StatusOK, promo)
+}
+
+// CreatePromotionHandler creates a promotion
+func CreatePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	promo, ok := decodePromotion(w, r)
+	if !ok {
+		return
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to create promotion", err)
+		return
+	}
+
+	created, err := scanPromotion(database.QueryRow(`
+		INSERT INTO promotions (code, description, discount_type, percent_off, amount_off, buy_quantity, get_quantity,
+			starts_at, ends_at, max_redemptions, max_redemptions_per_customer, product_ids, categories, active)
+		VALUES ($1, NULLIF($2, ''), $3, NULLIF($4, '')::NUMERIC, $5, NULLIF($6, 0), NULLIF($7, 0),
+			$8, $9, $10, $11, $12, $13, $14)
+		RETURNING `+promotionColumns,
+		promotionArgs(promo)...))
+	if err != nil {
+		if isUniqueViolation(err) {
+			writeError(w, r, http.StatusConflict, CodeConflict, fmt.Sprintf("Promotion code %s already exists", promo.Code))
+			return
+		}
+		writeInternalError(w, r, "Failed to create promotion", err)
+		return
+	}
+
+	log.Printf("Promotion created - Code: %s, Type: %s", created.Code, created.Type)
+	writePromotion(w, http.StatusCreated, created)
+}
+
+// UpdatePromotionHandler replaces a promotion's definition. Usage counts are kept.
+func UpdatePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid promotion ID")
+		return
+	}
+
+	promo, ok := decodePromotion(w, r)
+	if !ok {
+		return
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to update promotion", err)
+		return
+	}
+
+	args := append(promotionArgs(promo), id)
+	updated, err := scanPromotion(database.QueryRow(`
+		UPDATE promotions
+		SET code = $1, description = NULLIF($2, ''), discount_type = $3, percent_off = NULLIF($4, '')::NUMERIC,
+			amount_off = $5, buy_quantity = NULLIF($6, 0), get_quantity = NULLIF($7, 0),
+			starts_at = $8, ends_at = $9, max_redemptions = $10, max_redemptions_per_customer = $11,
+			product_ids = $12, categories = $13, active = $14, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $15
+		RETURNING `+promotionColumns,
+		args...))
+	if err == sql.ErrNoRows {
+		writeNotFound(w, r, "Promotion not found")
+		return
+	}
+	if err != nil {
+		if isUniqueViolation(err) {
+			writeError(w, r, http.StatusConflict, CodeConflict, fmt.Sprintf("Promotion code %s already exists", promo.Code))
+			return
+		}
+		writeInternalError(w, r, "Failed to update promotion", err)
+		return
+	}
+
+	log.Printf("Promotion updated - Code: %s", updated.Code)
+	writePromotion(w, http.StatusOK, updated)
+}
+
+// DeletePromotionHandler deletes a promotion that has never been used, or deactivates it
+// otherwise so redemption history is preserved
+func DeletePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid promotion ID")
+		return
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to delete promotion", err)
+		return
+	}
+
+	result, err := database.Exec(`DELETE FROM promotions WHERE id = $1 AND redemption_count = 0`, id)
+	if err != nil {
+		writeInternalError(w, r, "Failed to delete promotion", err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 1 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	result, err = database.Exec(`
+		UPDATE promotions SET active = FALSE, updated_at = CURRENT_TIMESTAMP WHERE id = $1
+	`, id)
+	if err != nil {
+		writeInternalError(w, r, "Failed to delete promotion", err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		writeNotFound(w, r, "Promotion not found")
+		return
+	}
+
+	// The promotion has redemptions, so it was deactivated instead of deleted
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodePromotion reads and validates a promotion from the request body, writing a 400 on failure
+func decodePromotion(w http.ResponseWriter, r *http.Request) (*promotions.Promotion, bool) {
+	var promo promotions.Promotion
+	promo.Active = true
+	if err := json.NewDecoder(r.Body).Decode(&promo); err != nil {
+		writeInvalidBody(w, r, err)
+		return nil, false
+	}
+	if err := promo.Validate(); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid promotion: "+err.Error())
+		return nil, false
+	}
+
+	if promo.ProductIDs == nil {
+		promo.ProductIDs = []string{}
+	}
+	for i, category := range promo.Categories {
+		promo.Categories[i] = strings.TrimSpace(category)
+	}
+	if promo.Categories == nil {
+		promo.Categories = []string{}
+	}
+	return &promo, true
+}
+
+// promotionArgs returns the positional arguments shared by the insert and update statements
+func promotionArgs(p *promotions.Promotion) []interface{} {
+	var amountOff interface{}
+	if p.Type == promotions.TypeFixed {
+		amountOff = p.AmountOff
+	}
+	return []interface{}{
+		p.Code, p.Description, p.Type, p.PercentOff, amountOff, p.BuyQuantity, p.GetQuantity,
+		p.StartsAt, p.EndsAt, p.MaxRedemptions, p.MaxRedemptionsPerCustomer,
+		pq.Array(p.ProductIDs), pq.Array(p.Categories), p.Active,
+	}
+}
+
+func writePromotion(w http.ResponseWriter, status int, promo *promotions.Promotion) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(promo); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// isUniqueViolation reports whether err is a Postgres unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
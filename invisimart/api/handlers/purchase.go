@@ -3,79 +3,219 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
 
 	"invisimart-api/db"
+	"invisimart-api/fraud"
+	"invisimart-api/money"
+	"invisimart-api/ordertoken"
+	"invisimart-api/payments"
+	"invisimart-api/pricing"
+	"invisimart-api/promotions"
+	"invisimart-api/validation"
 	"invisimart-api/vault"
-
-	"github.com/google/uuid"
 )
 
+// transitKey is the Vault Transit key that encrypts customer phone and card numbers
+const transitKey = "invisimart-key"
+
 // PurchaseRequest represents the incoming purchase request from the frontend
 type PurchaseRequest struct {
-	CustomerName    string        `json:"customerName"`
-	CustomerEmail   string        `json:"customerEmail"`
-	CustomerPhone   string        `json:"customerPhone"`
-	CreditCard      string        `json:"creditCard"`
-	BillingAddress  string        `json:"billingAddress"`
+	CustomerName    string         `json:"customerName"`
+	CustomerEmail   string         `json:"customerEmail"`
+	CustomerPhone   string         `json:"customerPhone"`
+	CreditCard      string         `json:"creditCard"`
+	CardExpiryMonth int            `json:"cardExpiryMonth,omitempty"`
+	CardExpiryYear  int            `json:"cardExpiryYear,omitempty"`
+	BillingAddress  string         `json:"billingAddress"`
+	Location        string         `json:"location,omitempty"`
+	PromoCode       string         `json:"promoCode,omitempty"`
+	Currency        string         `json:"currency,omitempty"`
 	Items           []PurchaseItem `json:"items"`
 }
 
 // PurchaseItem represents a single item in the purchase
 type PurchaseItem struct {
-	ProductID   string  `json:"productId"`
-	ProductName string  `json:"productName"`
-	Quantity    int     `json:"quantity"`
-	UnitPrice   float64 `json:"unitPrice"`
+	ProductID   string      `json:"productId"`
+	ProductName string      `json:"productName"`
+	Quantity    int         `json:"quantity"`
+	UnitPrice   money.Money `json:"unitPrice"`
+	Location    string      `json:"location,omitempty"`
+	WeightGrams int         `json:"-"`
+	Category    string      `json:"-"`
 }
 
-// PurchaseResponse represents the response sent back to the frontend
+// PurchaseResponse represents the response sent back to the frontend. LookupToken lets the
+// customer look the order up again without re-entering their email address. ExchangeRate is
+// set when the order is in a currency other than the base currency.
 type PurchaseResponse struct {
-	OrderID   string  `json:"orderId"`
-	Status    string  `json:"status"`
-	Message   string  `json:"message"`
-	Total     float64 `json:"total"`
-	Timestamp string  `json:"timestamp"`
+	OrderID              string            `json:"orderId"`
+	Status               string            `json:"status"`
+	Message              string            `json:"message"`
+	Total                money.Money       `json:"total"`
+	Currency             string            `json:"currency"`
+	ExchangeRate         *ExchangeRateInfo `json:"exchangeRate,omitempty"`
+	Pricing              pricing.Breakdown `json:"pricing"`
+	Payment              *PaymentInfo      `json:"payment,omitempty"`
+	LookupToken          string            `json:"lookupToken"`
+	LookupTokenExpiresAt string            `json:"lookupTokenExpiresAt"`
+	Timestamp            string            `json:"timestamp"`
+}
+
+// PaymentInfo is the processor's record of how an order was paid. Orders with a zero total
+// and orders placed before payment processing have none.
+type PaymentInfo struct {
+	Processor string `json:"processor"`
+	Reference string `json:"reference"`
+	Status    string `json:"status"`
+}
+
+// unknownProductError is returned when a purchase references a product that is not in the catalog
+type unknownProductError struct {
+	ProductID string
+}
+
+func (e *unknownProductError) Error() string {
+	return fmt.Sprintf("Unknown product: %s", e.ProductID)
 }
 
+// priceMismatchError is returned when the client quoted a price that differs from the catalog price
+type priceMismatchError struct {
+	ProductID string
+	Quoted    money.Money
+	Catalog   money.Money
+}
+
+func (e *priceMismatchError) Error() string {
+	return fmt.Sprintf("Price mismatch for product %s: quoted %s, current price is %s",
+		e.ProductID, e.Quoted.Decimal(), e.Catalog.Decimal())
+}
+
+// priceItems loads each requested product from the catalog inside the given transaction and
+// returns the items with the catalog name and unit price in the base currency. A quoted unit
+// price of zero means the client did not quote one; any other value is in the order currency
+// and must match the catalog price converted at orderRate to the cent.
+func priceItems(tx *sql.Tx, requested []PurchaseItem, orderRate money.Rate) ([]PurchaseItem, error) {
+	rates := newRateCache(tx)
+	items := make([]PurchaseItem, 0, len(requested))
+	for _, item := range requested {
+		var name, currency string
+		var listed money.Money
+		var weightGrams int
+		var category sql.NullString
+		err := tx.QueryRow(`SELECT name, price, currency, weight_grams, category FROM products WHERE product_id = $1`,
+			item.ProductID).Scan(&name, &listed, &currency, &weightGrams, &category)
+		if err == sql.ErrNoRows {
+			return nil, &unknownProductError{ProductID: item.ProductID}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load product %s: %w", item.ProductID, err)
+		}
+
+		price, err := rates.basePrice(listed.In(currency))
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert price of product %s: %w", item.ProductID, err)
+		}
+
+		if !item.UnitPrice.IsZero() {
+			quoted, catalog := item.UnitPrice.In(orderRate.To), orderRate.Convert(price)
+			if !quoted.Equal(catalog) {
+				return nil, &priceMismatchError{ProductID: item.ProductID, Quoted: quoted, Catalog: catalog}
+			}
+		}
+
+		items = append(items, PurchaseItem{
+			ProductID:   item.ProductID,
+			ProductName: name,
+			Quantity:    item.Quantity,
+			UnitPrice:   price,
+			WeightGrams: weightGrams,
+			Category:    category.String,
+		})
+	}
+	return items, nil
+}
+
+// conflictError is returned by a purchaseHook when the order conflicts with the current state
+// of the resource it was created from
+type conflictError struct {
+	Message string
+}
+
+func (e *conflictError) Error() string {
+	return e.Message
+}
+
+// purchaseHook runs inside the purchase transaction after the order and its items are written.
+// Returning an error rolls the whole purchase back.
+type purchaseHook func(tx *sql.Tx, purchaseID int, orderID string) error
+
 // CreatePurchaseHandler handles purchase requests with Vault integration
 func CreatePurchaseHandler(w http.ResponseWriter, r *http.Request) {
 	var req PurchaseRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeInvalidBody(w, r, err)
 		return
 	}
 
-	// Validate request
-	if req.CustomerName == "" || req.CustomerEmail == "" || req.CustomerPhone == "" || req.CreditCard == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+	processPurchase(w, r, req, nil)
+}
+
+// processPurchase validates, prices, reserves and stores a purchase and writes the response.
+// It is shared by POST /purchase and cart checkout; onCreate, if set, runs in the same
+// transaction once the order has been written.
+func processPurchase(w http.ResponseWriter, r *http.Request, req PurchaseRequest, onCreate purchaseHook) {
+	// Validate every field and normalize the email, phone and card number
+	if errs := validatePurchaseRequest(&req); len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
 		return
 	}
 
-	if len(req.Items) == 0 {
-		http.Error(w, "No items in purchase", http.StatusBadRequest)
+	// Get database connection
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to process purchase", err)
 		return
 	}
 
-	// Calculate total amount
-	var totalAmount float64
-	for _, item := range req.Items {
-		totalAmount += item.UnitPrice * float64(item.Quantity)
-	}
+	// Replay the original response if this request is a retry of one that already succeeded
+	idempotencyKey := r.Header.Get(idempotencyKeyHeader)
+	var fingerprint string
+	if idempotencyKey != "" {
+		if len(idempotencyKey) > maxIdempotencyKeyLength {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest,
+				fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength))
+			return
+		}
 
-	// Generate unique order ID
-	orderID := fmt.Sprintf("INV-%s", uuid.New().String()[:8])
+		fingerprint, err = requestFingerprint(req)
+		if err != nil {
+			writeInternalError(w, r, "Failed to process Idempotency-Key", err)
+			return
+		}
+
+		stored, err := lookupIdempotencyKey(database, idempotencyKey)
+		if err != nil {
+			writeInternalError(w, r, "Failed to process Idempotency-Key", err)
+			return
+		}
+		if stored != nil {
+			writeIdempotentReplay(w, r, stored, fingerprint)
+			return
+		}
+	}
 
 	// Encrypt sensitive data using Vault Transit engine (or mock if unavailable)
 	var encryptedPhone, encryptedCard string
-	
+
 	if vault.IsAvailable() {
 		// Use real Vault encryption
 		var err error
-		encryptedPhone, err = vault.EncryptData("invisimart-key", req.CustomerPhone)
+		encryptedPhone, err = vault.EncryptData(transitKey, req.CustomerPhone)
 		if err != nil {
 			log.Printf("Failed to encrypt phone number with Vault: %v", err)
 			// Fallback to mock encryption
@@ -83,7 +223,7 @@ func CreatePurchaseHandler(w http.ResponseWriter, r *http.Request) {
 			log.Printf("Using mock encryption for phone number")
 		}
 
-		encryptedCard, err = vault.EncryptData("invisimart-key", req.CreditCard)
+		encryptedCard, err = vault.EncryptData(transitKey, req.CreditCard)
 		if err != nil {
 			log.Printf("Failed to encrypt credit card with Vault: %v", err)
 			// Fallback to mock encryption
@@ -97,94 +237,512 @@ func CreatePurchaseHandler(w http.ResponseWriter, r *http.Request) {
 		encryptedCard = vault.MockEncrypt(req.CreditCard)
 	}
 
-	// Get database connection
-	database, err := db.GetDB()
+	// Price the order and hold its total on the card before the purchase transaction takes any
+	// locks, so gateway latency never holds up other checkouts of the same products. The order
+	// is priced again under the locks and must come to the same total.
+	quoteTx, err := database.Begin()
+	if err != nil {
+		writeInternalError(w, r, "Failed to process purchase", err)
+		return
+	}
+	quote, err := pricePurchase(quoteTx, req)
+	quoteTx.Rollback()
 	if err != nil {
-		log.Printf("Failed to get DB connection: %v", err)
-		http.Error(w, fmt.Sprintf("Database connection error: %v", err), http.StatusInternalServerError)
+		writePricingError(w, r, err)
 		return
 	}
+	totalAmount := quote.Breakdown.Total
+
+	// The card is authorized under the order's ID, so it is chosen before the transaction
+	orderID, err := newOrderID(database)
+	if err != nil {
+		writeInternalError(w, r, "Failed to save purchase", err)
+		return
+	}
+
+	// Until the order commits, the deferred release voids the authorization on every error path
+	processor := payments.Current()
+	var payment *PaymentInfo
+	var cardCountry string
+	committed := false
+	if totalAmount.Minor > 0 {
+		auth, err := processor.Authorize(payments.AuthorizationRequest{
+			OrderID:    orderID,
+			CardNumber: req.CreditCard,
+			Amount:     totalAmount,
+		})
+		if err != nil {
+			writePaymentError(w, r, err)
+			return
+		}
+		payment = &PaymentInfo{Processor: auth.Processor, Reference: auth.Reference, Status: auth.Status}
+		cardCountry = auth.CardCountry
+		defer func() {
+			if !committed {
+				releasePayment(processor, payment, totalAmount)
+			}
+		}()
+	}
 
 	// Start transaction
 	tx, err := database.Begin()
 	if err != nil {
-		log.Printf("Failed to begin transaction: %v", err)
-		http.Error(w, fmt.Sprintf("Transaction error: %v", err), http.StatusInternalServerError)
+		writeInternalError(w, r, "Failed to process purchase", err)
 		return
 	}
 	defer tx.Rollback()
 
+	if idempotencyKey != "" {
+		claimed, err := claimIdempotencyKey(tx, idempotencyKey, fingerprint, idempotencyKeyTTL())
+		if err != nil {
+			writeInternalError(w, r, "Failed to process Idempotency-Key", err)
+			return
+		}
+		if !claimed {
+			// A concurrent request with the same key committed first; replay its response
+			tx.Rollback()
+			stored, err := lookupIdempotencyKey(database, idempotencyKey)
+			if err != nil || stored == nil {
+				writeError(w, r, http.StatusConflict, CodeIdempotencyKeyInProgress,
+					"A request with this Idempotency-Key is already in progress")
+				return
+			}
+			writeIdempotentReplay(w, r, stored, fingerprint)
+			return
+		}
+	}
+
+	// Price every line again, now with the promotion locked so concurrent orders cannot exceed
+	// its usage limits
+	priced, err := pricePurchase(tx, req)
+	if err != nil {
+		writePricingError(w, r, err)
+		return
+	}
+	if !priced.Breakdown.Total.Equal(totalAmount) {
+		writeError(w, r, http.StatusConflict, CodePriceMismatch,
+			fmt.Sprintf("The order total changed from %s to %s while it was being placed; review the order and try again",
+				totalAmount, priced.Breakdown.Total))
+		return
+	}
+	orderRate, items, breakdown := priced.Rate, priced.Items, priced.Breakdown
+
+	// Reserve stock for every line before anything is written, from the locations the
+	// fulfillment policy picks
+	allocation, err := reserveStock(tx, items, req.Location, req.BillingAddress)
+	if err != nil {
+		var shortage *insufficientStockError
+		if errors.As(err, &shortage) {
+			problem := newProblem(r, http.StatusConflict, CodeInsufficientStock, err.Error())
+			problem.Extensions = map[string]interface{}{"items": shortage.Items}
+			writeProblemResponse(w, problem)
+			return
+		}
+		writeInternalError(w, r, "Failed to reserve stock", err)
+		return
+	}
+
+	taxLines, err := json.Marshal(breakdown.TaxLines)
+	if err != nil {
+		writeInternalError(w, r, "Failed to price purchase", err)
+		return
+	}
+
+	// Score the order against the fraud rules. An order that scores too high is held for
+	// review: its card is authorized but not captured until an admin approves it.
+	screened := fraud.Order{
+		Email:           req.CustomerEmail,
+		PhoneHash:       fraud.Hash(fraudHashPhone, req.CustomerPhone),
+		CardFingerprint: fraud.Hash(fraudHashCard, req.CreditCard),
+		CardCountry:     cardCountry,
+		ClientIP:        clientIP(r),
+		Total:           priced.BaseBreakdown.Total,
+		BillingAddress:  req.BillingAddress,
+	}
+	assessment, err := screenPurchase(tx, screened)
+	if err != nil {
+		writeInternalError(w, r, "Failed to screen purchase", err)
+		return
+	}
+	fraudSignals, err := json.Marshal(assessment.Signals)
+	if err != nil {
+		writeInternalError(w, r, "Failed to screen purchase", err)
+		return
+	}
+	status, statusNote := StatusPaid, "Order placed"
+	if assessment.Review() {
+		status = StatusReview
+		statusNote = fmt.Sprintf("Order placed and held for fraud review (score %d, threshold %d)",
+			assessment.Score, assessment.Threshold)
+	}
+
+	// An order to be paid is stored as pending and captured once this transaction has
+	// committed and released its locks
+	capture := payment != nil && status == StatusPaid
+	storedStatus := status
+	if capture {
+		storedStatus, statusNote = StatusPending, "Order placed; capturing payment"
+	}
+
 	// Insert purchase record with encrypted sensitive data
 	var purchaseID int
 	err = tx.QueryRow(`
-		INSERT INTO purchases (order_id, customer_name, customer_email, customer_phone_encrypted, 
-			credit_card_encrypted, billing_address, total_amount, status)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO purchases (order_id, customer_name, customer_email, customer_phone_encrypted,
+			credit_card_encrypted, billing_address, total_amount, status,
+			subtotal_amount, shipping_amount, shipping_method, tax_amount, tax_region, tax_lines,
+			promo_code, discount_amount, card_brand, card_last4, card_exp_month, card_exp_year,
+			customer_phone_hash, card_fingerprint, client_ip, fraud_score, fraud_signals,
+			currency, base_currency, exchange_rate, exchange_rate_id, exchange_rate_effective_from)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NULLIF($13, ''), $14, NULLIF($15, ''), $16,
+			NULLIF($17, ''), NULLIF($18, ''), NULLIF($19, 0), NULLIF($20, 0),
+			NULLIF($21, ''), NULLIF($22, ''), NULLIF($23, ''), $24, $25,
+			$26, $27, $28, NULLIF($29, 0), $30)
 		RETURNING id
-	`, orderID, req.CustomerName, req.CustomerEmail, encryptedPhone, encryptedCard, 
-		req.BillingAddress, totalAmount, "completed").Scan(&purchaseID)
+	`, orderID, req.CustomerName, req.CustomerEmail, encryptedPhone, encryptedCard,
+		req.BillingAddress, totalAmount, storedStatus,
+		breakdown.Subtotal, breakdown.Shipping, breakdown.ShippingMethod, breakdown.Tax,
+		breakdown.TaxRegion, string(taxLines), breakdown.PromoCode, breakdown.Discount,
+		validation.CardBrand(req.CreditCard), cardLast4(req.CreditCard),
+		req.CardExpiryMonth, req.CardExpiryYear,
+		screened.PhoneHash, screened.CardFingerprint, screened.ClientIP, assessment.Score, string(fraudSignals),
+		orderRate.To, orderRate.From, orderRate.String(), orderRate.ID,
+		sql.NullTime{Time: orderRate.EffectiveFrom, Valid: orderRate.ID != 0}).Scan(&purchaseID)
 	if err != nil {
-		log.Printf("Failed to insert purchase: %v", err)
-		http.Error(w, fmt.Sprintf("Database insert error: %v", err), http.StatusInternalServerError)
+		writeInternalError(w, r, "Failed to save purchase", err)
 		return
 	}
 
-	// Insert purchase items
-	for _, item := range req.Items {
-		subtotal := item.UnitPrice * float64(item.Quantity)
+	if payment != nil {
 		_, err = tx.Exec(`
-			INSERT INTO purchase_items (purchase_id, product_id, product_name, quantity, unit_price, subtotal)
-			VALUES ($1, $2, $3, $4, $5, $6)
-		`, purchaseID, item.ProductID, item.ProductName, item.Quantity, item.UnitPrice, subtotal)
+			UPDATE purchases SET payment_processor = $1, payment_reference = $2, payment_status = $3 WHERE id = $4
+		`, payment.Processor, payment.Reference, payment.Status, purchaseID)
+		if err != nil {
+			writeInternalError(w, r, "Failed to record payment", err)
+			return
+		}
+	}
+
+	if err := recordStatusChange(tx, purchaseID, "", storedStatus, systemActor, statusNote); err != nil {
+		writeInternalError(w, r, "Failed to record purchase status", err)
+		return
+	}
+
+	if priced.Promo != nil {
+		if err := recordRedemption(tx, priced.Promo, purchaseID, req.CustomerEmail, priced.BaseBreakdown.Discount); err != nil {
+			writeInternalError(w, r, "Failed to apply promo code", err)
+			return
+		}
+	}
+
+	// Insert purchase items, one row per product and location it ships from
+	placed := splitItems(items, allocation)
+	itemIDs := make(map[fulfillmentKey]int, len(placed))
+	for _, item := range placed {
+		var itemID int
+		subtotal := item.UnitPrice.Mul(int64(item.Quantity))
+		err = tx.QueryRow(`
+			INSERT INTO purchase_items (purchase_id, product_id, product_name, quantity, unit_price, subtotal, location)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id
+		`, purchaseID, item.ProductID, item.ProductName, item.Quantity, item.UnitPrice, subtotal, item.Location).Scan(&itemID)
+		if err != nil {
+			writeInternalError(w, r, "Failed to save purchase items", err)
+			return
+		}
+		itemIDs[fulfillmentKey{Location: item.Location, ProductID: item.ProductID}] = itemID
+	}
+
+	if err := recordFulfillments(tx, purchaseID, allocation, itemIDs); err != nil {
+		writeInternalError(w, r, "Failed to save fulfillment", err)
+		return
+	}
+
+	if onCreate != nil {
+		if err := onCreate(tx, purchaseID, orderID); err != nil {
+			var conflict *conflictError
+			if errors.As(err, &conflict) {
+				writeError(w, r, http.StatusConflict, CodeConflict, err.Error())
+				return
+			}
+			writeInternalError(w, r, "Failed to complete purchase", err)
+			return
+		}
+	}
+
+	// complete announces the order and stores the response against the idempotency key. It runs
+	// in the transaction that gives the order its final status: this one, or the one that
+	// records the capture.
+	complete := func(tx *sql.Tx) ([]byte, error) {
+		// Side effects such as the confirmation email and webhooks run from the outbox once this commits
+		if err := writeOrderPlaced(tx, orderID, status, req, placed, breakdown); err != nil {
+			return nil, fmt.Errorf("failed to record order event: %w", err)
+		}
+
+		now := time.Now()
+		lookupToken, lookupExpires, err := ordertoken.Issue(orderID, now)
 		if err != nil {
-			log.Printf("Failed to insert purchase item: %v", err)
-			http.Error(w, fmt.Sprintf("Failed to insert purchase item: %v", err), http.StatusInternalServerError)
+			return nil, fmt.Errorf("failed to issue lookup token: %w", err)
+		}
+		message := "Purchase completed successfully"
+		if status == StatusReview {
+			message = "Purchase received and is being reviewed; the card has not been charged yet"
+		}
+		body, err := json.Marshal(PurchaseResponse{
+			OrderID:              orderID,
+			Status:               status,
+			Message:              message,
+			Total:                totalAmount,
+			Currency:             totalAmount.Currency,
+			ExchangeRate:         orderRate.info(),
+			Pricing:              breakdown,
+			Payment:              payment,
+			LookupToken:          lookupToken,
+			LookupTokenExpiresAt: lookupExpires.UTC().Format(time.RFC3339),
+			Timestamp:            now.Format(time.RFC3339),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode response: %w", err)
+		}
+
+		if idempotencyKey != "" {
+			if err := saveIdempotentResponse(tx, idempotencyKey, orderID, http.StatusCreated, body); err != nil {
+				return nil, err
+			}
+		}
+		return body, nil
+	}
+
+	var body []byte
+	if !capture {
+		if body, err = complete(tx); err != nil {
+			writeInternalError(w, r, "Failed to save purchase", err)
 			return
 		}
 	}
 
+	// Number the invoice last: the counter stays locked until commit, and a rollback releases
+	// the number unused, so invoice numbers have no gaps
+	if _, err := allocateInvoiceNumber(tx, purchaseID); err != nil {
+		writeInternalError(w, r, "Failed to save purchase", err)
+		return
+	}
+
 	// Commit transaction
 	if err = tx.Commit(); err != nil {
-		log.Printf("Failed to commit transaction: %v", err)
-		http.Error(w, fmt.Sprintf("Transaction commit error: %v", err), http.StatusInternalServerError)
+		writeInternalError(w, r, "Failed to save purchase", err)
 		return
 	}
+	committed = true
 
-	// Log successful purchase (without sensitive data)
-	log.Printf("Purchase created successfully - OrderID: %s, Customer: %s, Total: $%.2f, Items: %d",
-		orderID, req.CustomerName, totalAmount, len(req.Items))
+	if capture {
+		if err := processor.Capture(payment.Reference, totalAmount); err != nil {
+			abandonPurchase(database, orderID, idempotencyKey, err)
+			writePaymentError(w, r, err)
+			return
+		}
+		payment.Status = payments.StatusCaptured
+		if body, err = recordCapture(database, purchaseID, complete); err != nil {
+			log.Printf("Payment %s for order %s was captured but could not be recorded; reconcile it manually",
+				payment.Reference, orderID)
+			writeInternalError(w, r, "Failed to save purchase", err)
+			return
+		}
+	}
 
-	// Return response
-	response := PurchaseResponse{
-		OrderID:   orderID,
-		Status:    "completed",
-		Message:   "Purchase completed successfully",
-		Total:     totalAmount,
-		Timestamp: time.Now().Format(time.RFC3339),
+	// Log successful purchase (without sensitive data)
+	log.Printf("Purchase created successfully - OrderID: %s, Customer: %s, Total: %s, Items: %d",
+		orderID, req.CustomerName, totalAmount, len(items))
+	if status == StatusReview {
+		log.Printf("Purchase %s held for fraud review - Score: %d, Signals: %s", orderID, assessment.Score, fraudSignals)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Failed to encode response: %v", err)
+	w.Write(body)
+}
+
+// recordCapture moves an order placed as pending to paid once its payment has been captured,
+// and completes it
+func recordCapture(database *sql.DB, purchaseID int, complete func(tx *sql.Tx) ([]byte, error)) ([]byte, error) {
+	tx, err := database.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE purchases SET status = $1, payment_status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3
+	`, StatusPaid, payments.StatusCaptured, purchaseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record capture: %w", err)
 	}
+	if err := recordStatusChange(tx, purchaseID, StatusPending, StatusPaid, systemActor, "Payment captured"); err != nil {
+		return nil, err
+	}
+
+	body, err := complete(tx)
+	if err != nil {
+		return nil, err
+	}
+	return body, tx.Commit()
 }
 
-// GetPurchaseHandler retrieves a purchase by order ID
+// abandonPurchase cancels an order whose payment could not be captured after it was placed:
+// its stock is returned and the authorization voided, as for any cancellation. The
+// idempotency key is released so the customer can retry.
+func abandonPurchase(database *sql.DB, orderID, idempotencyKey string, cause error) {
+	var purchaseID int
+	var adjustment *AdjustmentResponse
+	err := func() error {
+		tx, err := database.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		var status string
+		purchaseID, status, err = lockPurchase(tx, orderID)
+		if err != nil {
+			return err
+		}
+		adjustment, err = applyAdjustment(tx, purchaseID, orderID, status, AdjustmentCancel, AdjustmentRequest{
+			Reason:    "Payment capture failed: " + cause.Error(),
+			ChangedBy: systemActor,
+		})
+		if err != nil {
+			return err
+		}
+		if idempotencyKey != "" {
+			if err := releaseIdempotencyKey(tx, idempotencyKey); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		log.Printf("Failed to cancel order %s after its payment capture failed; cancel it manually: %v", orderID, err)
+		return
+	}
+	log.Printf("Order %s cancelled after its payment capture failed: %v", orderID, cause)
+
+	// settleAdjustment logs a void that fails, for manual reconciliation
+	if err := settleAdjustment(database, purchaseID, adjustment); err != nil {
+		log.Printf("Failed to void the authorization of cancelled order %s: %v", orderID, err)
+	}
+}
+
+// pricedPurchase is an order priced from the catalog, the pricing rules and its promo code.
+// Items and Breakdown are in the order currency; BaseBreakdown is in the base currency, which
+// the promotions and fraud rules work in.
+type pricedPurchase struct {
+	Rate          *exchangeRate
+	Items         []PurchaseItem
+	Promo         *promotions.Promotion
+	BaseBreakdown pricing.Breakdown
+	Breakdown     pricing.Breakdown
+}
+
+// pricePurchase prices an order inside tx. Orders are priced in the base currency and
+// converted to the order currency at the rate in effect now, which is stored on the order.
+// A promo code is checked under a lock on the promotion that lasts until tx ends.
+func pricePurchase(tx *sql.Tx, req PurchaseRequest) (*pricedPurchase, error) {
+	orderRate, err := lookupExchangeRate(tx, baseCurrency, req.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	// Price every line from the catalog; client-supplied prices and names are never trusted
+	items, err := priceItems(tx, req.Items, orderRate.Rate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Subtotal, shipping and tax come from the pricing rules
+	lines := make([]pricing.Line, 0, len(items))
+	for _, item := range items {
+		lines = append(lines, pricing.Line{
+			ProductID:   item.ProductID,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			WeightGrams: item.WeightGrams,
+			Category:    item.Category,
+		})
+	}
+
+	priced := &pricedPurchase{Rate: orderRate, Items: items}
+	var discount pricing.Discount
+	if req.PromoCode != "" {
+		if priced.Promo, discount, err = applyPromotion(tx, req.PromoCode, req.CustomerEmail, lines); err != nil {
+			return nil, err
+		}
+	}
+
+	priced.BaseBreakdown = pricing.Calculate(lines, req.BillingAddress, discount)
+	priced.Breakdown = priced.BaseBreakdown.Convert(orderRate.Rate, lines)
+	for i := range items {
+		items[i].UnitPrice = orderRate.Convert(items[i].UnitPrice)
+	}
+	return priced, nil
+}
+
+// writePricingError maps errors from pricePurchase to responses
+func writePricingError(w http.ResponseWriter, r *http.Request, err error) {
+	var unknown *unknownProductError
+	var mismatch *priceMismatchError
+	var promoErr *promotions.Error
+	var unsupported *unsupportedCurrencyError
+	switch {
+	case errors.As(err, &unsupported):
+		writeCurrencyError(w, r, err, "Failed to load exchange rate")
+	case errors.As(err, &unknown):
+		writeError(w, r, http.StatusBadRequest, CodeUnknownProduct, err.Error())
+	case errors.As(err, &mismatch):
+		writeError(w, r, http.StatusConflict, CodePriceMismatch, err.Error())
+	case errors.As(err, &promoErr):
+		writeError(w, r, http.StatusUnprocessableEntity, CodePromoCodeRejected, err.Error())
+	default:
+		writeInternalError(w, r, "Failed to price purchase", err)
+	}
+}
+
+// GetPurchaseHandler lets a guest look up their order. Besides the order ID, the request
+// must carry the email address used for the order or the lookup token returned when it was
+// placed; see verifyGuestLookup.
 func GetPurchaseHandler(w http.ResponseWriter, r *http.Request) {
-	orderID := r.URL.Query().Get("orderId")
-	if orderID == "" {
-		http.Error(w, "Order ID is required", http.StatusBadRequest)
+	orderID, ok := parseOrderID(w, r, r.URL.Query().Get("orderId"))
+	if !ok {
 		return
 	}
 
 	database, err := db.GetDB()
 	if err != nil {
-		log.Printf("Failed to get DB connection: %v", err)
-		http.Error(w, "Failed to retrieve purchase", http.StatusInternalServerError)
+		writeInternalError(w, r, "Failed to retrieve purchase", err)
+		return
+	}
+
+	if !verifyGuestLookup(w, r, database, orderID) {
+		return
+	}
+
+	response, err := loadPurchaseDetails(database, orderID)
+	if err == sql.ErrNoRows {
+		writeNotFound(w, r, "Purchase not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, "Failed to retrieve purchase", err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// loadPurchaseDetails loads an order with its items, pricing, payment and status timeline.
+// Encrypted fields are left out. It returns sql.ErrNoRows if there is no such order.
+func loadPurchaseDetails(database *sql.DB, orderID string) (map[string]interface{}, error) {
 	// Get purchase details
 	var purchase struct {
 		ID                     int
@@ -194,52 +752,89 @@ func GetPurchaseHandler(w http.ResponseWriter, r *http.Request) {
 		CustomerPhoneEncrypted string
 		CreditCardEncrypted    string
 		BillingAddress         sql.NullString
-		TotalAmount            float64
+		TotalAmount            money.Money
+		RefundedAmount         money.Money
+		SubtotalAmount         money.Money
+		ShippingAmount         money.Money
+		ShippingMethod         sql.NullString
+		TaxAmount              money.Money
+		TaxRegion              sql.NullString
+		TaxLines               []byte
+		PromoCode              sql.NullString
+		DiscountAmount         money.Money
 		Status                 string
 		CreatedAt              time.Time
+		Card                   storedCard
+		Rate                   storedRate
 	}
 
-	err = database.QueryRow(`
+	err := database.QueryRow(`
 		SELECT id, order_id, customer_name, customer_email, customer_phone_encrypted,
-			credit_card_encrypted, billing_address, total_amount, status, created_at
+			credit_card_encrypted, billing_address, total_amount, refunded_amount, status, created_at,
+			COALESCE(subtotal_amount, total_amount), shipping_amount, shipping_method, tax_amount, tax_region, tax_lines,
+			promo_code, discount_amount, `+cardColumns+`, `+rateColumns+`
 		FROM purchases WHERE order_id = $1
 	`, orderID).Scan(&purchase.ID, &purchase.OrderID, &purchase.CustomerName, &purchase.CustomerEmail,
 		&purchase.CustomerPhoneEncrypted, &purchase.CreditCardEncrypted, &purchase.BillingAddress,
-		&purchase.TotalAmount, &purchase.Status, &purchase.CreatedAt)
-
-	if err == sql.ErrNoRows {
-		http.Error(w, "Purchase not found", http.StatusNotFound)
-		return
-	}
+		&purchase.TotalAmount, &purchase.RefundedAmount, &purchase.Status, &purchase.CreatedAt,
+		&purchase.SubtotalAmount, &purchase.ShippingAmount, &purchase.ShippingMethod, &purchase.TaxAmount,
+		&purchase.TaxRegion, &purchase.TaxLines, &purchase.PromoCode, &purchase.DiscountAmount,
+		&purchase.Card.brand, &purchase.Card.last4, &purchase.Card.expMonth, &purchase.Card.expYear,
+		&purchase.Rate.currency, &purchase.Rate.base, &purchase.Rate.rate, &purchase.Rate.effectiveFrom)
 	if err != nil {
-		log.Printf("Failed to query purchase: %v", err)
-		http.Error(w, "Failed to retrieve purchase", http.StatusInternalServerError)
-		return
+		return nil, err
+	}
+	currency := purchase.Rate.currency
+	for _, amount := range []*money.Money{&purchase.TotalAmount, &purchase.RefundedAmount, &purchase.SubtotalAmount,
+		&purchase.ShippingAmount, &purchase.TaxAmount, &purchase.DiscountAmount} {
+		*amount = amount.In(currency)
 	}
 
 	// Get purchase items
 	rows, err := database.Query(`
-		SELECT product_id, product_name, quantity, unit_price, subtotal
+		SELECT product_id, product_name, quantity, unit_price, subtotal, COALESCE(location, '')
 		FROM purchase_items WHERE purchase_id = $1
 	`, purchase.ID)
 	if err != nil {
-		log.Printf("Failed to query purchase items: %v", err)
-		http.Error(w, "Failed to retrieve purchase items", http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("failed to load purchase items: %w", err)
 	}
 	defer rows.Close()
 
 	var items []PurchaseItem
 	for rows.Next() {
 		var item PurchaseItem
-		var subtotal float64
-		if err := rows.Scan(&item.ProductID, &item.ProductName, &item.Quantity, &item.UnitPrice, &subtotal); err != nil {
+		var subtotal money.Money
+		if err := rows.Scan(&item.ProductID, &item.ProductName, &item.Quantity, &item.UnitPrice, &subtotal, &item.Location); err != nil {
 			log.Printf("Failed to scan purchase item: %v", err)
 			continue
 		}
+		item.UnitPrice = item.UnitPrice.In(currency)
 		items = append(items, item)
 	}
 
+	taxLines := []pricing.TaxLine{}
+	if err := json.Unmarshal(purchase.TaxLines, &taxLines); err != nil {
+		log.Printf("Failed to decode tax lines: %v", err)
+	}
+	for i := range taxLines {
+		taxLines[i].Amount = taxLines[i].Amount.In(currency)
+	}
+
+	timeline, err := loadStatusTimeline(database, purchase.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load status history: %w", err)
+	}
+
+	payment, err := loadPaymentInfo(database, purchase.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	fulfillments, err := loadFulfillments(database, purchase.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Prepare response (without decrypting sensitive data for security)
 	response := map[string]interface{}{
 		"orderId":        purchase.OrderID,
@@ -247,13 +842,33 @@ func GetPurchaseHandler(w http.ResponseWriter, r *http.Request) {
 		"customerEmail":  purchase.CustomerEmail,
 		"billingAddress": purchase.BillingAddress.String,
 		"totalAmount":    purchase.TotalAmount,
-		"status":         purchase.Status,
-		"createdAt":      purchase.CreatedAt.Format(time.RFC3339),
-		"items":          items,
+		"refundedAmount": purchase.RefundedAmount,
+		"currency":       purchase.TotalAmount.Currency,
+		"pricing": pricing.Breakdown{
+			Subtotal:       purchase.SubtotalAmount,
+			Discount:       purchase.DiscountAmount,
+			PromoCode:      purchase.PromoCode.String,
+			Shipping:       purchase.ShippingAmount,
+			ShippingMethod: purchase.ShippingMethod.String,
+			Tax:            purchase.TaxAmount,
+			TaxRegion:      purchase.TaxRegion.String,
+			TaxLines:       taxLines,
+			Total:          purchase.TotalAmount,
+		},
+		"status":       purchase.Status,
+		"createdAt":    purchase.CreatedAt.Format(time.RFC3339),
+		"items":        items,
+		"fulfillments": fulfillments,
+		"timeline":     timeline,
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Failed to encode response: %v", err)
+	if payment != nil {
+		response["payment"] = payment
+	}
+	if card := purchase.Card.summary(); card != nil {
+		response["card"] = card
+	}
+	if rate := purchase.Rate.info(); rate != nil {
+		response["exchangeRate"] = rate
 	}
+	return response, nil
 }
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"invisimart-api/db"
+	"invisimart-api/money"
+)
+
+const (
+	defaultPurchaseListLimit = 25
+	maxPurchaseListLimit     = 100
+)
+
+// PurchaseSummary is a single row of GET /admin/purchases. Encrypted fields are never included.
+type PurchaseSummary struct {
+	OrderID        string       `json:"orderId"`
+	CustomerName   string       `json:"customerName"`
+	CustomerEmail  string       `json:"customerEmail"`
+	Status         string       `json:"status"`
+	TotalAmount    money.Money  `json:"totalAmount"`
+	RefundedAmount money.Money  `json:"refundedAmount"`
+	Currency       string       `json:"currency"`
+	ItemCount      int          `json:"itemCount"`
+	Card           *CardSummary `json:"card,omitempty"`
+	CreatedAt      string       `json:"createdAt"`
+}
+
+// PurchaseListResponse is a page of purchases, newest first
+type PurchaseListResponse struct {
+	Purchases  []PurchaseSummary `json:"purchases"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+// purchaseCursor identifies the last row of a page. The id breaks ties between purchases
+// created in the same instant.
+type purchaseCursor struct {
+	CreatedAt time.Time
+	ID        int
+}
+
+func (c purchaseCursor) encode() string {
+	raw := fmt.Sprintf("%s|%d", c.CreatedAt.Format(time.RFC3339Nano), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodePurchaseCursor(value string) (purchaseCursor, error) {
+	var cursor purchaseCursor
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, fmt.Errorf("invalid cursor")
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return cursor, fmt.Errorf("invalid cursor")
+	}
+	if cursor.CreatedAt, err = time.Parse(time.RFC3339Nano, parts[0]); err != nil {
+		return cursor, fmt.Errorf("invalid cursor")
+	}
+	if cursor.ID, err = strconv.Atoi(parts[1]); err != nil {
+		return cursor, fmt.Errorf("invalid cursor")
+	}
+	return cursor, nil
+}
+
+// purchaseListQuery accumulates WHERE conditions and their positional arguments
+type purchaseListQuery struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (q *purchaseListQuery) add(condition string, args ...interface{}) {
+	for _, arg := range args {
+		q.args = append(q.args, arg)
+		condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(q.args)), 1)
+	}
+	q.conditions = append(q.conditions, condition)
+}
+
+// ListPurchasesHandler returns purchases newest first with cursor pagination to an
+// authenticated admin. Supported query parameters: email, status, currency, createdFrom,
+// createdTo (RFC 3339), minTotal, maxTotal, productId, limit and cursor. minTotal and maxTotal
+// are compared with each order's total in its own currency, so they are best combined with
+// currency.
+func ListPurchasesHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	var q purchaseListQuery
+
+	limit := defaultPurchaseListLimit
+	if value := params.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(parsed, maxPurchaseListLimit)
+	}
+
+	if email := params.Get("email"); email != "" {
+		q.add("LOWER(p.customer_email) = LOWER(?)", email)
+	}
+	if status := params.Get("status"); status != "" {
+		if !isKnownStatus(status) {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Unknown status: %s", status))
+			return
+		}
+		q.add("p.status = ?", status)
+	}
+	if currency := params.Get("currency"); currency != "" {
+		currency = strings.ToUpper(currency)
+		if !money.ValidCurrency(currency) {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "currency must be an ISO 4217 code such as EUR")
+			return
+		}
+		q.add("p.currency = ?", currency)
+	}
+
+	for _, bound := range []struct {
+		param     string
+		condition string
+	}{
+		{"createdFrom", "p.created_at >= ?"},
+		{"createdTo", "p.created_at < ?"},
+	} {
+		if value := params.Get(bound.param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("%s must be an RFC 3339 timestamp", bound.param))
+				return
+			}
+			// created_at is a UTC timestamp without a time zone, and binding a time with an
+			// offset against it would drop the offset rather than apply it
+			q.add(bound.condition, t.UTC())
+		}
+	}
+
+	for _, bound := range []struct {
+		param     string
+		condition string
+	}{
+		{"minTotal", "p.total_amount >= ?"},
+		{"maxTotal", "p.total_amount <= ?"},
+	} {
+		if value := params.Get(bound.param); value != "" {
+			amount, err := money.Parse(value, money.DefaultCurrency)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("%s must be a number", bound.param))
+				return
+			}
+			q.add(bound.condition, amount)
+		}
+	}
+
+	if productID := params.Get("productId"); productID != "" {
+		q.add("EXISTS (SELECT 1 FROM purchase_items pi WHERE pi.purchase_id = p.id AND pi.product_id = ?)", productID)
+	}
+
+	if value := params.Get("cursor"); value != "" {
+		cursor, err := decodePurchaseCursor(value)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid cursor")
+			return
+		}
+		// Written so the leading created_at bound can use idx_purchases_created_at
+		q.add("p.created_at <= ? AND (p.created_at < ? OR p.id < ?)", cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
+
+	where := ""
+	if len(q.conditions) > 0 {
+		where = "WHERE " + strings.Join(q.conditions, " AND ")
+	}
+
+	// Fetch one extra row to know whether another page exists
+	q.args = append(q.args, limit+1)
+	query := fmt.Sprintf(`
+		SELECT p.id, p.order_id, p.customer_name, p.customer_email, p.status,
+			p.total_amount, p.refunded_amount, p.currency, p.created_at, `+cardColumns+`,
+			(SELECT COALESCE(SUM(pi.quantity), 0) FROM purchase_items pi WHERE pi.purchase_id = p.id) AS item_count
+		FROM purchases p
+		%s
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $%d
+	`, where, len(q.args))
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to list purchases", err)
+		return
+	}
+
+	rows, err := database.Query(query, q.args...)
+	if err != nil {
+		writeInternalError(w, r, "Failed to list purchases", err)
+		return
+	}
+	defer rows.Close()
+
+	response := PurchaseListResponse{Purchases: []PurchaseSummary{}}
+	var last purchaseCursor
+	for rows.Next() {
+		var summary PurchaseSummary
+		var cursor purchaseCursor
+		var card storedCard
+		if err := rows.Scan(&cursor.ID, &summary.OrderID, &summary.CustomerName, &summary.CustomerEmail,
+			&summary.Status, &summary.TotalAmount, &summary.RefundedAmount, &summary.Currency, &cursor.CreatedAt,
+			&card.brand, &card.last4, &card.expMonth, &card.expYear, &summary.ItemCount); err != nil {
+			writeInternalError(w, r, "Failed to list purchases", err)
+			return
+		}
+
+		if len(response.Purchases) == limit {
+			response.NextCursor = last.encode()
+			break
+		}
+
+		summary.CreatedAt = cursor.CreatedAt.Format(time.RFC3339)
+		summary.TotalAmount = summary.TotalAmount.In(summary.Currency)
+		summary.RefundedAmount = summary.RefundedAmount.In(summary.Currency)
+		summary.Card = card.summary()
+		response.Purchases = append(response.Purchases, summary)
+		last = cursor
+	}
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, r, "Failed to list purchases", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
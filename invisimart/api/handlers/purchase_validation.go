@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"invisimart-api/money"
+	"invisimart-api/validation"
+)
+
+const (
+	// maxPurchaseLineQuantity caps a single purchase line, matching the cart limit
+	maxPurchaseLineQuantity = maxCartLineQuantity
+
+	// maxCustomerNameLength matches the customer_name column size
+	maxCustomerNameLength = 255
+
+	// maxBillingAddressLength keeps free-form addresses to something a label can print
+	maxBillingAddressLength = 500
+)
+
+// validatePurchaseRequest checks every field of a purchase and reports all problems at once.
+// The email, phone, card number, card expiry and currency are normalized in place so the stored
+// values are canonical.
+func validatePurchaseRequest(req *PurchaseRequest) validation.Errors {
+	var errs validation.Errors
+
+	if errs.Required("customerName", req.CustomerName, "Name") {
+		errs.MaxLength("customerName", req.CustomerName, "Name", maxCustomerNameLength)
+	}
+	req.CustomerEmail = errs.CheckEmail("customerEmail", req.CustomerEmail)
+	req.CustomerPhone = errs.CheckPhone("customerPhone", req.CustomerPhone)
+	req.CreditCard = errs.CheckCard("creditCard", req.CreditCard)
+	req.CardExpiryMonth, req.CardExpiryYear = errs.CheckCardExpiry("cardExpiryMonth", "cardExpiryYear",
+		req.CardExpiryMonth, req.CardExpiryYear, time.Now())
+	errs.MaxLength("billingAddress", req.BillingAddress, "Billing address", maxBillingAddressLength)
+
+	// Whether there is a rate for the currency is checked when the order is priced
+	req.Currency = strings.ToUpper(strings.TrimSpace(req.Currency))
+	if req.Currency == "" {
+		req.Currency = baseCurrency
+	} else if !money.ValidCurrency(req.Currency) {
+		errs.Add("currency", validation.CodeInvalidCurrency, "Currency must be an ISO 4217 code such as EUR")
+	}
+
+	if len(req.Items) == 0 {
+		errs.Add("items", validation.CodeRequired, "At least one item is required")
+	}
+
+	lines := make(map[string]int, len(req.Items))
+	for i, item := range req.Items {
+		field := fmt.Sprintf("items[%d]", i)
+
+		if errs.Required(field+".productId", item.ProductID, "Product ID") {
+			if first, ok := lines[item.ProductID]; ok {
+				errs.Addf(field+".productId", validation.CodeDuplicate,
+					"Product %s is already on line %d; combine the quantities", item.ProductID, first+1)
+			} else {
+				lines[item.ProductID] = i
+			}
+		}
+
+		switch {
+		case item.Quantity <= 0:
+			errs.Add(field+".quantity", validation.CodeInvalidQuantity, "Quantity must be a positive whole number")
+		case item.Quantity > maxPurchaseLineQuantity:
+			errs.Addf(field+".quantity", validation.CodeQuantityTooLarge, "Quantity must be at most %d", maxPurchaseLineQuantity)
+		}
+	}
+
+	return errs
+}
+
+// writeValidationErrors rejects a request with the list of invalid fields
+func writeValidationErrors(w http.ResponseWriter, r *http.Request, errs validation.Errors) {
+	problem := newProblem(r, http.StatusBadRequest, CodeValidationFailed,
+		fmt.Sprintf("%d field(s) are invalid", len(errs)))
+	problem.Extensions = map[string]interface{}{"errors": errs}
+	writeProblemResponse(w, problem)
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"invisimart-api/validation"
+)
+
+// validPurchaseRequest returns a request that passes validation
+func validPurchaseRequest() PurchaseRequest {
+	return PurchaseRequest{
+		CustomerName:   "Ada Lovelace",
+		CustomerEmail:  "ada@Example.COM",
+		CustomerPhone:  "(415) 555-0123",
+		CreditCard:     "4111 1111 1111 1111",
+		BillingAddress: "1 Main St, Springfield, IL 62704",
+		Items: []PurchaseItem{
+			{ProductID: "1", Quantity: 1},
+			{ProductID: "2", Quantity: 3},
+		},
+	}
+}
+
+// errorCodes maps each invalid field to its error code
+func errorCodes(errs validation.Errors) map[string]string {
+	codes := map[string]string{}
+	for _, e := range errs {
+		codes[e.Field] = e.Code
+	}
+	return codes
+}
+
+func TestValidatePurchaseRequestNormalizes(t *testing.T) {
+	req := validPurchaseRequest()
+	if errs := validatePurchaseRequest(&req); len(errs) > 0 {
+		t.Fatalf("valid request rejected: %+v", errs)
+	}
+	if req.CustomerEmail != "ada@example.com" {
+		t.Errorf("email = %q, want the domain lower-cased", req.CustomerEmail)
+	}
+	if req.CustomerPhone != "+14155550123" {
+		t.Errorf("phone = %q, want E.164 in the default country", req.CustomerPhone)
+	}
+	if req.CreditCard != "4111111111111111" {
+		t.Errorf("card = %q, want digits only", req.CreditCard)
+	}
+}
+
+func TestValidatePurchaseRequestPhone(t *testing.T) {
+	tests := []struct {
+		phone    string
+		want     string
+		wantCode string
+	}{
+		{"415.555.0123", "+14155550123", ""},
+		// A national number that already has the default country code is not prefixed twice
+		{"1 (415) 555-0123", "+14155550123", ""},
+		{"+44 20 7946 0958", "+442079460958", ""},
+		{"555-0123", "555-0123", validation.CodeInvalidPhone},
+		{"+0 20 7946 0958", "+0 20 7946 0958", validation.CodeInvalidPhone},
+		{"415-555-0123 ext 4", "415-555-0123 ext 4", validation.CodeInvalidPhone},
+		{"", "", validation.CodeRequired},
+	}
+	for _, tt := range tests {
+		req := validPurchaseRequest()
+		req.CustomerPhone = tt.phone
+		codes := errorCodes(validatePurchaseRequest(&req))
+		if codes["customerPhone"] != tt.wantCode || len(codes) > 1 {
+			t.Errorf("phone %q: errors %v, want customerPhone %q", tt.phone, codes, tt.wantCode)
+		}
+		if req.CustomerPhone != tt.want {
+			t.Errorf("phone %q normalized to %q, want %q", tt.phone, req.CustomerPhone, tt.want)
+		}
+	}
+}
+
+func TestValidatePurchaseRequestItems(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []PurchaseItem
+		want  map[string]string
+	}{
+		{"no items", nil, map[string]string{"items": validation.CodeRequired}},
+		{"zero quantity", []PurchaseItem{{ProductID: "1", Quantity: 0}},
+			map[string]string{"items[0].quantity": validation.CodeInvalidQuantity}},
+		{"negative quantity", []PurchaseItem{{ProductID: "1", Quantity: -2}},
+			map[string]string{"items[0].quantity": validation.CodeInvalidQuantity}},
+		{"quantity at the cap", []PurchaseItem{{ProductID: "1", Quantity: maxPurchaseLineQuantity}}, map[string]string{}},
+		{"quantity over the cap", []PurchaseItem{{ProductID: "1", Quantity: maxPurchaseLineQuantity + 1}},
+			map[string]string{"items[0].quantity": validation.CodeQuantityTooLarge}},
+		{"missing product", []PurchaseItem{{ProductID: "", Quantity: 1}},
+			map[string]string{"items[0].productId": validation.CodeRequired}},
+		// The first line is kept and every repeat is reported
+		{"duplicate lines", []PurchaseItem{{ProductID: "1", Quantity: 1}, {ProductID: "2", Quantity: 1}, {ProductID: "1", Quantity: 2}},
+			map[string]string{"items[2].productId": validation.CodeDuplicate}},
+	}
+	for _, tt := range tests {
+		req := validPurchaseRequest()
+		req.Items = tt.items
+		codes := errorCodes(validatePurchaseRequest(&req))
+		if len(codes) != len(tt.want) {
+			t.Errorf("%s: errors %v, want %v", tt.name, codes, tt.want)
+			continue
+		}
+		for field, code := range tt.want {
+			if codes[field] != code {
+				t.Errorf("%s: %s error %q, want %q", tt.name, field, codes[field], code)
+			}
+		}
+	}
+}
+
+func TestValidatePurchaseRequestReportsEveryField(t *testing.T) {
+	req := PurchaseRequest{
+		CustomerEmail: "not an email",
+		CreditCard:    "4111111111111112",
+		Items:         []PurchaseItem{{ProductID: "1", Quantity: 0}},
+	}
+	want := map[string]string{
+		"customerName":      validation.CodeRequired,
+		"customerEmail":     validation.CodeInvalidEmail,
+		"customerPhone":     validation.CodeRequired,
+		"creditCard":        validation.CodeInvalidCardNumber,
+		"items[0].quantity": validation.CodeInvalidQuantity,
+	}
+	codes := errorCodes(validatePurchaseRequest(&req))
+	if len(codes) != len(want) {
+		t.Fatalf("errors %v, want %v", codes, want)
+	}
+	for field, code := range want {
+		if codes[field] != code {
+			t.Errorf("%s error %q, want %q", field, codes[field], code)
+		}
+	}
+}
+
+func TestValidatePurchaseRequestCardExpiry(t *testing.T) {
+	nextYear := time.Now().Year() + 1
+	tests := []struct {
+		name      string
+		month     int
+		year      int
+		wantYear  int
+		wantCodes map[string]string
+	}{
+		{name: "no expiry"},
+		{name: "two-digit year", month: 3, year: nextYear % 100, wantYear: nextYear},
+		{name: "expired", month: 12, year: time.Now().Year() - 1, wantYear: time.Now().Year() - 1,
+			wantCodes: map[string]string{"cardExpiryYear": validation.CodeInvalidCardExpiry}},
+		{name: "month out of range", month: 13, year: nextYear, wantYear: nextYear,
+			wantCodes: map[string]string{"cardExpiryMonth": validation.CodeInvalidCardExpiry}},
+		{name: "month without year", month: 3, wantCodes: map[string]string{"cardExpiryYear": validation.CodeRequired}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := validPurchaseRequest()
+			req.CardExpiryMonth, req.CardExpiryYear = tt.month, tt.year
+			codes := errorCodes(validatePurchaseRequest(&req))
+			if len(codes) != len(tt.wantCodes) {
+				t.Fatalf("errors = %v, want %v", codes, tt.wantCodes)
+			}
+			for field, code := range tt.wantCodes {
+				if codes[field] != code {
+					t.Errorf("%s error = %q, want %q", field, codes[field], code)
+				}
+			}
+			if req.CardExpiryYear != tt.wantYear {
+				t.Errorf("expiry year = %d, want %d", req.CardExpiryYear, tt.wantYear)
+			}
+		})
+	}
+}
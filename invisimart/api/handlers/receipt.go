@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"invisimart-api/db"
+	"invisimart-api/money"
+	"invisimart-api/receipts"
+
+	"github.com/gorilla/mux"
+)
+
+// Receipt media types, in order of preference when the client accepts both
+const (
+	receiptHTML = "text/html"
+	receiptPDF  = "application/pdf"
+)
+
+// invoiceSequence names the invoice_sequences row used for order receipts
+const invoiceSequence = "invoice"
+
+// allocateInvoiceNumber assigns the next invoice number to a purchase. It locks the counter
+// row until the transaction ends, so it should be the last statement before commit: numbers
+// are then handed out in commit order, and a rollback returns the number unused.
+func allocateInvoiceNumber(tx *sql.Tx, purchaseID int) (int64, error) {
+	var number int64
+	err := tx.QueryRow(`
+		UPDATE invoice_sequences SET last_number = last_number + 1 WHERE name = $1 RETURNING last_number
+	`, invoiceSequence).Scan(&number)
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate invoice number: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE purchases SET invoice_number = $1 WHERE id = $2`, number, purchaseID); err != nil {
+		return 0, fmt.Errorf("failed to record invoice number: %w", err)
+	}
+	return number, nil
+}
+
+// GetReceiptHandler returns an order's receipt as HTML, or as a PDF when the Accept header
+// prefers application/pdf. Like GetPurchaseHandler, it needs the order's email address or
+// lookup token.
+func GetReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderID(w, r, mux.Vars(r)["orderId"])
+	if !ok {
+		return
+	}
+
+	format := negotiateType(r.Header.Get("Accept"), receiptHTML, receiptPDF)
+	if format == "" {
+		writeError(w, r, http.StatusNotAcceptable, CodeNotAcceptable,
+			"Receipts are available as text/html or application/pdf")
+		return
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to retrieve receipt", err)
+		return
+	}
+
+	// Receipts carry the same personal details as the order, so they need the same proof
+	if !verifyGuestLookup(w, r, database, orderID) {
+		return
+	}
+
+	receipt, err := loadReceipt(database, orderID)
+	if err == sql.ErrNoRows {
+		writeNotFound(w, r, "Purchase not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, "Failed to retrieve receipt", err)
+		return
+	}
+
+	w.Header().Set("Vary", "Accept")
+	if format == receiptPDF {
+		w.Header().Set("Content-Type", receiptPDF)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="receipt-%s.pdf"`, receipt.InvoiceNumber))
+		w.Write(receipts.RenderPDF(*receipt))
+		return
+	}
+
+	var body bytes.Buffer
+	if err := receipts.RenderHTML(&body, *receipt); err != nil {
+		writeInternalError(w, r, "Failed to render receipt", err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(body.Bytes())
+}
+
+// loadReceipt reads everything printed on an order's receipt
+func loadReceipt(database *sql.DB, orderID string) (*receipts.Receipt, error) {
+	var receipt receipts.Receipt
+	var purchaseID int
+	var invoiceNumber sql.NullInt64
+	var billingAddress, shippingMethod, promoCode sql.NullString
+	var card storedCard
+	var rate storedRate
+	var taxLines []byte
+	var createdAt time.Time
+
+	err := database.QueryRow(`
+		SELECT id, order_id, invoice_number, status, created_at, customer_name, customer_email, billing_address,
+			COALESCE(subtotal_amount, total_amount), discount_amount, promo_code, shipping_amount, shipping_method,
+			tax_amount, tax_lines, total_amount, refunded_amount, `+cardColumns+`, `+rateColumns+`
+		FROM purchases WHERE order_id = $1
+	`, orderID).Scan(&purchaseID, &receipt.OrderID, &invoiceNumber, &receipt.Status, &createdAt,
+		&receipt.CustomerName, &receipt.CustomerEmail, &billingAddress,
+		&receipt.Subtotal, &receipt.Discount, &promoCode, &receipt.Shipping, &shippingMethod,
+		&receipt.Tax, &taxLines, &receipt.Total, &receipt.Refunded,
+		&card.brand, &card.last4, &card.expMonth, &card.expYear,
+		&rate.currency, &rate.base, &rate.rate, &rate.effectiveFrom)
+	if err != nil {
+		return nil, err
+	}
+	for _, amount := range []*money.Money{&receipt.Subtotal, &receipt.Discount, &receipt.Shipping,
+		&receipt.Tax, &receipt.Total, &receipt.Refunded} {
+		*amount = amount.In(rate.currency)
+	}
+
+	// Every order is numbered by migration 012 or at commit, so a missing number means the
+	// migration has not been applied
+	if !invoiceNumber.Valid {
+		return nil, fmt.Errorf("purchase %s has no invoice number", orderID)
+	}
+	receipt.InvoiceNumber = receipts.FormatInvoiceNumber(invoiceNumber.Int64)
+	receipt.IssuedAt = createdAt
+	receipt.BillingAddress = billingAddress.String
+	receipt.ShippingMethod = shippingMethod.String
+	receipt.PromoCode = promoCode.String
+	if summary := card.summary(); summary != nil {
+		receipt.MaskedCard = summary.Masked()
+		receipt.CardExpiry = summary.Expiry()
+	}
+	if len(taxLines) > 0 {
+		if err := json.Unmarshal(taxLines, &receipt.TaxLines); err != nil {
+			log.Printf("Failed to decode tax lines for %s: %v", orderID, err)
+		}
+		for i := range receipt.TaxLines {
+			receipt.TaxLines[i].Amount = receipt.TaxLines[i].Amount.In(rate.currency)
+		}
+	}
+
+	rows, err := database.Query(`
+		SELECT product_id, product_name, quantity, unit_price, subtotal
+		FROM purchase_items WHERE purchase_id = $1
+		ORDER BY id
+	`, purchaseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load receipt lines: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line receipts.Line
+		var unitPrice, amount money.Money
+		if err := rows.Scan(&line.ProductID, &line.Description, &line.Quantity, &unitPrice, &amount); err != nil {
+			return nil, fmt.Errorf("failed to read receipt line: %w", err)
+		}
+		line.UnitPrice, line.Amount = unitPrice.In(rate.currency), amount.In(rate.currency)
+		receipt.Lines = append(receipt.Lines, line)
+	}
+	return &receipt, rows.Err()
+}
+
+// negotiateType picks the offered media type the client prefers according to its Accept
+// header. Ties go to the earlier offer, and an empty header accepts the first offer. It
+// returns "" if the client accepts none of them.
+func negotiateType(accept string, offers ...string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q := acceptQuality(accept, offer)
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the q-value an Accept header gives a media type, using the most
+// specific matching range
+func acceptQuality(accept, mediaType string) float64 {
+	mainType, _, _ := strings.Cut(mediaType, "/")
+	quality, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaRange := strings.ToLower(strings.TrimSpace(params[0]))
+
+		var rank int
+		switch mediaRange {
+		case mediaType:
+			rank = 2
+		case mainType + "/*":
+			rank = 1
+		case "*/*":
+			rank = 0
+		default:
+			continue
+		}
+		if rank < specificity {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		quality, specificity = q, rank
+	}
+	return quality
+}
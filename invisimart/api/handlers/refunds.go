@@ -0,0 +1,582 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"invisimart-api/db"
+	"invisimart-api/money"
+	"invisimart-api/ordertoken"
+	"invisimart-api/payments"
+	"invisimart-api/pricing"
+
+	"github.com/gorilla/mux"
+)
+
+// Adjustment types recorded in purchase_adjustments
+const (
+	AdjustmentCancel = "cancel"
+	AdjustmentRefund = "refund"
+)
+
+// Payment states of an adjustment, stored on purchase_adjustments.payment_status
+const (
+	adjustmentPaymentPending   = "pending"
+	adjustmentPaymentCompleted = "completed"
+	adjustmentPaymentFailed    = "failed"
+)
+
+// customerActor is recorded as the actor when a customer cancels their own order
+const customerActor = "customer"
+
+// defaultRestockLocation is used for order lines placed before locations were recorded
+const defaultRestockLocation = "main-store"
+
+// AdjustmentRequest is the body of POST /purchase/{orderId}/cancel and /refund.
+// Items is only used for refunds; an empty list refunds everything not yet returned.
+// ChangedBy is the authenticated caller and is never read from the body.
+type AdjustmentRequest struct {
+	Items     []AdjustmentItemRequest `json:"items"`
+	Reason    string                  `json:"reason"`
+	ChangedBy string                  `json:"-"`
+}
+
+// AdjustmentItemRequest selects a quantity of one product to refund
+type AdjustmentItemRequest struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+}
+
+// AdjustmentItem is a returned quantity of one order line
+type AdjustmentItem struct {
+	ProductID string      `json:"productId"`
+	Quantity  int         `json:"quantity"`
+	Amount    money.Money `json:"amount"`
+	Location  string      `json:"location"`
+}
+
+// AdjustmentResponse is returned after a cancellation or refund
+type AdjustmentResponse struct {
+	OrderID        string           `json:"orderId"`
+	Status         string           `json:"status"`
+	Type           string           `json:"type"`
+	Amount         money.Money      `json:"amount"`
+	RefundedAmount money.Money      `json:"refundedAmount"`
+	TotalAmount    money.Money      `json:"totalAmount"`
+	Currency       string           `json:"currency"`
+	Items          []AdjustmentItem `json:"items"`
+	Payment        *PaymentInfo     `json:"payment,omitempty"`
+
+	// adjustmentID and closesOrder are what settleAdjustment needs once the adjustment is
+	// committed
+	adjustmentID int
+	closesOrder  bool
+}
+
+// purchaseLine is a locked purchase_items row
+type purchaseLine struct {
+	ID        int
+	ProductID string
+	Quantity  int
+	Returned  int
+	UnitPrice money.Money
+	Location  string
+}
+
+// plannedReturn is a quantity to be returned from a specific purchase line
+type plannedReturn struct {
+	Line     purchaseLine
+	Quantity int
+}
+
+// invalidAdjustmentError is returned when a refund asks for items that are not on the order
+type invalidAdjustmentError struct {
+	Message string
+}
+
+func (e *invalidAdjustmentError) Error() string {
+	return e.Message
+}
+
+// CancelPurchaseHandler cancels an order, restocking every item that has not been returned yet.
+// Admins can cancel any order; a customer can cancel their own with its lookup token.
+func CancelPurchaseHandler(w http.ResponseWriter, r *http.Request) {
+	adjustPurchase(w, r, AdjustmentCancel)
+}
+
+// RefundPurchaseHandler refunds some or all items of an order and restocks them. Only admins
+// can refund.
+func RefundPurchaseHandler(w http.ResponseWriter, r *http.Request) {
+	adjustPurchase(w, r, AdjustmentRefund)
+}
+
+// adjustPurchase implements cancellation and refunds. Both return items to the inventory
+// location they were sold from, log "return" inventory events and record the adjustment
+// amount against the purchase.
+func adjustPurchase(w http.ResponseWriter, r *http.Request, adjustmentType string) {
+	orderID, ok := parseOrderID(w, r, mux.Vars(r)["orderId"])
+	if !ok {
+		return
+	}
+
+	actor, ok := adjustmentActor(w, r, orderID, adjustmentType)
+	if !ok {
+		return
+	}
+
+	var req AdjustmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeInvalidBody(w, r, err)
+		return
+	}
+	if adjustmentType == AdjustmentCancel && len(req.Items) > 0 {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest,
+			"Cancellation applies to the whole order; use /refund for individual items")
+		return
+	}
+	req.ChangedBy = actor
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to adjust purchase", err)
+		return
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		writeInternalError(w, r, "Failed to adjust purchase", err)
+		return
+	}
+	defer tx.Rollback()
+
+	purchaseID, status, err := lockPurchase(tx, orderID)
+	if err == sql.ErrNoRows {
+		writeNotFound(w, r, "Purchase not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, "Failed to adjust purchase", err)
+		return
+	}
+
+	response, err := applyAdjustment(tx, purchaseID, orderID, status, adjustmentType, req)
+	if err != nil {
+		writeAdjustmentError(w, r, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, r, "Failed to adjust purchase", err)
+		return
+	}
+
+	if err := settleAdjustment(database, purchaseID, response); err != nil {
+		writeAdjustmentError(w, r, err)
+		return
+	}
+
+	log.Printf("Purchase %s recorded - OrderID: %s, Amount: %s, Items: %d, Status: %s, By: %s",
+		adjustmentType, orderID, response.Amount, len(response.Items), response.Status, actor)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// paymentFailure is a processor error raised while adjusting a purchase
+type paymentFailure struct {
+	Err error
+}
+
+func (e *paymentFailure) Error() string {
+	return e.Err.Error()
+}
+
+func (e *paymentFailure) Unwrap() error {
+	return e.Err
+}
+
+// writeAdjustmentError maps an error from applyAdjustment to a response
+func writeAdjustmentError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid *invalidAdjustmentError
+	var transition *invalidTransitionError
+	var conflict *conflictError
+	var payment *paymentFailure
+	switch {
+	case errors.As(err, &invalid):
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+	case errors.As(err, &transition):
+		writeError(w, r, http.StatusConflict, CodeInvalidStatusTransition, err.Error())
+	case errors.As(err, &conflict):
+		writeError(w, r, http.StatusConflict, CodeConflict, err.Error())
+	case errors.As(err, &payment):
+		writePaymentError(w, r, payment.Err)
+	default:
+		writeInternalError(w, r, "Failed to adjust purchase", err)
+	}
+}
+
+// applyAdjustment cancels or refunds a purchase locked with lockPurchase: it restocks the
+// returned items, records the adjustment and closes the order if nothing is left on it. The
+// money is not returned here: once the caller has committed, settleAdjustment returns it
+// through the payment processor, so a processor call is never made from a transaction that
+// could still roll back.
+func applyAdjustment(tx *sql.Tx, purchaseID int, orderID, status, adjustmentType string,
+	req AdjustmentRequest) (*AdjustmentResponse, error) {
+	targetStatus := StatusCancelled
+	if adjustmentType == AdjustmentRefund {
+		targetStatus = StatusRefunded
+	}
+
+	if !canTransition(status, targetStatus) {
+		return nil, &invalidTransitionError{From: status, To: targetStatus}
+	}
+
+	lines, err := lockPurchaseLines(tx, purchaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	returns, err := planReturns(lines, req.Items)
+	if err != nil {
+		return nil, err
+	}
+	if adjustmentType == AdjustmentRefund && len(returns) == 0 {
+		return nil, &conflictError{Message: "Nothing left to refund on this order"}
+	}
+
+	response := AdjustmentResponse{
+		OrderID: orderID,
+		Status:  status,
+		Type:    adjustmentType,
+		Items:   []AdjustmentItem{},
+	}
+
+	var totalAmount, refundedAmount, subtotalAmount, taxAmount, discountAmount money.Money
+	var currency string
+	err = tx.QueryRow(`
+		SELECT total_amount, refunded_amount, COALESCE(subtotal_amount, total_amount), tax_amount, discount_amount, currency
+		FROM purchases WHERE id = $1
+	`, purchaseID).Scan(&totalAmount, &refundedAmount, &subtotalAmount, &taxAmount, &discountAmount, &currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load purchase amounts: %w", err)
+	}
+
+	var itemsAmount money.Money
+	for _, ret := range returns {
+		if err := restockItem(tx, ret.Line.ProductID, ret.Line.Location, ret.Quantity); err != nil {
+			return nil, err
+		}
+
+		_, err := tx.Exec(`
+			UPDATE purchase_items SET returned_quantity = returned_quantity + $1 WHERE id = $2
+		`, ret.Quantity, ret.Line.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record returned quantity: %w", err)
+		}
+
+		amount := ret.Line.UnitPrice.Mul(int64(ret.Quantity))
+		itemsAmount = itemsAmount.Add(amount)
+		response.Items = append(response.Items, AdjustmentItem{
+			ProductID: ret.Line.ProductID,
+			Quantity:  ret.Quantity,
+			Amount:    amount,
+			Location:  ret.Line.Location,
+		})
+	}
+
+	// Closing the order refunds everything still outstanding, including shipping. A partial
+	// refund returns the items less their share of any discount, plus their share of the tax.
+	closesOrder := adjustmentType == AdjustmentCancel || fullyReturned(lines, returns)
+	switch {
+	case closesOrder:
+		response.Amount = totalAmount.Sub(refundedAmount)
+	default:
+		response.Amount = pricing.PartialRefund(itemsAmount, subtotalAmount, discountAmount, taxAmount)
+	}
+
+	// An order held for review was only authorized, so it can be voided but not partly refunded
+	payment, err := loadPaymentInfo(tx, purchaseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load payment: %w", err)
+	}
+	settles := payment != nil && response.Amount.Minor > 0
+	if settles && payment.Status == payments.StatusAuthorized && !closesOrder {
+		return nil, &conflictError{Message: "The payment for this order has not been captured, so it can only be cancelled"}
+	}
+	response.Payment = payment
+	response.closesOrder = closesOrder
+
+	var paymentStatus sql.NullString
+	if settles {
+		paymentStatus = sql.NullString{String: adjustmentPaymentPending, Valid: true}
+	}
+	err = tx.QueryRow(`
+		INSERT INTO purchase_adjustments (purchase_id, adjustment_type, amount, reason, created_by, payment_status)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)
+		RETURNING id
+	`, purchaseID, adjustmentType, response.Amount, req.Reason, req.ChangedBy, paymentStatus).Scan(&response.adjustmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record adjustment: %w", err)
+	}
+
+	for i, ret := range returns {
+		_, err := tx.Exec(`
+			INSERT INTO purchase_adjustment_items (adjustment_id, purchase_item_id, product_id, quantity, amount, location)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, response.adjustmentID, ret.Line.ID, ret.Line.ProductID, ret.Quantity, response.Items[i].Amount, ret.Line.Location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record adjustment item: %w", err)
+		}
+	}
+
+	err = tx.QueryRow(`
+		UPDATE purchases SET refunded_amount = refunded_amount + $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+		RETURNING refunded_amount, total_amount
+	`, response.Amount, purchaseID).Scan(&response.RefundedAmount, &response.TotalAmount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update refunded amount: %w", err)
+	}
+
+	// The amounts above were read without their currency; label them with the order's before
+	// they are returned to the processor
+	response.Currency = currency
+	response.Amount = response.Amount.In(currency)
+	response.RefundedAmount = response.RefundedAmount.In(currency)
+	response.TotalAmount = response.TotalAmount.In(currency)
+	for i := range response.Items {
+		response.Items[i].Amount = response.Items[i].Amount.In(currency)
+	}
+
+	// Cancellation always closes the order; a refund does once every item has been returned
+	if closesOrder {
+		if err := transitionStatus(tx, purchaseID, status, targetStatus, req.ChangedBy, req.Reason); err != nil {
+			return nil, err
+		}
+		response.Status = targetStatus
+	}
+
+	return &response, nil
+}
+
+// settleAdjustment returns the money for an adjustment committed by applyAdjustment through
+// the processor the order was paid with, then records the outcome on the adjustment and the
+// purchase. An order held for review was only authorized, so closing it voids the hold
+// instead. A declined refund marks the adjustment failed; a timeout leaves it pending, since
+// the processor may still have acted. Either way the restock and status change stand.
+func settleAdjustment(database *sql.DB, purchaseID int, adjustment *AdjustmentResponse) error {
+	payment := adjustment.Payment
+	if payment == nil || adjustment.Amount.Minor <= 0 {
+		return nil
+	}
+
+	processor, err := payment.processor()
+	if err != nil {
+		return err
+	}
+	status := payments.StatusVoided
+	if payment.Status == payments.StatusAuthorized {
+		err = processor.Void(payment.Reference)
+	} else {
+		err = processor.Refund(payment.Reference, adjustment.Amount)
+		status = payments.StatusPartiallyRefunded
+		if adjustment.closesOrder {
+			status = payments.StatusRefunded
+		}
+	}
+	if err != nil {
+		var paymentErr *payments.Error
+		if errors.As(err, &paymentErr) && paymentErr.Timeout() {
+			log.Printf("Payment %s for adjustment %d of order %s timed out; reconcile it manually",
+				payment.Reference, adjustment.adjustmentID, adjustment.OrderID)
+			return &paymentFailure{Err: err}
+		}
+		_, dbErr := database.Exec(`UPDATE purchase_adjustments SET payment_status = $1 WHERE id = $2`,
+			adjustmentPaymentFailed, adjustment.adjustmentID)
+		if dbErr != nil {
+			log.Printf("Failed to record failed payment for adjustment %d: %v", adjustment.adjustmentID, dbErr)
+		}
+		log.Printf("Payment %s for adjustment %d of order %s failed; return the money manually: %v",
+			payment.Reference, adjustment.adjustmentID, adjustment.OrderID, err)
+		return &paymentFailure{Err: err}
+	}
+
+	err = func() error {
+		tx, err := database.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		_, err = tx.Exec(`UPDATE purchase_adjustments SET payment_status = $1 WHERE id = $2`,
+			adjustmentPaymentCompleted, adjustment.adjustmentID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE purchases SET payment_status = $1 WHERE id = $2`, status, purchaseID)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		log.Printf("Payment %s for adjustment %d of order %s was settled but could not be recorded; reconcile it manually",
+			payment.Reference, adjustment.adjustmentID, adjustment.OrderID)
+		return fmt.Errorf("failed to record payment status: %w", err)
+	}
+	payment.Status = status
+	return nil
+}
+
+// adjustmentActor authenticates the caller adjusting an order and returns the name recorded
+// against the change. A request with an admin token is made by that admin. Without one, a
+// customer may cancel an order by passing its lookup token as the "token" query parameter.
+// It writes the error response and returns false if the caller may not make the adjustment.
+func adjustmentActor(w http.ResponseWriter, r *http.Request, orderID, adjustmentType string) (string, bool) {
+	token := strings.TrimSpace(r.URL.Query().Get("token"))
+	if adjustmentType != AdjustmentCancel || token == "" || r.Header.Get("Authorization") != "" {
+		return requireAdmin(w, r)
+	}
+
+	err := ordertoken.Verify(orderID, token, time.Now())
+	if errors.Is(err, ordertoken.ErrExpired) {
+		writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "This lookup token has expired")
+		return "", false
+	}
+	if errors.Is(err, ordertoken.ErrNotConfigured) {
+		writeInternalError(w, r, "Failed to adjust purchase", err)
+		return "", false
+	}
+	if err != nil {
+		writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "The lookup token is not valid for this order")
+		return "", false
+	}
+	return customerActor, true
+}
+
+// lockPurchaseLines locks and returns every line of a purchase
+func lockPurchaseLines(tx *sql.Tx, purchaseID int) ([]purchaseLine, error) {
+	rows, err := tx.Query(`
+		SELECT id, product_id, quantity, returned_quantity, unit_price, COALESCE(location, $2)
+		FROM purchase_items
+		WHERE purchase_id = $1
+		ORDER BY id
+		FOR UPDATE
+	`, purchaseID, defaultRestockLocation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock purchase items: %w", err)
+	}
+	defer rows.Close()
+
+	var lines []purchaseLine
+	for rows.Next() {
+		var line purchaseLine
+		if err := rows.Scan(&line.ID, &line.ProductID, &line.Quantity, &line.Returned, &line.UnitPrice, &line.Location); err != nil {
+			return nil, fmt.Errorf("failed to scan purchase item: %w", err)
+		}
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
+
+// planReturns decides how much to return from each line. With no requested items every
+// outstanding quantity is returned; otherwise each requested quantity is taken from the
+// order's lines for that product in order.
+func planReturns(lines []purchaseLine, requested []AdjustmentItemRequest) ([]plannedReturn, error) {
+	var returns []plannedReturn
+	if len(requested) == 0 {
+		for _, line := range lines {
+			if remaining := line.Quantity - line.Returned; remaining > 0 {
+				returns = append(returns, plannedReturn{Line: line, Quantity: remaining})
+			}
+		}
+		return returns, nil
+	}
+
+	remaining := make(map[int]int, len(lines))
+	for _, line := range lines {
+		remaining[line.ID] = line.Quantity - line.Returned
+	}
+
+	for _, item := range requested {
+		if item.ProductID == "" || item.Quantity <= 0 {
+			return nil, &invalidAdjustmentError{Message: "Each refund item requires a product ID and a positive quantity"}
+		}
+
+		wanted := item.Quantity
+		found := false
+		for _, line := range lines {
+			if line.ProductID != item.ProductID {
+				continue
+			}
+			found = true
+			take := min(wanted, remaining[line.ID])
+			if take == 0 {
+				continue
+			}
+			returns = append(returns, plannedReturn{Line: line, Quantity: take})
+			remaining[line.ID] -= take
+			wanted -= take
+			if wanted == 0 {
+				break
+			}
+		}
+
+		if !found {
+			return nil, &invalidAdjustmentError{Message: fmt.Sprintf("Product %s is not part of this order", item.ProductID)}
+		}
+		if wanted > 0 {
+			return nil, &invalidAdjustmentError{Message: fmt.Sprintf("Cannot refund %d of product %s; only %d remaining",
+				item.Quantity, item.ProductID, item.Quantity-wanted)}
+		}
+	}
+
+	return returns, nil
+}
+
+// fullyReturned reports whether the planned returns leave nothing outstanding on the order
+func fullyReturned(lines []purchaseLine, returns []plannedReturn) bool {
+	returned := make(map[int]int, len(returns))
+	for _, ret := range returns {
+		returned[ret.Line.ID] += ret.Quantity
+	}
+	for _, line := range lines {
+		if line.Quantity-line.Returned-returned[line.ID] > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// restockItem returns quantity units of a product to a location and logs a "return" event
+func restockItem(tx *sql.Tx, productID, location string, quantity int) error {
+	var newStock int
+	err := tx.QueryRow(`
+		INSERT INTO inventory (product_id, stock, location)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (product_id, location) DO UPDATE
+		SET stock = inventory.stock + EXCLUDED.stock, updated_at = CURRENT_TIMESTAMP
+		RETURNING stock
+	`, productID, quantity, location).Scan(&newStock)
+	if err != nil {
+		return fmt.Errorf("failed to restock product %s at %s: %w", productID, location, err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO inventory_events (product_id, event_type, quantity_change, previous_stock, new_stock, location)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, productID, "return", quantity, newStock-quantity, newStock, location)
+	if err != nil {
+		return fmt.Errorf("failed to log return event for product %s: %w", productID, err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	"invisimart-api/fulfillment"
+)
+
+// stockShortage describes a purchase line that cannot be fulfilled from current stock
+type stockShortage struct {
+	ProductID string `json:"productId"`
+	Requested int    `json:"requested"`
+	Available int    `json:"available"`
+	Location  string `json:"location,omitempty"`
+}
+
+// insufficientStockError is returned when one or more products do not have enough stock
+type insufficientStockError struct {
+	Items []stockShortage
+}
+
+func (e *insufficientStockError) Error() string {
+	return fmt.Sprintf("Insufficient stock for %d item(s)", len(e.Items))
+}
+
+// stockRow is a locked inventory row for a single product and location
+type stockRow struct {
+	Location string
+	Stock    int
+}
+
+// reserveStock decrements inventory for every purchased product inside the given transaction.
+// Rows are locked with SELECT ... FOR UPDATE in product order so concurrent orders serialize
+// on the same rows instead of deadlocking, and stock is re-read after the lock is acquired so
+// two orders can never both take the last unit. The fulfillment policy chooses the locations,
+// using as few shipments as it can; when location is set, everything ships from there.
+func reserveStock(tx *sql.Tx, items []PurchaseItem, location, billingAddress string) (fulfillment.Allocation, error) {
+	lines := make([]fulfillment.Line, 0, len(items))
+	productIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		lines = append(lines, fulfillment.Line{ProductID: item.ProductID, Quantity: item.Quantity})
+		productIDs = append(productIDs, item.ProductID)
+	}
+	sort.Strings(productIDs)
+
+	stock := make(fulfillment.Stock)
+	for _, productID := range productIDs {
+		rows, err := lockStockRows(tx, productID)
+		if err != nil {
+			return fulfillment.Allocation{}, err
+		}
+		for _, row := range rows {
+			if location != "" && row.Location != location {
+				continue
+			}
+			if stock[row.Location] == nil {
+				stock[row.Location] = make(map[string]int)
+			}
+			stock[row.Location][productID] = row.Stock
+		}
+	}
+
+	allocation, err := fulfillment.Allocate(lines, stock, billingAddress)
+	if err != nil {
+		var shortage *fulfillment.ShortageError
+		if errors.As(err, &shortage) {
+			shortages := make([]stockShortage, 0, len(shortage.Items))
+			for _, item := range shortage.Items {
+				shortages = append(shortages, stockShortage{
+					ProductID: item.ProductID,
+					Requested: item.Requested,
+					Available: item.Available,
+					Location:  location,
+				})
+			}
+			return fulfillment.Allocation{}, &insufficientStockError{Items: shortages}
+		}
+		return fulfillment.Allocation{}, err
+	}
+
+	for _, shipment := range allocation.Shipments {
+		for _, item := range shipment.Items {
+			previous := stock[shipment.Location][item.ProductID]
+			newStock := previous - item.Quantity
+
+			_, err := tx.Exec(`
+				UPDATE inventory
+				SET stock = $1, updated_at = CURRENT_TIMESTAMP
+				WHERE product_id = $2 AND location = $3
+			`, newStock, item.ProductID, shipment.Location)
+			if err != nil {
+				return fulfillment.Allocation{}, fmt.Errorf("failed to decrement stock for product %s: %w", item.ProductID, err)
+			}
+
+			_, err = tx.Exec(`
+				INSERT INTO inventory_events (product_id, event_type, quantity_change, previous_stock, new_stock, location)
+				VALUES ($1, $2, $3, $4, $5, $6)
+			`, item.ProductID, "order", -item.Quantity, previous, newStock, shipment.Location)
+			if err != nil {
+				return fulfillment.Allocation{}, fmt.Errorf("failed to log order event for product %s: %w", item.ProductID, err)
+			}
+
+			stock[shipment.Location][item.ProductID] = newStock
+		}
+	}
+
+	return allocation, nil
+}
+
+// lockStockRows locks and returns every inventory row for a product, ordered by location
+func lockStockRows(tx *sql.Tx, productID string) ([]stockRow, error) {
+	rows, err := tx.Query(`
+		SELECT location, stock
+		FROM inventory
+		WHERE product_id = $1
+		ORDER BY location
+		FOR UPDATE
+	`, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock inventory for product %s: %w", productID, err)
+	}
+	defer rows.Close()
+
+	var result []stockRow
+	for rows.Next() {
+		var row stockRow
+		if err := rows.Scan(&row.Location, &row.Stock); err != nil {
+			return nil, fmt.Errorf("failed to scan inventory for product %s: %w", productID, err)
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating inventory for product %s: %w", productID, err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,834 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"invisimart-api/db"
+	"invisimart-api/money"
+	"invisimart-api/outbox"
+	"invisimart-api/webhooks"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultWebhookMaxAttempts = 8
+	webhookBatchSize          = 50
+	inventoryScanBatchSize    = 500
+	maxDeliveryErrorLength    = 1000
+	defaultDeliveryListLimit  = 50
+	maxDeliveryListLimit      = 200
+
+	// inventoryEventsCursor names the webhook_cursors row that tracks inventory_events
+	inventoryEventsCursor = "inventory_events"
+)
+
+// subscriptionColumns is the column list read by scanSubscription
+const subscriptionColumns = `id, url, event_types, COALESCE(description, ''), active, created_at, updated_at`
+
+// deliveryColumns is the column list read by scanDelivery
+const deliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts,
+	next_attempt_at, last_attempt_at, last_response_status, COALESCE(last_error, ''), delivered_at, created_at`
+
+// WebhookDelivery is one entry in a subscription's delivery log
+type WebhookDelivery struct {
+	ID                 int             `json:"id"`
+	SubscriptionID     int             `json:"subscriptionId"`
+	EventID            string          `json:"eventId"`
+	EventType          string          `json:"eventType"`
+	Payload            json.RawMessage `json:"payload"`
+	Status             string          `json:"status"`
+	Attempts           int             `json:"attempts"`
+	NextAttemptAt      string          `json:"nextAttemptAt,omitempty"`
+	LastAttemptAt      string          `json:"lastAttemptAt,omitempty"`
+	LastResponseStatus *int            `json:"lastResponseStatus,omitempty"`
+	LastError          string          `json:"lastError,omitempty"`
+	DeliveredAt        string          `json:"deliveredAt,omitempty"`
+	CreatedAt          string          `json:"createdAt"`
+}
+
+// orderCreatedEvent is the data of an order.created webhook. Customer contact and payment
+// details are deliberately left out.
+type orderCreatedEvent struct {
+	OrderID  string              `json:"orderId"`
+	Status   string              `json:"status"`
+	Total    money.Money         `json:"total"`
+	Currency string              `json:"currency"`
+	Items    []orderCreatedEntry `json:"items"`
+}
+
+type orderCreatedEntry struct {
+	ProductID   string      `json:"productId"`
+	ProductName string      `json:"productName"`
+	Quantity    int         `json:"quantity"`
+	UnitPrice   money.Money `json:"unitPrice"`
+	Location    string      `json:"location,omitempty"`
+}
+
+// orderStatusChangedEvent is the payload of the order.status_changed outbox event and webhook
+type orderStatusChangedEvent struct {
+	OrderID    string `json:"orderId"`
+	FromStatus string `json:"fromStatus"`
+	ToStatus   string `json:"toStatus"`
+	ChangedBy  string `json:"changedBy"`
+	Note       string `json:"note,omitempty"`
+}
+
+// stockEvent is the data of the inventory.* webhooks
+type stockEvent struct {
+	ProductID     string `json:"productId"`
+	Location      string `json:"location"`
+	PreviousStock int    `json:"previousStock"`
+	NewStock      int    `json:"newStock"`
+	Threshold     int    `json:"threshold"`
+	Reason        string `json:"reason"`
+	OccurredAt    string `json:"occurredAt"`
+}
+
+// WebhookDispatchInterval is how often pending deliveries and new inventory events are processed
+func WebhookDispatchInterval() time.Duration {
+	return durationFromEnv("WEBHOOK_DISPATCH_INTERVAL", 5*time.Second)
+}
+
+// webhookMaxAttempts is how many times a delivery is tried before it is marked failed
+func webhookMaxAttempts() int {
+	value := os.Getenv("WEBHOOK_MAX_ATTEMPTS")
+	if value == "" {
+		return defaultWebhookMaxAttempts
+	}
+	attempts, err := strconv.Atoi(value)
+	if err != nil || attempts <= 0 {
+		log.Printf("Invalid WEBHOOK_MAX_ATTEMPTS %q, using %d", value, defaultWebhookMaxAttempts)
+		return defaultWebhookMaxAttempts
+	}
+	return attempts
+}
+
+// publishWebhookEvent queues an event for every active subscription that wants it. It runs in
+// the caller's transaction, so an event is only delivered if the change that caused it commits.
+func publishWebhookEvent(tx *sql.Tx, eventType string, data interface{}) error {
+	eventID := uuid.New().String()
+	payload, err := webhooks.NewEvent(eventID, eventType, data)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+		SELECT id, $1::uuid, $2::varchar, $3::jsonb
+		FROM webhook_subscriptions
+		WHERE active AND (cardinality(event_types) = 0 OR $2::varchar = ANY(event_types))
+	`, eventID, eventType, string(payload))
+	if err != nil {
+		return fmt.Errorf("failed to queue %s webhook: %w", eventType, err)
+	}
+	return nil
+}
+
+// publishOrderCreatedWebhook turns an order.placed outbox event into the order.created webhook
+func publishOrderCreatedWebhook(ctx context.Context, tx *sql.Tx, msg outbox.Message) error {
+	var event orderPlacedEvent
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		return fmt.Errorf("failed to decode order event: %w", err)
+	}
+
+	entries := make([]orderCreatedEntry, 0, len(event.Items))
+	for _, item := range event.Items {
+		entries = append(entries, orderCreatedEntry{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			Location:    item.Location,
+		})
+	}
+
+	return publishWebhookEvent(tx, webhooks.EventOrderCreated, orderCreatedEvent{
+		OrderID:  event.OrderID,
+		Status:   event.Status,
+		Total:    event.Pricing.Total,
+		Currency: event.Currency,
+		Items:    entries,
+	})
+}
+
+// publishStatusChangedWebhook forwards an order.status_changed outbox event to subscribers
+func publishStatusChangedWebhook(ctx context.Context, tx *sql.Tx, msg outbox.Message) error {
+	var event orderStatusChangedEvent
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		return fmt.Errorf("failed to decode status event: %w", err)
+	}
+	return publishWebhookEvent(tx, webhooks.EventOrderStatusChanged, event)
+}
+
+// scanSubscription reads a subscription selected with subscriptionColumns
+func scanSubscription(row rowScanner) (*webhooks.Subscription, error) {
+	var s webhooks.Subscription
+	var createdAt, updatedAt time.Time
+	if err := row.Scan(&s.ID, &s.URL, pq.Array(&s.EventTypes), &s.Description, &s.Active, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	if s.EventTypes == nil {
+		s.EventTypes = []string{}
+	}
+	s.CreatedAt = createdAt.Format(time.RFC3339)
+	s.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &s, nil
+}
+
+// scanDelivery reads a delivery selected with deliveryColumns
+func scanDelivery(row rowScanner) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	var payload []byte
+	var nextAttemptAt, createdAt time.Time
+	var lastAttemptAt, deliveredAt sql.NullTime
+	var lastStatus sql.NullInt64
+	err := row.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+		&nextAttemptAt, &lastAttemptAt, &lastStatus, &d.LastError, &deliveredAt, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Payload = payload
+	if d.Status == webhooks.DeliveryPending {
+		d.NextAttemptAt = nextAttemptAt.Format(time.RFC3339)
+	}
+	if lastAttemptAt.Valid {
+		d.LastAttemptAt = lastAttemptAt.Time.Format(time.RFC3339)
+	}
+	if lastStatus.Valid {
+		status := int(lastStatus.Int64)
+		d.LastResponseStatus = &status
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = deliveredAt.Time.Format(time.RFC3339)
+	}
+	d.CreatedAt = createdAt.Format(time.RFC3339)
+	return &d, nil
+}
+
+// ListWebhooksHandler returns every webhook subscription, newest first. Secrets are not included.
+func ListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to list webhooks", err)
+		return
+	}
+
+	rows, err := database.Query(`SELECT ` + subscriptionColumns + ` FROM webhook_subscriptions ORDER BY created_at DESC, id DESC`)
+	if err != nil {
+		writeInternalError(w, r, "Failed to list webhooks", err)
+		return
+	}
+	defer rows.Close()
+
+	list := []*webhooks.Subscription{}
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			writeInternalError(w, r, "Failed to list webhooks", err)
+			return
+		}
+		list = append(list, subscription)
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// GetWebhookHandler returns a single webhook subscription by ID
+func GetWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to retrieve webhook", err)
+		return
+	}
+
+	subscription, err := scanSubscription(database.QueryRow(`SELECT `+subscriptionColumns+` FROM webhook_subscriptions WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		writeNotFound(w, r, "Webhook not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, "Failed to retrieve webhook", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, subscription)
+}
+
+// CreateWebhookHandler registers a webhook subscription. A signing secret is generated unless
+// one is supplied, and is returned only in this response.
+func CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	subscription, ok := decodeSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	secret := subscription.Secret
+	if secret == "" {
+		var err error
+		if secret, err = webhooks.GenerateSecret(); err != nil {
+			writeInternalError(w, r, "Failed to create webhook", err)
+			return
+		}
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to create webhook", err)
+		return
+	}
+
+	created, err := scanSubscription(database.QueryRow(`
+		INSERT INTO webhook_subscriptions (url, event_types, secret, description, active)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		RETURNING `+subscriptionColumns,
+		subscription.URL, pq.Array(subscription.EventTypes), secret, subscription.Description, subscription.Active))
+	if err != nil {
+		writeInternalError(w, r, "Failed to create webhook", err)
+		return
+	}
+	created.Secret = secret
+
+	log.Printf("Webhook created - ID: %d, URL: %s", created.ID, created.URL)
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// UpdateWebhookHandler replaces a subscription's URL, event filter, description and active
+// flag. The secret is rotated only when a new one is supplied.
+func UpdateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	subscription, ok := decodeSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to update webhook", err)
+		return
+	}
+
+	updated, err := scanSubscription(database.QueryRow(`
+		UPDATE webhook_subscriptions
+		SET url = $1, event_types = $2, secret = COALESCE(NULLIF($3, ''), secret),
+			description = NULLIF($4, ''), active = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $6
+		RETURNING `+subscriptionColumns,
+		subscription.URL, pq.Array(subscription.EventTypes), subscription.Secret, subscription.Description,
+		subscription.Active, id))
+	if err == sql.ErrNoRows {
+		writeNotFound(w, r, "Webhook not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, "Failed to update webhook", err)
+		return
+	}
+
+	log.Printf("Webhook updated - ID: %d", updated.ID)
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// DeleteWebhookHandler removes a subscription along with its delivery log
+func DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to delete webhook", err)
+		return
+	}
+
+	result, err := database.Exec(`DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		writeInternalError(w, r, "Failed to delete webhook", err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		writeNotFound(w, r, "Webhook not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeliveriesHandler returns a subscription's delivery log, newest first. It can be
+// filtered by status and accepts a limit of up to 200.
+func ListWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	status := params.Get("status")
+	switch status {
+	case "", webhooks.DeliveryPending, webhooks.DeliverySucceeded, webhooks.DeliveryFailed:
+	default:
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "status must be pending, succeeded or failed")
+		return
+	}
+
+	limit := defaultDeliveryListLimit
+	if value := params.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(parsed, maxDeliveryListLimit)
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to list webhook deliveries", err)
+		return
+	}
+
+	var exists bool
+	if err := database.QueryRow(`SELECT EXISTS (SELECT 1 FROM webhook_subscriptions WHERE id = $1)`, id).Scan(&exists); err != nil {
+		writeInternalError(w, r, "Failed to list webhook deliveries", err)
+		return
+	}
+	if !exists {
+		writeNotFound(w, r, "Webhook not found")
+		return
+	}
+
+	rows, err := database.Query(`
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries
+		WHERE subscription_id = $1 AND ($2::varchar = '' OR status = $2::varchar)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`, id, status, limit)
+	if err != nil {
+		writeInternalError(w, r, "Failed to list webhook deliveries", err)
+		return
+	}
+	defer rows.Close()
+
+	list := []*WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			writeInternalError(w, r, "Failed to list webhook deliveries", err)
+			return
+		}
+		list = append(list, delivery)
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// ReplayWebhookDeliveryHandler puts a failed delivery back in the queue with a fresh set of
+// attempts. The original payload, event ID and signature scheme are reused, so receivers can
+// deduplicate on the event ID.
+func ReplayWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["deliveryId"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid delivery ID")
+		return
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to replay webhook delivery", err)
+		return
+	}
+
+	delivery, err := scanDelivery(database.QueryRow(`
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = 0, next_attempt_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND status = $3
+		RETURNING `+deliveryColumns,
+		webhooks.DeliveryPending, id, webhooks.DeliveryFailed))
+	if err == sql.ErrNoRows {
+		var status string
+		err = database.QueryRow(`SELECT status FROM webhook_deliveries WHERE id = $1`, id).Scan(&status)
+		if err == sql.ErrNoRows {
+			writeNotFound(w, r, "Webhook delivery not found")
+			return
+		}
+		if err != nil {
+			writeInternalError(w, r, "Failed to replay webhook delivery", err)
+			return
+		}
+		writeError(w, r, http.StatusConflict, CodeConflict,
+			fmt.Sprintf("Only failed deliveries can be replayed; this delivery is %s", status))
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, "Failed to replay webhook delivery", err)
+		return
+	}
+
+	log.Printf("Webhook delivery queued for replay - ID: %d, Event: %s", delivery.ID, delivery.EventType)
+	writeJSON(w, http.StatusAccepted, delivery)
+}
+
+// ReplayFailedWebhooksHandler puts every failed delivery of a subscription back in the queue
+func ReplayFailedWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	database, err := db.GetDB()
+	if err != nil {
+		writeInternalError(w, r, "Failed to replay webhook deliveries", err)
+		return
+	}
+
+	var exists bool
+	if err := database.QueryRow(`SELECT EXISTS (SELECT 1 FROM webhook_subscriptions WHERE id = $1)`, id).Scan(&exists); err != nil {
+		writeInternalError(w, r, "Failed to replay webhook deliveries", err)
+		return
+	}
+	if !exists {
+		writeNotFound(w, r, "Webhook not found")
+		return
+	}
+
+	result, err := database.Exec(`
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = 0, next_attempt_at = CURRENT_TIMESTAMP
+		WHERE subscription_id = $2 AND status = $3
+	`, webhooks.DeliveryPending, id, webhooks.DeliveryFailed)
+	if err != nil {
+		writeInternalError(w, r, "Failed to replay webhook deliveries", err)
+		return
+	}
+	replayed, _ := result.RowsAffected()
+
+	log.Printf("Webhook deliveries queued for replay - Subscription: %d, Count: %d", id, replayed)
+	writeJSON(w, http.StatusAccepted, map[string]int64{"replayed": replayed})
+}
+
+// webhookID parses the {id} path variable, writing a 400 if it is not a number
+func webhookID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid webhook ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// decodeSubscription reads and validates a subscription from the request body, writing a 400 on failure
+func decodeSubscription(w http.ResponseWriter, r *http.Request) (*webhooks.Subscription, bool) {
+	var subscription webhooks.Subscription
+	subscription.Active = true
+	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+		writeInvalidBody(w, r, err)
+		return nil, false
+	}
+	if err := subscription.Validate(); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid webhook: "+err.Error())
+		return nil, false
+	}
+	if subscription.EventTypes == nil {
+		subscription.EventTypes = []string{}
+	}
+	return &subscription, true
+}
+
+// writeJSON writes body as a JSON response
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// pendingDelivery is a claimed delivery and the subscription it is addressed to
+type pendingDelivery struct {
+	ID        int
+	EventType string
+	Payload   []byte
+	Attempts  int
+	URL       string
+	Secret    string
+}
+
+// DeliverWebhooks sends one batch of due deliveries. Rows are claimed with SKIP LOCKED, so
+// several API instances can dispatch concurrently without sending the same attempt twice.
+// Deliveries of inactive subscriptions wait until the subscription is reactivated.
+func DeliverWebhooks(ctx context.Context) (int, error) {
+	database, err := db.GetDB()
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start webhook dispatch: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT d.id, d.event_type, d.payload, d.attempts, s.url, s.secret
+		FROM webhook_deliveries d
+		JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.status = $1 AND d.next_attempt_at <= NOW() AND s.active
+		ORDER BY d.next_attempt_at, d.id
+		LIMIT $2
+		FOR UPDATE OF d SKIP LOCKED
+	`, webhooks.DeliveryPending, webhookBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+
+	var batch []pendingDelivery
+	for rows.Next() {
+		var d pendingDelivery
+		if err := rows.Scan(&d.ID, &d.EventType, &d.Payload, &d.Attempts, &d.URL, &d.Secret); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to read webhook delivery: %w", err)
+		}
+		batch = append(batch, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read webhook deliveries: %w", err)
+	}
+
+	maxAttempts := webhookMaxAttempts()
+	for _, d := range batch {
+		status, sendErr := webhooks.Send(ctx, d.URL, d.Secret, strconv.Itoa(d.ID), d.EventType, d.Payload)
+		if err := recordDeliveryAttempt(tx, d, status, sendErr, maxAttempts); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to record webhook attempts: %w", err)
+	}
+	return len(batch), nil
+}
+
+// recordDeliveryAttempt stores the outcome of one attempt and schedules the next one, or marks
+// the delivery failed once it has used maxAttempts
+func recordDeliveryAttempt(tx *sql.Tx, d pendingDelivery, responseStatus int, sendErr error, maxAttempts int) error {
+	attempts := d.Attempts + 1
+	var lastStatus sql.NullInt64
+	if responseStatus != 0 {
+		lastStatus = sql.NullInt64{Int64: int64(responseStatus), Valid: true}
+	}
+
+	if sendErr == nil {
+		_, err := tx.Exec(`
+			UPDATE webhook_deliveries
+			SET status = $1, attempts = $2, last_attempt_at = NOW(), last_response_status = $3,
+				last_error = NULL, delivered_at = NOW()
+			WHERE id = $4
+		`, webhooks.DeliverySucceeded, attempts, lastStatus, d.ID)
+		if err != nil {
+			return fmt.Errorf("failed to record webhook delivery %d: %w", d.ID, err)
+		}
+		return nil
+	}
+
+	message := sendErr.Error()
+	if len(message) > maxDeliveryErrorLength {
+		message = message[:maxDeliveryErrorLength]
+	}
+
+	status := webhooks.DeliveryPending
+	if attempts >= maxAttempts {
+		status = webhooks.DeliveryFailed
+		log.Printf("Webhook delivery %d (%s) failed after %d attempts: %v", d.ID, d.EventType, attempts, sendErr)
+	}
+
+	_, err := tx.Exec(`
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, last_attempt_at = NOW(), last_response_status = $3, last_error = $4,
+			next_attempt_at = NOW() + $5::integer * INTERVAL '1 second'
+		WHERE id = $6
+	`, status, attempts, lastStatus, message, int64(webhooks.Backoff(attempts).Seconds()), d.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery %d: %w", d.ID, err)
+	}
+	return nil
+}
+
+// PublishInventoryWebhooks turns new inventory_events rows that cross the low-stock threshold
+// into webhook events. inventory_events is written by both the API and the inventory service,
+// so it is read with a cursor rather than hooked at each write. The first run starts from the
+// newest event instead of replaying history.
+func PublishInventoryWebhooks(ctx context.Context) (int, error) {
+	database, err := db.GetDB()
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start inventory scan: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The inventory service creates inventory_events on startup; until then there is nothing to read
+	var tableExists bool
+	if err := tx.QueryRow(`SELECT to_regclass('inventory_events') IS NOT NULL`).Scan(&tableExists); err != nil {
+		return 0, fmt.Errorf("failed to check for inventory events: %w", err)
+	}
+	if !tableExists {
+		return 0, nil
+	}
+
+	var lastID int64
+	err = tx.QueryRow(`SELECT last_id FROM webhook_cursors WHERE name = $1 FOR UPDATE`, inventoryEventsCursor).Scan(&lastID)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = tx.Exec(`
+			INSERT INTO webhook_cursors (name, last_id)
+			SELECT $1, COALESCE(MAX(id), 0) FROM inventory_events
+			ON CONFLICT (name) DO NOTHING
+		`, inventoryEventsCursor)
+		if err != nil {
+			return 0, fmt.Errorf("failed to start inventory cursor: %w", err)
+		}
+		return 0, tx.Commit()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read inventory cursor: %w", err)
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, product_id, event_type, previous_stock, new_stock, location, created_at
+		FROM inventory_events
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2
+	`, lastID, inventoryScanBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read inventory events: %w", err)
+	}
+
+	var events []stockEvent
+	var eventTypes []string
+	for rows.Next() {
+		var event stockEvent
+		var createdAt time.Time
+		if err := rows.Scan(&lastID, &event.ProductID, &event.Reason, &event.PreviousStock, &event.NewStock,
+			&event.Location, &createdAt); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to read inventory event: %w", err)
+		}
+		eventType := webhooks.StockEvent(event.PreviousStock, event.NewStock, defaultLowStockThreshold)
+		if eventType == "" {
+			continue
+		}
+		event.Threshold = defaultLowStockThreshold
+		event.OccurredAt = createdAt.Format(time.RFC3339)
+		events = append(events, event)
+		eventTypes = append(eventTypes, eventType)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read inventory events: %w", err)
+	}
+
+	for i, event := range events {
+		if err := publishWebhookEvent(tx, eventTypes[i], event); err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE webhook_cursors SET last_id = $1, updated_at = CURRENT_TIMESTAMP WHERE name = $2
+	`, lastID, inventoryEventsCursor)
+	if err != nil {
+		return 0, fmt.Errorf("failed to advance inventory cursor: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to publish inventory webhooks: %w", err)
+	}
+	return len(events), nil
+}
+
+// StartWebhookDispatcher publishes inventory webhooks and sends due deliveries every interval
+// until ctx is cancelled
+func StartWebhookDispatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := PublishInventoryWebhooks(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Webhook inventory scan failed: %v", err)
+			}
+			sent, err := DeliverWebhooks(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Webhook dispatch failed: %v", err)
+				}
+				continue
+			}
+			if sent > 0 {
+				log.Printf("Webhook dispatcher made %d delivery attempt(s)", sent)
+			}
+		}
+	}
+}
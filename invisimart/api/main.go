@@ -10,9 +10,18 @@ import (
 	"syscall"
 	"time"
 
+	"invisimart-api/adminauth"
 	"invisimart-api/db"
+	"invisimart-api/fraud"
+	"invisimart-api/fulfillment"
 	"invisimart-api/handlers"
 	"invisimart-api/middleware"
+	"invisimart-api/notifications"
+	"invisimart-api/orderid"
+	"invisimart-api/ordertoken"
+	"invisimart-api/outbox"
+	"invisimart-api/payments"
+	"invisimart-api/pricing"
 	"invisimart-api/vault"
 
 	"github.com/gorilla/mux"
@@ -26,7 +35,7 @@ func main() {
 	if vaultAddr != "" {
 		if err := vault.InitVault(); err != nil {
 			log.Printf("Warning: Failed to initialize Vault client: %v", err)
-			log.Printf("Vault integration will be unavailable. Set VAULT_ADDR and VAULT_TOKEN to enable.")
+			log.Printf("Vault integration will be unavailable. Set VAULT_ADDR and the credentials for VAULT_AUTH_METHOD to enable.")
 		} else {
 			log.Println("Vault client initialized successfully")
 		}
@@ -34,13 +43,60 @@ func main() {
 		log.Println("VAULT_ADDR not set. Vault integration disabled.")
 	}
 
+	// Load checkout pricing rules (tax and shipping); defaults to no tax and free shipping
+	if err := pricing.Init(os.Getenv("PRICING_CONFIG")); err != nil {
+		log.Fatalf("Failed to load pricing config: %v", err)
+	}
+
+	// Load the fraud screening rules; defaults to the built-in rules
+	if err := fraud.Init(os.Getenv("FRAUD_CONFIG"), os.Getenv("FRAUD_HASH_SECRET")); err != nil {
+		log.Fatalf("Failed to load fraud config: %v", err)
+	}
+
+	// Load the fulfillment policy that picks which locations ship each order; defaults to most stock
+	if err := fulfillment.Init(os.Getenv("FULFILLMENT_CONFIG")); err != nil {
+		log.Fatalf("Failed to load fulfillment config: %v", err)
+	}
+
+	// Select the payment processor; defaults to the local fake gateway
+	if err := payments.Init(os.Getenv("PAYMENT_PROCESSOR")); err != nil {
+		log.Fatalf("Failed to configure payment processor: %v", err)
+	}
+	log.Printf("Payment processor: %s", payments.Current().Name())
+
+	// Select the order ID format; dated IDs unless ORDER_ID_GENERATOR says otherwise
+	if err := orderid.Init(os.Getenv("ORDER_ID_GENERATOR")); err != nil {
+		log.Fatalf("Failed to configure order ID generator: %v", err)
+	}
+
+	// Guest order lookups accept a signed token issued with each order
+	if err := ordertoken.Init(os.Getenv("ORDER_LOOKUP_SECRET"), handlers.OrderLookupTokenTTL()); err != nil {
+		log.Fatalf("Failed to configure order lookup tokens: %v", err)
+	}
+
+	// Authenticated admin endpoints accept the bearer tokens in ADMIN_API_TOKENS
+	if err := adminauth.Init(os.Getenv("ADMIN_API_TOKENS")); err != nil {
+		log.Fatalf("Failed to configure admin API tokens: %v", err)
+	}
+
+	// Configure the transport for order emails; disabled unless MAIL_TRANSPORT is set
+	if err := notifications.Init(); err != nil {
+		log.Fatalf("Failed to configure mail transport: %v", err)
+	}
+
 	// Create a new Gorilla Mux router
 	r := mux.NewRouter()
 
-	// Apply middleware in order: logging first, then CORS
+	// Apply middleware in order: request ID first so every log line and error can carry it,
+	// then logging, then CORS
+	r.Use(middleware.RequestIDMiddleware)
 	r.Use(middleware.LoggingMiddleware)
 	r.Use(middleware.CORSMiddleware)
 
+	// Unmatched routes bypass router middleware, so tag them with a request ID here
+	r.NotFoundHandler = middleware.RequestIDMiddleware(http.HandlerFunc(handlers.NotFoundHandler))
+	r.MethodNotAllowedHandler = middleware.RequestIDMiddleware(http.HandlerFunc(handlers.MethodNotAllowedHandler))
+
 	// Define routes with proper HTTP methods
 	r.HandleFunc("/health", handlers.HealthHandler).Methods("GET")
 	r.HandleFunc("/", handlers.RootHandler).Methods("GET")
@@ -53,6 +109,59 @@ func main() {
 	// Purchase endpoints
 	r.HandleFunc("/purchase", handlers.CreatePurchaseHandler).Methods("POST", "OPTIONS")
 	r.HandleFunc("/purchase", handlers.GetPurchaseHandler).Methods("GET")
+	r.HandleFunc("/purchase/{orderId}/receipt", handlers.GetReceiptHandler).Methods("GET")
+	r.HandleFunc("/purchase/{orderId}/status", handlers.UpdatePurchaseStatusHandler).Methods("PATCH", "OPTIONS")
+	r.HandleFunc("/purchase/{orderId}/cancel", handlers.CancelPurchaseHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/purchase/{orderId}/refund", handlers.RefundPurchaseHandler).Methods("POST", "OPTIONS")
+
+	// Authenticated admin purchase endpoints
+	r.HandleFunc("/admin/purchases", handlers.ListPurchasesHandler).Methods("GET")
+	r.HandleFunc("/admin/purchases/{orderId}", handlers.GetAdminPurchaseHandler).Methods("GET")
+	r.HandleFunc("/admin/purchases/{orderId}/reveal", handlers.RevealPurchaseFieldsHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/admin/purchases/{orderId}/approve", handlers.ApprovePurchaseHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/admin/purchases/{orderId}/reject", handlers.RejectPurchaseHandler).Methods("POST", "OPTIONS")
+
+	// Promotion admin endpoints
+	r.HandleFunc("/admin/promotions", handlers.ListPromotionsHandler).Methods("GET")
+	r.HandleFunc("/admin/promotions", handlers.CreatePromotionHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/admin/promotions/{id}", handlers.GetPromotionHandler).Methods("GET")
+	r.HandleFunc("/admin/promotions/{id}", handlers.UpdatePromotionHandler).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/admin/promotions/{id}", handlers.DeletePromotionHandler).Methods("DELETE", "OPTIONS")
+
+	// Webhook admin endpoints
+	r.HandleFunc("/admin/webhooks", handlers.ListWebhooksHandler).Methods("GET")
+	r.HandleFunc("/admin/webhooks", handlers.CreateWebhookHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/admin/webhooks/deliveries/{deliveryId}/replay", handlers.ReplayWebhookDeliveryHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/admin/webhooks/{id}", handlers.GetWebhookHandler).Methods("GET")
+	r.HandleFunc("/admin/webhooks/{id}", handlers.UpdateWebhookHandler).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/admin/webhooks/{id}", handlers.DeleteWebhookHandler).Methods("DELETE", "OPTIONS")
+	r.HandleFunc("/admin/webhooks/{id}/deliveries", handlers.ListWebhookDeliveriesHandler).Methods("GET")
+	r.HandleFunc("/admin/webhooks/{id}/replay", handlers.ReplayFailedWebhooksHandler).Methods("POST", "OPTIONS")
+
+	// Cart endpoints
+	r.HandleFunc("/carts", handlers.CreateCartHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/carts/{id}", handlers.GetCartHandler).Methods("GET")
+	r.HandleFunc("/carts/{id}/items", handlers.AddCartItemHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/carts/{id}/items/{productId}", handlers.UpdateCartItemHandler).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/carts/{id}/items/{productId}", handlers.RemoveCartItemHandler).Methods("DELETE", "OPTIONS")
+	r.HandleFunc("/carts/{id}/checkout", handlers.CheckoutCartHandler).Methods("POST", "OPTIONS")
+
+	// Expire idle carts in the background until shutdown
+	sweeperCtx, stopSweeper := context.WithCancel(context.Background())
+	go handlers.StartCartSweeper(sweeperCtx, handlers.CartSweepInterval())
+
+	// Dispatch purchase side effects (emails, webhooks) from the outbox until shutdown
+	handlers.RegisterOutboxHandlers()
+	outboxCtx, stopOutbox := context.WithCancel(context.Background())
+	go outbox.Start(outboxCtx, handlers.OutboxDispatchInterval(), handlers.OutboxRetention())
+
+	// Deliver queued webhooks and publish stock threshold events until shutdown
+	webhookCtx, stopWebhooks := context.WithCancel(context.Background())
+	go handlers.StartWebhookDispatcher(webhookCtx, handlers.WebhookDispatchInterval())
+
+	// Keep the Vault token renewed, logging in again when it expires, until shutdown
+	vaultCtx, stopVault := context.WithCancel(context.Background())
+	go vault.Start(vaultCtx)
 
 	// Create HTTP server
 	server := &http.Server{
@@ -73,6 +182,10 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Server is shutting down...")
+	stopSweeper()
+	stopWebhooks()
+	stopOutbox()
+	stopVault()
 
 	// Give outstanding requests a deadline for completion
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -60,11 +60,12 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 		duration := time.Since(start)
 
 		// Log basic request information
-		log.Printf("method=%s path=%s status=%d duration=%v",
+		log.Printf("method=%s path=%s status=%d duration=%v request_id=%s",
 			r.Method,
 			r.URL.Path,
 			rw.statusCode,
 			duration,
+			RequestID(r),
 		)
 
 		// Log response body in debug mode
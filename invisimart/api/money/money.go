@@ -0,0 +1,292 @@
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is assumed for values that carry no currency of their own, such as
+// NUMERIC columns and plain JSON numbers
+const DefaultCurrency = "USD"
+
+// minorDigits is the number of decimal places stored for every currency. It matches the
+// NUMERIC(10,2) columns in the database.
+const minorDigits = 2
+
+// minorPerMajor is 10^minorDigits
+const minorPerMajor = 100
+
+// exponents are the ISO 4217 minor unit exponents of the currencies that do not have two
+// decimal places. Currencies with three cannot be stored and are refused by ValidCurrency.
+var exponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0,
+	"RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// Exponent returns the number of decimal places a currency is quoted and rounded to: 0 for
+// JPY or KRW, 2 for USD or EUR
+func Exponent(currency string) int {
+	if exponent, ok := exponents[currency]; ok {
+		return exponent
+	}
+	return minorDigits
+}
+
+// minorUnit returns how many stored minor units make one minor unit of currency: 100 for JPY,
+// where amounts are stored to two places but counted in whole yen
+func minorUnit(currency string) int64 {
+	unit := int64(1)
+	for i := Exponent(currency); i < minorDigits; i++ {
+		unit *= 10
+	}
+	return unit
+}
+
+// decimalPattern matches the plain decimal notation accepted by Parse
+var decimalPattern = regexp.MustCompile(`^[+-]?[0-9]+(\.[0-9]+)?$`)
+
+// Money is an exact amount in integer minor units (cents) plus an ISO 4217 currency code.
+// Minor is always in hundredths of the major unit, as stored in the database; amounts in a
+// currency with fewer decimal places, such as JPY, are kept to whole multiples of its own
+// minor unit. The zero value is zero in no particular currency and combines with any currency.
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+// New returns an amount of minor units in the given currency
+func New(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+// Parse converts a decimal string such as "24.99" or "-3.5" into Money. Digits beyond the
+// currency's exponent are rounded with Round.
+func Parse(value, currency string) (Money, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Money{}, fmt.Errorf("empty amount")
+	}
+
+	if !decimalPattern.MatchString(value) {
+		return Money{}, fmt.Errorf("invalid amount %q", value)
+	}
+	rat, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount %q", value)
+	}
+
+	minor, ok := roundMinor(new(big.Rat).Mul(rat, big.NewRat(minorPerMajor, 1)), currency)
+	if !ok {
+		return Money{}, fmt.Errorf("amount %q is out of range", value)
+	}
+	return Money{Minor: minor, Currency: currency}, nil
+}
+
+// MustParse is like Parse but panics on error. It is intended for constants.
+func MustParse(value, currency string) Money {
+	m, err := Parse(value, currency)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Round rounds an amount expressed in minor units to a whole number of minor units,
+// half away from zero. Every rounding of money in the API goes through this function.
+func Round(minor *big.Rat) *big.Int {
+	num := new(big.Int).Set(minor.Num())
+	den := minor.Denom()
+
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	// Compare 2*|rem| with den to decide whether to round away from zero
+	twiceRem := new(big.Int).Abs(rem)
+	twiceRem.Lsh(twiceRem, 1)
+	if twiceRem.Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	return quo
+}
+
+// roundMinor rounds an amount in stored minor units to a whole number of the currency's minor
+// units with Round, reporting false if it does not fit in an int64
+func roundMinor(minor *big.Rat, currency string) (int64, bool) {
+	unit := big.NewInt(minorUnit(currency))
+	rounded := Round(new(big.Rat).Quo(minor, new(big.Rat).SetInt(unit)))
+	rounded.Mul(rounded, unit)
+	return rounded.Int64(), rounded.IsInt64()
+}
+
+// IsZero reports whether the amount is zero
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+// Equal reports whether two amounts are equal in value and currency
+func (m Money) Equal(other Money) bool {
+	return m.Minor == other.Minor && m.currencyOf(other) == other.currencyOf(m)
+}
+
+// Cmp compares two amounts in the same currency, returning -1, 0 or +1
+func (m Money) Cmp(other Money) int {
+	m.mustMatch(other)
+	switch {
+	case m.Minor < other.Minor:
+		return -1
+	case m.Minor > other.Minor:
+		return 1
+	}
+	return 0
+}
+
+// Add returns m + other. Both amounts must be in the same currency.
+func (m Money) Add(other Money) Money {
+	return Money{Minor: m.Minor + other.Minor, Currency: m.mustMatch(other)}
+}
+
+// Sub returns m - other. Both amounts must be in the same currency.
+func (m Money) Sub(other Money) Money {
+	return Money{Minor: m.Minor - other.Minor, Currency: m.mustMatch(other)}
+}
+
+// Mul returns m multiplied by a whole quantity
+func (m Money) Mul(quantity int64) Money {
+	return Money{Minor: m.Minor * quantity, Currency: m.Currency}
+}
+
+// MulRat returns m multiplied by an exact ratio, rounded with Round to the currency's exponent
+func (m Money) MulRat(ratio *big.Rat) Money {
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Minor), ratio)
+	minor, _ := roundMinor(product, m.Currency)
+	return Money{Minor: minor, Currency: m.Currency}
+}
+
+// In returns the same amount labelled with another currency. It is for amounts read from
+// NUMERIC columns whose currency is stored alongside; use Rate.Convert to convert.
+func (m Money) In(currency string) Money {
+	return Money{Minor: m.Minor, Currency: currency}
+}
+
+// Negate returns -m
+func (m Money) Negate() Money {
+	return Money{Minor: -m.Minor, Currency: m.Currency}
+}
+
+// Decimal formats the amount as a plain decimal string with the currency's exponent, such as
+// "24.99", or "1500" in JPY
+func (m Money) Decimal() string {
+	sign := ""
+	minor := m.Minor
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	major, fraction := minor/minorPerMajor, minor%minorPerMajor
+
+	// An amount that was not rounded to its currency, such as a stored value labelled with
+	// In, keeps two places rather than losing digits
+	places, unit := minorDigits, minorUnit(m.Currency)
+	if unit > 1 && fraction%unit == 0 {
+		places, fraction = Exponent(m.Currency), fraction/unit
+	}
+	if places == 0 {
+		return fmt.Sprintf("%s%d", sign, major)
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, major, places, fraction)
+}
+
+// String formats the amount with its currency, for logs and messages
+func (m Money) String() string {
+	currency := m.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return m.Decimal() + " " + currency
+}
+
+// MarshalJSON encodes the amount as an exact JSON number such as 24.99. The currency is
+// reported separately by the enclosing type.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.Decimal()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a decimal string. The text is parsed exactly,
+// never through float64. The currency is set to DefaultCurrency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		*m = Money{}
+		return nil
+	}
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := Parse(text, DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner for NUMERIC columns. The currency is set to DefaultCurrency.
+func (m *Money) Scan(src interface{}) error {
+	var text string
+	switch v := src.(type) {
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	case int64:
+		text = strconv.FormatInt(v, 10)
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		*m = Money{}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+
+	parsed, err := Parse(text, DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value implements driver.Valuer, writing the amount as a decimal string for NUMERIC columns
+func (m Money) Value() (driver.Value, error) {
+	return m.Decimal(), nil
+}
+
+// currencyOf returns m's currency, or other's when m is a currency-less zero value
+func (m Money) currencyOf(other Money) string {
+	if m.Currency == "" {
+		return other.Currency
+	}
+	return m.Currency
+}
+
+// mustMatch returns the shared currency of two amounts, panicking if they differ. Mixing
+// currencies is a programming error; convert first.
+func (m Money) mustMatch(other Money) string {
+	a, b := m.currencyOf(other), other.currencyOf(m)
+	if a != b {
+		panic(fmt.Sprintf("money: currency mismatch %s vs %s", a, b))
+	}
+	return a
+}
@@ -0,0 +1,239 @@
+package money
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		minor string
+		want  int64
+	}{
+		{"0", 0},
+		{"7", 7},
+		{"1/2", 1},
+		{"-1/2", -1},
+		{"3/2", 2},
+		{"-3/2", -2},
+		{"5/2", 3},
+		{"-5/2", -3},
+		{"49/100", 0},
+		{"-49/100", 0},
+		{"51/100", 1},
+		{"-51/100", -1},
+		{"1249/10", 125},
+		{"-1249/10", -125},
+		{"1/3", 0},
+		{"2/3", 1},
+		{"-2/3", -1},
+	}
+	for _, tt := range tests {
+		minor, ok := new(big.Rat).SetString(tt.minor)
+		if !ok {
+			t.Fatalf("bad test value %q", tt.minor)
+		}
+		if got := Round(minor); got.Int64() != tt.want {
+			t.Errorf("Round(%s) = %s, want %d", tt.minor, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "24.99", want: 2499},
+		{value: "24.9", want: 2490},
+		{value: "24", want: 2400},
+		{value: " 24.99 ", want: 2499},
+		{value: "-3.5", want: -350},
+		{value: "+1.01", want: 101},
+		{value: "0.005", want: 1},
+		{value: "0.0049", want: 0},
+		{value: "-0.005", want: -1},
+		{value: "19.995", want: 2000},
+		{value: "", wantErr: true},
+		{value: "1e3", wantErr: true},
+		{value: "1/2", wantErr: true},
+		{value: ".5", wantErr: true},
+		{value: "1.", wantErr: true},
+		{value: "abc", wantErr: true},
+		{value: "99999999999999999999", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.value, "USD")
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) = %v, want error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %v", tt.value, err)
+			continue
+		}
+		if got != New(tt.want, "USD") {
+			t.Errorf("Parse(%q) = %+v, want %d minor units", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		minor int64
+		want  string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{2499, "24.99"},
+		{-2499, "-24.99"},
+		{100000, "1000.00"},
+	}
+	for _, tt := range tests {
+		if got := New(tt.minor, "USD").Decimal(); got != tt.want {
+			t.Errorf("Decimal(%d) = %q, want %q", tt.minor, got, tt.want)
+		}
+	}
+}
+
+func TestZeroDecimalCurrencies(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		want     int64
+		decimal  string
+	}{
+		{"1500", "JPY", 150000, "1500"},
+		{"1500.4", "JPY", 150000, "1500"},
+		{"1500.5", "JPY", 150100, "1501"},
+		{"-1500.5", "JPY", -150100, "-1501"},
+		{"0.49", "KRW", 0, "0"},
+		{"24.99", "EUR", 2499, "24.99"},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.value, tt.currency)
+		if err != nil {
+			t.Errorf("Parse(%q, %s) returned error: %v", tt.value, tt.currency, err)
+			continue
+		}
+		if got != New(tt.want, tt.currency) {
+			t.Errorf("Parse(%q, %s) = %+v, want %d minor units", tt.value, tt.currency, got, tt.want)
+		}
+		if decimal := got.Decimal(); decimal != tt.decimal {
+			t.Errorf("Parse(%q, %s).Decimal() = %q, want %q", tt.value, tt.currency, decimal, tt.decimal)
+		}
+	}
+
+	// A stored amount that was never rounded to whole yen keeps its cents
+	if got := New(150050, "JPY").Decimal(); got != "1500.50" {
+		t.Errorf("Decimal of unrounded yen = %q, want %q", got, "1500.50")
+	}
+	// 8% of 1,999 yen is 159.92
+	if got := New(199900, "JPY").MulRat(big.NewRat(2, 25)); got != New(16000, "JPY") {
+		t.Errorf("8%% of 1999 JPY = %+v, want 160 JPY", got)
+	}
+}
+
+func TestValidCurrency(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"USD", true},
+		{"JPY", true},
+		{"KRW", true},
+		{"BHD", false},
+		{"KWD", false},
+		{"usd", false},
+		{"US", false},
+	}
+	for _, tt := range tests {
+		if got := ValidCurrency(tt.code); got != tt.want {
+			t.Errorf("ValidCurrency(%q) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestMulRat(t *testing.T) {
+	tests := []struct {
+		minor int64
+		ratio string
+		want  int64
+	}{
+		// 8.25% tax on 19.99 is 1.649175
+		{1999, "33/400", 165},
+		// Half a cent rounds away from zero in both directions
+		{1, "1/2", 1},
+		{-1, "1/2", -1},
+		{2499, "1/3", 833},
+		{1000, "0", 0},
+	}
+	for _, tt := range tests {
+		ratio, _ := new(big.Rat).SetString(tt.ratio)
+		if got := New(tt.minor, "USD").MulRat(ratio); got != New(tt.want, "USD") {
+			t.Errorf("%d * %s = %+v, want %d", tt.minor, tt.ratio, got, tt.want)
+		}
+	}
+}
+
+func TestArithmeticCurrencies(t *testing.T) {
+	usd := New(100, "USD")
+	if got := usd.Add(Money{}); got != usd {
+		t.Errorf("adding the zero value = %+v, want %+v", got, usd)
+	}
+	if got := (Money{}).Sub(usd); got != New(-100, "USD") {
+		t.Errorf("zero value minus 1.00 USD = %+v, want -1.00 USD", got)
+	}
+	if !usd.Equal(New(100, "USD")) || usd.Equal(New(100, "EUR")) {
+		t.Error("Equal must compare both value and currency")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("adding USD to EUR did not panic")
+		}
+	}()
+	usd.Add(New(100, "EUR"))
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    int64
+		wantErr bool
+	}{
+		{json: `24.99`, want: 2499},
+		{json: `"24.99"`, want: 2499},
+		{json: `0.1`, want: 10},
+		{json: `null`, want: 0},
+		{json: `1e2`, wantErr: true},
+		{json: `"x"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		var got Money
+		err := json.Unmarshal([]byte(tt.json), &got)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("unmarshal %s = %+v, want error", tt.json, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unmarshal %s returned error: %v", tt.json, err)
+			continue
+		}
+		if got.Minor != tt.want {
+			t.Errorf("unmarshal %s = %d minor units, want %d", tt.json, got.Minor, tt.want)
+		}
+	}
+
+	encoded, err := json.Marshal(New(-1050, "USD"))
+	if err != nil || string(encoded) != "-10.50" {
+		t.Errorf("marshal -10.50 = %s, %v", encoded, err)
+	}
+}
@@ -0,0 +1,72 @@
+package money
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// currencyPattern matches an ISO 4217 currency code
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// ValidCurrency reports whether code looks like an ISO 4217 currency code such as "EUR" that
+// amounts can be held in. Currencies with three decimal places, such as BHD, are refused,
+// since amounts are stored to two.
+func ValidCurrency(code string) bool {
+	return currencyPattern.MatchString(code) && Exponent(code) <= minorDigits
+}
+
+// Rate is an exchange rate: one unit of From is worth Value units of To
+type Rate struct {
+	From  string
+	To    string
+	Value *big.Rat
+}
+
+// Identity returns the rate that converts currency to itself
+func Identity(currency string) Rate {
+	return Rate{From: currency, To: currency, Value: big.NewRat(1, 1)}
+}
+
+// ParseRate reads a rate given as a decimal string such as "0.9215"
+func ParseRate(from, to, value string) (Rate, error) {
+	rate, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok || rate.Sign() <= 0 {
+		return Rate{}, fmt.Errorf("invalid exchange rate %q for %s/%s", value, from, to)
+	}
+	return Rate{From: from, To: to, Value: rate}, nil
+}
+
+// IsIdentity reports whether the rate leaves amounts unchanged
+func (r Rate) IsIdentity() bool {
+	return r.From == r.To
+}
+
+// Inverse returns the rate from To back to From
+func (r Rate) Inverse() Rate {
+	return Rate{From: r.To, To: r.From, Value: new(big.Rat).Inv(r.Value)}
+}
+
+// Then returns the rate that applies r and then next, whose From must be r's To
+func (r Rate) Then(next Rate) Rate {
+	if r.To != next.From {
+		panic(fmt.Sprintf("money: cannot chain %s/%s with %s/%s", r.From, r.To, next.From, next.To))
+	}
+	return Rate{From: r.From, To: next.To, Value: new(big.Rat).Mul(r.Value, next.Value)}
+}
+
+// Convert converts an amount in From to To, rounding with Round to To's exponent. A
+// currency-less zero value converts to zero in To.
+func (r Rate) Convert(m Money) Money {
+	Money{Currency: r.From}.mustMatch(m)
+	if r.IsIdentity() {
+		return m.In(r.To)
+	}
+	return m.In(r.To).MulRat(r.Value)
+}
+
+// String formats the rate with eight decimal places, as stored in the database
+func (r Rate) String() string {
+	return r.Value.FloatString(8)
+}
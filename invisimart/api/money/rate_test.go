@@ -0,0 +1,101 @@
+package money
+
+import "testing"
+
+func TestRateConvert(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  string
+		minor int64
+		want  int64
+	}{
+		{"exact", "0.5", 2000, 1000},
+		{"rounds down", "0.9215", 1999, 1842},
+		{"rounds up", "1.0851", 1999, 2169},
+		// 0.5 * 1 cent is exactly half a cent
+		{"half away from zero", "0.5", 1, 1},
+		{"negative half away from zero", "0.5", -1, -1},
+		{"large rate", "151.2345", 1999, 302318},
+		{"zero", "0.9215", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := ParseRate("USD", "EUR", tt.rate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := rate.Convert(New(tt.minor, "USD"))
+			if got != New(tt.want, "EUR") {
+				t.Errorf("%s * %d = %+v, want %d EUR", tt.rate, tt.minor, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateConvertZeroDecimalCurrency(t *testing.T) {
+	rate, err := ParseRate("USD", "JPY", "151.2345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 19.99 USD is 3023.177655 JPY, which rounds to whole yen
+	if got := rate.Convert(New(1999, "USD")); got != New(302300, "JPY") {
+		t.Errorf("19.99 USD = %+v, want 3023 JPY", got)
+	}
+	// And back, 3023 JPY is 19.9888... USD
+	if got := rate.Inverse().Convert(New(302300, "JPY")); got != New(1999, "USD") {
+		t.Errorf("3023 JPY = %+v, want 19.99 USD", got)
+	}
+}
+
+func TestRateIdentityAndZeroValue(t *testing.T) {
+	if got := Identity("EUR").Convert(New(1234, "EUR")); got != New(1234, "EUR") {
+		t.Errorf("identity conversion = %+v", got)
+	}
+
+	rate, _ := ParseRate("USD", "EUR", "0.9215")
+	if got := rate.Convert(Money{}); got != New(0, "EUR") {
+		t.Errorf("converting the zero value = %+v, want 0 EUR", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("converting GBP with a USD/EUR rate did not panic")
+		}
+	}()
+	rate.Convert(New(100, "GBP"))
+}
+
+func TestRateInverseAndThen(t *testing.T) {
+	rate, _ := ParseRate("USD", "EUR", "0.9215")
+
+	inverse := rate.Inverse()
+	if inverse.From != "EUR" || inverse.To != "USD" || inverse.String() != "1.08518719" {
+		t.Errorf("inverse = %s/%s %s, want EUR/USD 1.08518719", inverse.From, inverse.To, inverse)
+	}
+	if roundTrip := rate.Then(inverse); roundTrip.String() != "1.00000000" || roundTrip.From != "USD" || roundTrip.To != "USD" {
+		t.Errorf("rate then inverse = %s/%s %s, want USD/USD 1", roundTrip.From, roundTrip.To, roundTrip)
+	}
+
+	gbp, _ := ParseRate("EUR", "GBP", "0.85")
+	if chained := rate.Then(gbp); chained.From != "USD" || chained.To != "GBP" || chained.String() != "0.78327500" {
+		t.Errorf("chained = %s/%s %s, want USD/GBP 0.78327500", chained.From, chained.To, chained)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("chaining mismatched rates did not panic")
+		}
+	}()
+	rate.Then(rate)
+}
+
+func TestParseRate(t *testing.T) {
+	for _, value := range []string{"0", "-1", "abc", ""} {
+		if _, err := ParseRate("USD", "EUR", value); err == nil {
+			t.Errorf("ParseRate(%q) succeeded, want error", value)
+		}
+	}
+	if rate, err := ParseRate("USD", "EUR", " 0.9215 "); err != nil || rate.String() != "0.92150000" {
+		t.Errorf("ParseRate with spaces = %v, %v", rate, err)
+	}
+}
@@ -0,0 +1,57 @@
+package notifications
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// defaultMaildir is used when MAILDIR_PATH is not set
+const defaultMaildir = "maildir"
+
+// MaildirMailer writes each message as a file in a Maildir, so local development can inspect
+// outgoing mail with any mail client, or just cat, instead of running a mail server
+type MaildirMailer struct {
+	Dir      string
+	hostname string
+	seq      atomic.Uint64
+}
+
+// NewMaildirMailer creates the tmp, new and cur folders under dir if they do not exist
+func NewMaildirMailer(dir string) (*MaildirMailer, error) {
+	if dir == "" {
+		dir = defaultMaildir
+	}
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create maildir %s: %w", dir, err)
+		}
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	return &MaildirMailer{Dir: dir, hostname: hostname}, nil
+}
+
+// Send writes msg to tmp and then moves it into new, so readers never see a partial message
+func (m *MaildirMailer) Send(msg Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d.P%dQ%d.%s", time.Now().UnixNano(), os.Getpid(), m.seq.Add(1), m.hostname)
+	tmpPath := filepath.Join(m.Dir, "tmp", name)
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(m.Dir, "new", name)); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to deliver message: %w", err)
+	}
+	return nil
+}
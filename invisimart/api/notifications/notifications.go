@@ -0,0 +1,93 @@
+package notifications
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Mail transports selectable with MAIL_TRANSPORT
+const (
+	TransportNone    = "none"
+	TransportSMTP    = "smtp"
+	TransportMaildir = "maildir"
+)
+
+const defaultFrom = "Invisimart <orders@invisimart.local>"
+
+// Message is a rendered email ready for a Mailer. OrderID names the order the email is
+// about in logs, which never show the recipient's address.
+type Message struct {
+	From     string
+	To       string
+	Subject  string
+	TextBody string
+	HTMLBody string
+	OrderID  string
+}
+
+// Mailer delivers a message through a mail transport
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var (
+	mailer   Mailer
+	fromAddr = defaultFrom
+)
+
+// Init configures the mail transport from the environment. MAIL_TRANSPORT is "smtp",
+// "maildir" or "none" (the default, which disables email).
+func Init() error {
+	transport := strings.ToLower(os.Getenv("MAIL_TRANSPORT"))
+
+	switch transport {
+	case "", TransportNone:
+		log.Println("MAIL_TRANSPORT not set. Order emails disabled.")
+		return nil
+	case TransportSMTP:
+		smtpMailer, err := NewSMTPMailerFromEnv()
+		if err != nil {
+			return err
+		}
+		mailer = smtpMailer
+	case TransportMaildir:
+		maildir, err := NewMaildirMailer(os.Getenv("MAILDIR_PATH"))
+		if err != nil {
+			return err
+		}
+		mailer = maildir
+	default:
+		return fmt.Errorf("unknown mail transport %q", transport)
+	}
+
+	if from := os.Getenv("MAIL_FROM"); from != "" {
+		fromAddr = from
+	}
+
+	log.Printf("Order emails enabled via %s transport", transport)
+	return nil
+}
+
+// Enabled reports whether a mail transport is configured
+func Enabled() bool {
+	return mailer != nil
+}
+
+// Send delivers a message through the configured transport. It blocks until the transport
+// accepts the message, so callers that must not wait should send from a background worker.
+// When email is disabled the message is discarded.
+func Send(msg Message) error {
+	if mailer == nil {
+		return nil
+	}
+	if msg.From == "" {
+		msg.From = fromAddr
+	}
+	if err := mailer.Send(msg); err != nil {
+		return err
+	}
+	log.Printf("Email sent - OrderID: %s", msg.OrderID)
+	return nil
+}
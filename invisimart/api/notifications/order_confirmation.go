@@ -0,0 +1,88 @@
+package notifications
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"invisimart-api/money"
+)
+
+//go:embed templates/*
+var templateFS embed.FS
+
+var (
+	confirmationText = texttemplate.Must(texttemplate.New("order_confirmation.txt").
+				ParseFS(templateFS, "templates/order_confirmation.txt"))
+	confirmationHTML = htmltemplate.Must(htmltemplate.New("order_confirmation.html").
+				ParseFS(templateFS, "templates/order_confirmation.html"))
+)
+
+// OrderLine is one item on an order confirmation
+type OrderLine struct {
+	Name      string
+	Quantity  int
+	UnitPrice money.Money
+	Subtotal  money.Money
+}
+
+// OrderConfirmation is the data rendered into the order confirmation email. MaskedCard must
+// already be masked; the full card number never reaches this package.
+type OrderConfirmation struct {
+	OrderID        string
+	CustomerName   string
+	CustomerEmail  string
+	Items          []OrderLine
+	Subtotal       money.Money
+	Discount       money.Money
+	PromoCode      string
+	Shipping       money.Money
+	ShippingMethod string
+	Tax            money.Money
+	Total          money.Money
+	MaskedCard     string
+	PlacedAt       time.Time
+}
+
+// MaskCard hides every digit of a card number except the last four
+func MaskCard(number string) string {
+	if len(number) <= 4 {
+		return strings.Repeat("*", len(number))
+	}
+	return "**** " + number[len(number)-4:]
+}
+
+// RenderOrderConfirmation builds the confirmation email for an order
+func RenderOrderConfirmation(order OrderConfirmation) (Message, error) {
+	var text, html bytes.Buffer
+	if err := confirmationText.Execute(&text, order); err != nil {
+		return Message{}, fmt.Errorf("failed to render text template: %w", err)
+	}
+	if err := confirmationHTML.Execute(&html, order); err != nil {
+		return Message{}, fmt.Errorf("failed to render HTML template: %w", err)
+	}
+
+	return Message{
+		To:       order.CustomerEmail,
+		Subject:  fmt.Sprintf("Your Invisimart order %s", order.OrderID),
+		TextBody: text.String(),
+		HTMLBody: html.String(),
+		OrderID:  order.OrderID,
+	}, nil
+}
+
+// SendOrderConfirmation renders the confirmation email and sends it
+func SendOrderConfirmation(order OrderConfirmation) error {
+	if !Enabled() {
+		return nil
+	}
+	msg, err := RenderOrderConfirmation(order)
+	if err != nil {
+		return err
+	}
+	return Send(msg)
+}
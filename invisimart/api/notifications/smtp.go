@@ -0,0 +1,110 @@
+package notifications
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"time"
+)
+
+// smtpTimeout bounds a whole SMTP session, so an unresponsive relay cannot stall the sender
+const smtpTimeout = 30 * time.Second
+
+// SMTPMailer sends mail through an SMTP relay. The connection is upgraded with STARTTLS when
+// the server offers it.
+type SMTPMailer struct {
+	Host string
+	Port string
+	Auth smtp.Auth
+}
+
+// NewSMTPMailerFromEnv configures an SMTPMailer from SMTP_HOST, SMTP_PORT (default 587),
+// SMTP_USERNAME and SMTP_PASSWORD. Authentication is skipped when no username is set.
+func NewSMTPMailerFromEnv() (*SMTPMailer, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil, errors.New("SMTP_HOST is required for the smtp mail transport")
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	mailer := &SMTPMailer{Host: host, Port: port}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		mailer.Auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return mailer, nil
+}
+
+// Send delivers msg to the relay
+func (m *SMTPMailer) Send(msg Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	from, err := envelopeAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender: %w", err)
+	}
+	to, err := envelopeAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+
+	addr := net.JoinHostPort(m.Host, m.Port)
+	if err := m.send(addr, from, to, data); err != nil {
+		return fmt.Errorf("smtp delivery to %s failed: %w", addr, err)
+	}
+	return nil
+}
+
+// send runs one SMTP session. It follows smtp.SendMail, which has no timeout of its own.
+func (m *SMTPMailer) send(addr, from, to string, data []byte) error {
+	conn, err := net.DialTimeout("tcp", addr, smtpTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.Host}); err != nil {
+			return err
+		}
+	}
+	if m.Auth != nil {
+		if err := client.Auth(m.Auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
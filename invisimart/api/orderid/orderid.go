@@ -0,0 +1,176 @@
+package orderid
+
+import (
+	"crypto/rand"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Prefix starts every order ID
+const Prefix = "INV-"
+
+// Generator names selectable with Init
+const (
+	DatedGeneratorName  = "dated"
+	LegacyGeneratorName = "legacy"
+)
+
+// alphabet is Crockford's base32: digits and capitals without I, L, O and U, so IDs read
+// aloud or copied by hand are hard to get wrong
+const alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// bodyLength is the number of random characters, 40 bits, in a dated ID
+const bodyLength = 8
+
+var (
+	// datedPattern matches a dated ID such as INV-261017-YYDV16E08: UTC date, random body,
+	// then one check character
+	datedPattern = regexp.MustCompile(`^INV-(\d{6})-([0-9A-HJKMNP-TV-Z]{9})$`)
+	// legacyPattern matches IDs issued before dated IDs: eight hex digits from a UUID
+	legacyPattern = regexp.MustCompile(`^INV-[0-9a-f]{8}$`)
+)
+
+// Error explains why an order ID was rejected. Its message is safe to show to customers.
+type Error struct {
+	ID     string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Invalid order ID %q: %s", e.ID, e.Reason)
+}
+
+// Generator creates candidate order IDs. Uniqueness is enforced by the database, so callers
+// retry with a new ID when an insert collides.
+type Generator interface {
+	Name() string
+	Generate(now time.Time) (string, error)
+}
+
+// DatedGenerator issues IDs with a UTC date prefix, a random base32 body and a check character
+type DatedGenerator struct{}
+
+// Name returns the generator name
+func (DatedGenerator) Name() string {
+	return DatedGeneratorName
+}
+
+// Generate returns a new dated order ID
+func (DatedGenerator) Generate(now time.Time) (string, error) {
+	random := make([]byte, bodyLength*5/8)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate order ID: %w", err)
+	}
+
+	// Read the random bytes five bits at a time
+	body := make([]byte, bodyLength)
+	var bits uint64
+	for _, b := range random {
+		bits = bits<<8 | uint64(b)
+	}
+	for i := bodyLength - 1; i >= 0; i-- {
+		body[i] = alphabet[bits&31]
+		bits >>= 5
+	}
+
+	date := now.UTC().Format("060102")
+	payload := date + string(body)
+	return fmt.Sprintf("%s%s-%s%c", Prefix, date, body, checkCharacter(payload)), nil
+}
+
+// LegacyGenerator issues the original INV- plus eight hex digits format
+type LegacyGenerator struct{}
+
+// Name returns the generator name
+func (LegacyGenerator) Name() string {
+	return LegacyGeneratorName
+}
+
+// Generate returns a new legacy order ID
+func (LegacyGenerator) Generate(time.Time) (string, error) {
+	return Prefix + uuid.New().String()[:8], nil
+}
+
+var (
+	mu        sync.RWMutex
+	generator Generator = DatedGenerator{}
+)
+
+// Init selects the generator by name. An empty name selects the dated generator.
+func Init(name string) error {
+	var g Generator
+	switch strings.ToLower(name) {
+	case "", DatedGeneratorName:
+		g = DatedGenerator{}
+	case LegacyGeneratorName:
+		g = LegacyGenerator{}
+	default:
+		return fmt.Errorf("unknown order ID generator %q", name)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	generator = g
+	return nil
+}
+
+// Current returns the configured generator
+func Current() Generator {
+	mu.RLock()
+	defer mu.RUnlock()
+	return generator
+}
+
+// Normalize validates an order ID and returns it in canonical form. Dated IDs are matched
+// case-insensitively, with O read as 0 and I or L as 1, and their check character must
+// match, which catches any single mistyped character and most swapped pairs. Legacy IDs are
+// accepted as issued.
+func Normalize(id string) (string, error) {
+	id = strings.TrimSpace(id)
+	if legacyPattern.MatchString(id) {
+		return id, nil
+	}
+
+	canonical := strings.ToUpper(id)
+	if rest, ok := strings.CutPrefix(canonical, Prefix); ok {
+		canonical = Prefix + strings.NewReplacer("O", "0", "I", "1", "L", "1").Replace(rest)
+	}
+
+	match := datedPattern.FindStringSubmatch(canonical)
+	if match == nil {
+		return "", &Error{ID: id, Reason: "expected the format INV-YYMMDD-XXXXXXXXX"}
+	}
+	if !validCheck(match[1] + match[2]) {
+		return "", &Error{ID: id, Reason: "check character does not match; please check for typos"}
+	}
+	return canonical, nil
+}
+
+// checkCharacter computes the Luhn mod 32 check character of a payload in the alphabet
+func checkCharacter(payload string) byte {
+	const n = len(alphabet)
+	factor, sum := 2, 0
+	for i := len(payload) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(alphabet, payload[i])
+		sum += addend/n + addend%n
+		factor = 3 - factor
+	}
+	return alphabet[(n-sum%n)%n]
+}
+
+// validCheck reports whether a payload ending in its check character is consistent
+func validCheck(payload string) bool {
+	const n = len(alphabet)
+	factor, sum := 1, 0
+	for i := len(payload) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(alphabet, payload[i])
+		sum += addend/n + addend%n
+		factor = 3 - factor
+	}
+	return sum%n == 0
+}
@@ -0,0 +1,143 @@
+package orderid
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateRoundTrips(t *testing.T) {
+	now := time.Date(2026, time.October, 17, 23, 30, 0, 0, time.FixedZone("PDT", -7*60*60))
+	for i := 0; i < 1000; i++ {
+		id, err := DatedGenerator{}.Generate(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The date is the UTC date, which is already the 18th
+		if !strings.HasPrefix(id, "INV-261018-") {
+			t.Fatalf("Generate() = %q, want an INV-261018- prefix", id)
+		}
+		got, err := Normalize(id)
+		if err != nil {
+			t.Fatalf("Normalize(%q) returned error: %v", id, err)
+		}
+		if got != id {
+			t.Fatalf("Normalize(%q) = %q, want it unchanged", id, got)
+		}
+		if lower, err := Normalize(strings.ToLower(id)); err != nil || lower != id {
+			t.Fatalf("Normalize(%q) = %q, %v, want %q", strings.ToLower(id), lower, err, id)
+		}
+	}
+}
+
+func TestSingleCharacterTyposRejected(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		id, err := DatedGenerator{}.Generate(time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for pos := len(Prefix); pos < len(id); pos++ {
+			if id[pos] == '-' {
+				continue
+			}
+			for _, c := range []byte(alphabet) {
+				if c == id[pos] {
+					continue
+				}
+				typo := id[:pos] + string(c) + id[pos+1:]
+				if _, err := Normalize(typo); err == nil {
+					t.Fatalf("Normalize(%q) accepted a typo of %q at position %d", typo, id, pos)
+				}
+			}
+		}
+	}
+}
+
+func TestCheckCharacter(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    byte
+	}{
+		{"26101700000000", '2'},
+		// Each payload differs from the one above in a single character
+		{"26101700000001", '0'},
+		{"26101700000010", '1'},
+		{"26101710000000", '1'},
+		// 2*31 = 62 is 1*32 + 30, so a doubled Z adds 1 + 30
+		{"261017ZZZZZZZZ", 'A'},
+		{"261017YYDV16E0", '8'},
+	}
+	for _, tt := range tests {
+		if got := checkCharacter(tt.payload); got != tt.want {
+			t.Errorf("checkCharacter(%q) = %c, want %c", tt.payload, got, tt.want)
+		}
+		if !validCheck(tt.payload + string(tt.want)) {
+			t.Errorf("validCheck(%q) = false", tt.payload+string(tt.want))
+		}
+	}
+
+	// Every other check character is wrong
+	for _, c := range []byte(alphabet) {
+		if c != '8' && validCheck("261017YYDV16E0"+string(c)) {
+			t.Errorf("validCheck accepted check character %c", c)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	valid := "INV-261017-" + "YYDV16E0" + string(checkCharacter("261017YYDV16E0"))
+	tests := []struct {
+		id      string
+		want    string
+		wantErr bool
+	}{
+		{id: valid, want: valid},
+		{id: "  " + valid + "\n", want: valid},
+		{id: strings.ToLower(valid), want: valid},
+		// O is read as 0, and I and L as 1
+		{id: "INV-261017-YYDV16EO" + valid[len(valid)-1:], want: valid},
+		{id: "INV-26IO17-YYDVI6EO" + valid[len(valid)-1:], want: valid},
+		{id: "inv-26lo17-yydvl6eo" + strings.ToLower(valid[len(valid)-1:]), want: valid},
+		{id: "INV-1a2b3c4d", want: "INV-1a2b3c4d"},
+		{id: "INV-1A2B3C4D", wantErr: true},
+		{id: "INV-1a2b3c4", wantErr: true},
+		// U is not in the alphabet and is not read as anything else
+		{id: "INV-261017-UUUUUUUUU", wantErr: true},
+		{id: "INV-261017-YYDV16E0", wantErr: true},
+		{id: "261017-YYDV16E08", wantErr: true},
+		{id: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Normalize(tt.id)
+		if tt.wantErr {
+			var invalid *Error
+			if !errors.As(err, &invalid) {
+				t.Errorf("Normalize(%q) = %q, %v, want an *Error", tt.id, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Normalize(%q) = %q, %v, want %q", tt.id, got, err, tt.want)
+		}
+	}
+}
+
+func TestInit(t *testing.T) {
+	defer Init("")
+	for _, name := range []string{"", "dated", "DATED", "legacy"} {
+		if err := Init(name); err != nil {
+			t.Errorf("Init(%q) returned error: %v", name, err)
+		}
+	}
+	if Current().Name() != LegacyGeneratorName {
+		t.Errorf("Current() = %s after Init(legacy)", Current().Name())
+	}
+	id, _ := Current().Generate(time.Now())
+	if got, err := Normalize(id); err != nil || got != id {
+		t.Errorf("legacy ID %q does not round-trip: %q, %v", id, got, err)
+	}
+	if err := Init("sequential"); err == nil {
+		t.Error("Init(sequential) succeeded, want error")
+	}
+}
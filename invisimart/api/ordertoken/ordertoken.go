@@ -0,0 +1,113 @@
+package ordertoken
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minSecretLength is the shortest signing secret Init accepts
+const minSecretLength = 32
+
+// Errors returned by Verify. Only ErrExpired means the token was genuine.
+var (
+	ErrInvalid = errors.New("lookup token is not valid for this order")
+	ErrExpired = errors.New("lookup token has expired")
+)
+
+// ErrNotConfigured is returned by Issue and Verify before Init has set a secret
+var ErrNotConfigured = errors.New("lookup tokens are not configured")
+
+var (
+	mu     sync.RWMutex
+	secret []byte
+	ttl    time.Duration
+)
+
+// Init sets the secret used to sign lookup tokens and how long tokens stay valid. Without a
+// secret a random one is generated, so tokens stop working when the API restarts and are not
+// accepted by other instances.
+func Init(key string, lifetime time.Duration) error {
+	if lifetime <= 0 {
+		return fmt.Errorf("lookup token lifetime must be positive, got %v", lifetime)
+	}
+
+	var signingKey []byte
+	switch {
+	case key == "":
+		signingKey = make([]byte, minSecretLength)
+		if _, err := rand.Read(signingKey); err != nil {
+			return fmt.Errorf("failed to generate lookup token secret: %w", err)
+		}
+		log.Println("ORDER_LOOKUP_SECRET not set. Lookup tokens will not survive a restart.")
+	case len(key) < minSecretLength:
+		return fmt.Errorf("lookup token secret must be at least %d characters", minSecretLength)
+	default:
+		signingKey = []byte(key)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	secret = signingKey
+	ttl = lifetime
+	return nil
+}
+
+// Issue returns a token that lets the holder look up orderID, and the time it expires. It
+// refuses to sign with an empty secret, so a token is never issued before Init.
+func Issue(orderID string, now time.Time) (string, time.Time, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if len(secret) == 0 {
+		return "", time.Time{}, ErrNotConfigured
+	}
+
+	expires := now.Add(ttl).Truncate(time.Second)
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	return expiry + "." + sign(secret, orderID, expiry), expires, nil
+}
+
+// Verify checks that token was issued for orderID and has not expired. Before Init it
+// returns ErrNotConfigured rather than checking against an empty secret.
+func Verify(orderID, token string, now time.Time) error {
+	expiry, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalid
+	}
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return ErrInvalid
+	}
+
+	mu.RLock()
+	key := secret
+	mu.RUnlock()
+	if len(key) == 0 {
+		return ErrNotConfigured
+	}
+
+	expected := sign(key, orderID, expiry)
+
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalid
+	}
+	if now.Unix() >= expires {
+		return ErrExpired
+	}
+	return nil
+}
+
+// sign returns the base64url HMAC-SHA256 of the order ID and expiry
+func sign(key []byte, orderID, expiry string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("order-lookup:" + orderID + ":" + expiry))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,124 @@
+package ordertoken
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "a-test-secret-that-is-at-least-32-chars"
+
+func setup(t *testing.T) {
+	t.Helper()
+	if err := Init(testSecret, time.Hour); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		secret, ttl = nil, 0
+	})
+}
+
+func TestVerify(t *testing.T) {
+	setup(t)
+	now := time.Unix(1700000000, 0)
+	token, expires, err := Issue("INV-231114-ABCDEFGH1", now)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if !expires.Equal(now.Add(time.Hour)) {
+		t.Errorf("Issue() expires = %v, want %v", expires, now.Add(time.Hour))
+	}
+
+	expiry, signature, _ := strings.Cut(token, ".")
+	tampered := signature[:len(signature)-1] + "A"
+	if tampered == signature {
+		tampered = signature[:len(signature)-1] + "B"
+	}
+
+	tests := []struct {
+		name    string
+		orderID string
+		token   string
+		now     time.Time
+		want    error
+	}{
+		{"valid", "INV-231114-ABCDEFGH1", token, now, nil},
+		{"valid until just before expiry", "INV-231114-ABCDEFGH1", token, expires.Add(-time.Second), nil},
+		{"wrong order", "INV-231114-ABCDEFGH2", token, now, ErrInvalid},
+		{"tampered signature", "INV-231114-ABCDEFGH1", expiry + "." + tampered, now, ErrInvalid},
+		{"extended expiry", "INV-231114-ABCDEFGH1", "1900000000." + signature, now, ErrInvalid},
+		{"no separator", "INV-231114-ABCDEFGH1", expiry + signature, now, ErrInvalid},
+		{"non-numeric expiry", "INV-231114-ABCDEFGH1", "soon." + signature, now, ErrInvalid},
+		{"expired", "INV-231114-ABCDEFGH1", token, expires, ErrExpired},
+		{"empty", "INV-231114-ABCDEFGH1", "", now, ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.orderID, tt.token, tt.now); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsOtherSecret(t *testing.T) {
+	setup(t)
+	now := time.Now()
+	token, _, err := Issue("INV-231114-ABCDEFGH1", now)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	if err := Init(strings.Repeat("x", minSecretLength), time.Hour); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	if err := Verify("INV-231114-ABCDEFGH1", token, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify() with another secret error = %v, want %v", err, ErrInvalid)
+	}
+}
+
+func TestNotConfigured(t *testing.T) {
+	mu.Lock()
+	secret, ttl = nil, 0
+	mu.Unlock()
+
+	if _, _, err := Issue("INV-231114-ABCDEFGH1", time.Now()); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Issue() before Init error = %v, want %v", err, ErrNotConfigured)
+	}
+	// A token signed with an empty key must not verify before Init
+	token := "1900000000." + sign(nil, "INV-231114-ABCDEFGH1", "1900000000")
+	if err := Verify("INV-231114-ABCDEFGH1", token, time.Now()); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Verify() before Init error = %v, want %v", err, ErrNotConfigured)
+	}
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		lifetime time.Duration
+		wantErr  bool
+	}{
+		{"configured secret", testSecret, time.Hour, false},
+		{"generated secret", "", time.Hour, false},
+		{"short secret", "too-short", time.Hour, true},
+		{"zero lifetime", testSecret, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() {
+				mu.Lock()
+				defer mu.Unlock()
+				secret, ttl = nil, 0
+			})
+			if err := Init(tt.key, tt.lifetime); (err != nil) != tt.wantErr {
+				t.Errorf("Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"invisimart-api/db"
+
+	"github.com/lib/pq"
+)
+
+const (
+	batchSize      = 50
+	initialBackoff = 5 * time.Second
+	maxBackoff     = 10 * time.Minute
+	maxErrorLength = 1000
+)
+
+// Message is a domain event read back from the outbox
+type Message struct {
+	ID          int64
+	EventType   string
+	AggregateID string
+	Payload     json.RawMessage
+	Attempts    int
+	CreatedAt   time.Time
+}
+
+// Handler reacts to an outbox message. It runs inside the transaction that claims the message,
+// under a savepoint, so database writes commit together with the message being marked done and are
+// rolled back if the handler fails. Side effects outside the database may be repeated, because
+// delivery is at-least-once.
+type Handler func(ctx context.Context, tx *sql.Tx, msg Message) error
+
+type registration struct {
+	name    string
+	handler Handler
+}
+
+var (
+	mu       sync.RWMutex
+	handlers = map[string][]registration{}
+)
+
+// Register subscribes a named handler to an event type. Names are recorded against each
+// message as its handler succeeds, so they must stay stable across releases.
+func Register(eventType, name string, handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, existing := range handlers[eventType] {
+		if existing.name == name {
+			panic(fmt.Sprintf("outbox handler %s already registered for %s", name, eventType))
+		}
+	}
+	handlers[eventType] = append(handlers[eventType], registration{name: name, handler: handler})
+}
+
+// registered returns the handlers subscribed to an event type
+func registered(eventType string) []registration {
+	mu.RLock()
+	defer mu.RUnlock()
+	return handlers[eventType]
+}
+
+// Write records an event in the caller's transaction. It is dispatched only if the
+// transaction commits, and is then retried until every handler has succeeded.
+func Write(tx *sql.Tx, eventType, aggregateID string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO outbox (event_type, aggregate_id, payload) VALUES ($1, $2, $3)
+	`, eventType, aggregateID, string(body))
+	if err != nil {
+		return fmt.Errorf("failed to write %s event to outbox: %w", eventType, err)
+	}
+	return nil
+}
+
+// Process dispatches up to one batch of due messages and returns how many were claimed. Each
+// message is claimed, handled and recorded in a transaction of its own, so a failure affects
+// only that message and never replays handlers that already ran for the others. Rows are
+// locked with SKIP LOCKED, so several API instances can dispatch concurrently without
+// handling the same message at the same time.
+func Process(ctx context.Context) (int, error) {
+	database, err := db.GetDB()
+	if err != nil {
+		return 0, err
+	}
+
+	for claimed := 0; claimed < batchSize; claimed++ {
+		found, err := processNext(ctx, database)
+		if err != nil {
+			return claimed, err
+		}
+		if !found {
+			return claimed, nil
+		}
+	}
+	return batchSize, nil
+}
+
+// processNext claims the oldest due message and dispatches it in one transaction. It reports
+// false when no message is due.
+func processNext(ctx context.Context, database *sql.DB) (bool, error) {
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to start outbox dispatch: %w", err)
+	}
+	defer tx.Rollback()
+
+	var msg Message
+	var payload []byte
+	var completed []string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, event_type, aggregate_id, payload, completed_handlers, attempts, created_at
+		FROM outbox
+		WHERE processed_at IS NULL AND available_at <= NOW()
+		ORDER BY id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`).Scan(&msg.ID, &msg.EventType, &msg.AggregateID, &payload, pq.Array(&completed), &msg.Attempts, &msg.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim outbox message: %w", err)
+	}
+	msg.Payload = payload
+
+	if err := dispatch(ctx, tx, msg, completed); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to record outbox progress for message %d: %w", msg.ID, err)
+	}
+	return true, nil
+}
+
+// dispatch runs every handler that has not yet succeeded for a message and records the
+// outcome. A failed handler is retried with backoff; handlers that succeeded are not run again.
+func dispatch(ctx context.Context, tx *sql.Tx, msg Message, completed []string) error {
+	done := make(map[string]bool, len(completed))
+	for _, name := range completed {
+		done[name] = true
+	}
+
+	var failure error
+	for _, reg := range registered(msg.EventType) {
+		if done[reg.name] {
+			continue
+		}
+		if err := runHandler(ctx, tx, reg, msg); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("Outbox handler %s failed for %s %s (message %d, attempt %d): %v",
+				reg.name, msg.EventType, msg.AggregateID, msg.ID, msg.Attempts+1, err)
+			failure = fmt.Errorf("%s: %w", reg.name, err)
+			continue
+		}
+		completed = append(completed, reg.name)
+	}
+
+	if failure == nil {
+		_, err := tx.Exec(`
+			UPDATE outbox
+			SET processed_at = NOW(), completed_handlers = $1, attempts = attempts + 1, last_error = NULL
+			WHERE id = $2
+		`, pq.Array(completed), msg.ID)
+		if err != nil {
+			return fmt.Errorf("failed to mark outbox message %d done: %w", msg.ID, err)
+		}
+		return nil
+	}
+
+	message := failure.Error()
+	if len(message) > maxErrorLength {
+		message = message[:maxErrorLength]
+	}
+	_, err := tx.Exec(`
+		UPDATE outbox
+		SET completed_handlers = $1, attempts = attempts + 1, last_error = $2,
+			available_at = NOW() + $3::integer * INTERVAL '1 second'
+		WHERE id = $4
+	`, pq.Array(completed), message, int64(backoff(msg.Attempts+1).Seconds()), msg.ID)
+	if err != nil {
+		return fmt.Errorf("failed to reschedule outbox message %d: %w", msg.ID, err)
+	}
+	return nil
+}
+
+// runHandler runs a handler under a savepoint so its writes are undone if it fails
+func runHandler(ctx context.Context, tx *sql.Tx, reg registration, msg Message) error {
+	if _, err := tx.ExecContext(ctx, `SAVEPOINT outbox_handler`); err != nil {
+		return err
+	}
+	if err := reg.handler(ctx, tx, msg); err != nil {
+		if _, rollbackErr := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT outbox_handler`); rollbackErr != nil {
+			return fmt.Errorf("%v (rollback failed: %v)", err, rollbackErr)
+		}
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT outbox_handler`)
+	return err
+}
+
+// backoff returns how long to wait after a message has failed attempts times. It doubles from
+// 5 seconds up to 10 minutes; messages are never given up on.
+func backoff(attempts int) time.Duration {
+	wait := initialBackoff
+	for i := 1; i < attempts && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxBackoff)
+}
+
+// Purge deletes processed messages older than retention
+func Purge(retention time.Duration) (int64, error) {
+	database, err := db.GetDB()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := database.Exec(`
+		DELETE FROM outbox WHERE processed_at < NOW() - $1::integer * INTERVAL '1 second'
+	`, int64(retention.Seconds()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge outbox: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// Start dispatches due messages every interval until ctx is cancelled. A full batch is
+// followed immediately by the next one so a backlog drains quickly. Processed messages older
+// than retention are purged once an hour.
+func Start(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastPurge := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				claimed, err := Process(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						log.Printf("Outbox dispatch failed: %v", err)
+					}
+					break
+				}
+				if claimed < batchSize {
+					break
+				}
+			}
+
+			if time.Since(lastPurge) >= time.Hour {
+				lastPurge = time.Now()
+				purged, err := Purge(retention)
+				if err != nil {
+					log.Printf("Outbox purge failed: %v", err)
+				} else if purged > 0 {
+					log.Printf("Outbox purged %d processed message(s)", purged)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package payments
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"invisimart-api/money"
+	"invisimart-api/validation"
+)
+
+// FakeGatewayName is the processor name recorded for payments made through the fake gateway
+const FakeGatewayName = "fake"
+
+// Magic card numbers understood by the fake gateway. Every other card is approved.
+const (
+	FakeCardDeclined          = "4000000000000002"
+	FakeCardInsufficientFunds = "4000000000009995"
+	FakeCardTimeout           = "4000000000000119"
+)
+
+// fakeCardCountries are the magic card numbers the fake gateway reports as issued outside
+// the US
+var fakeCardCountries = map[string]string{
+	"4000001240000000": "CA",
+	"4000008260000000": "GB",
+}
+
+// fakeReferencePrefix marks references issued by the fake gateway
+const fakeReferencePrefix = "fake_"
+
+// FakeGateway is a deterministic local processor for development and tests. It keeps no
+// state: references are derived from the order, card and amount, so the same request always
+// gets the same reference, and settlement calls only check that a reference is one of its own.
+type FakeGateway struct{}
+
+// NewFakeGateway returns the local fake gateway
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{}
+}
+
+// Name returns FakeGatewayName
+func (g *FakeGateway) Name() string {
+	return FakeGatewayName
+}
+
+// Authorize approves every card except the magic decline, insufficient funds and timeout
+// numbers. Cards are reported as issued in the US unless they are one of the magic foreign
+// card numbers.
+func (g *FakeGateway) Authorize(req AuthorizationRequest) (*Authorization, error) {
+	card := validation.NormalizeCardNumber(req.CardNumber)
+	switch card {
+	case FakeCardDeclined:
+		return nil, &Error{Code: CodeDeclined, Message: "Your card was declined"}
+	case FakeCardInsufficientFunds:
+		return nil, &Error{Code: CodeInsufficientFunds, Message: "Your card has insufficient funds"}
+	case FakeCardTimeout:
+		return nil, &Error{Code: CodeTimeout, Message: "The payment processor did not respond in time"}
+	}
+
+	if req.Amount.Minor <= 0 {
+		return nil, fmt.Errorf("authorization amount must be positive, got %s", req.Amount)
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s", req.OrderID, card, req.Amount)))
+	country, ok := fakeCardCountries[card]
+	if !ok {
+		country = "US"
+	}
+	return &Authorization{
+		Processor:   FakeGatewayName,
+		Reference:   fakeReferencePrefix + hex.EncodeToString(sum[:12]),
+		Amount:      req.Amount,
+		Status:      StatusAuthorized,
+		CardCountry: country,
+	}, nil
+}
+
+// Capture settles an authorization
+func (g *FakeGateway) Capture(reference string, amount money.Money) error {
+	return checkFakeReference(reference)
+}
+
+// Void releases an authorization that has not been captured
+func (g *FakeGateway) Void(reference string) error {
+	return checkFakeReference(reference)
+}
+
+// Refund returns part or all of a captured amount
+func (g *FakeGateway) Refund(reference string, amount money.Money) error {
+	if amount.Minor <= 0 {
+		return fmt.Errorf("refund amount must be positive, got %s", amount)
+	}
+	return checkFakeReference(reference)
+}
+
+func checkFakeReference(reference string) error {
+	if !strings.HasPrefix(reference, fakeReferencePrefix) {
+		return &Error{Code: CodeInvalidReference, Message: fmt.Sprintf("Unknown payment reference %q", reference)}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package payments
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"invisimart-api/money"
+)
+
+// Authorization statuses stored on purchases.payment_status
+const (
+	StatusAuthorized        = "authorized"
+	StatusCaptured          = "captured"
+	StatusVoided            = "voided"
+	StatusPartiallyRefunded = "partially_refunded"
+	StatusRefunded          = "refunded"
+)
+
+// Error codes reported by processors
+const (
+	CodeDeclined          = "card_declined"
+	CodeInsufficientFunds = "insufficient_funds"
+	CodeTimeout           = "processor_timeout"
+	CodeInvalidReference  = "invalid_reference"
+)
+
+// AuthorizationRequest asks the processor to hold an amount on a card
+type AuthorizationRequest struct {
+	// OrderID is passed to the processor as the merchant reference
+	OrderID    string
+	CardNumber string
+	Amount     money.Money
+}
+
+// Authorization is a successful hold on a card
+type Authorization struct {
+	Processor string
+	Reference string
+	Amount    money.Money
+	Status    string
+	// CardCountry is the ISO 3166 code of the country the card was issued in, or "" when the
+	// processor does not say
+	CardCountry string
+}
+
+// Processor authorizes and settles card payments. Every method is called with the reference
+// returned by Authorize.
+type Processor interface {
+	// Name identifies the processor in stored payment records
+	Name() string
+	Authorize(req AuthorizationRequest) (*Authorization, error)
+	Capture(reference string, amount money.Money) error
+	Void(reference string) error
+	Refund(reference string, amount money.Money) error
+}
+
+// Error is a payment failure reported by a processor. Its message is safe to show to customers.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Timeout reports whether the processor did not answer, in which case the outcome is unknown
+func (e *Error) Timeout() bool {
+	return e.Code == CodeTimeout
+}
+
+var (
+	mu      sync.RWMutex
+	current Processor = NewFakeGateway()
+)
+
+// Init selects the processor used for new payments by name. An empty name selects the local
+// fake gateway, which is the only processor available today.
+func Init(name string) error {
+	p, err := ForName(name)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	current = p
+	return nil
+}
+
+// Current returns the configured processor
+func Current() Processor {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// ForName returns the processor with the given name, as stored on each payment. Captures,
+// voids and refunds go to the processor that authorized the payment, which may no longer be
+// the one new payments use.
+func ForName(name string) (Processor, error) {
+	switch strings.ToLower(name) {
+	case "", FakeGatewayName:
+		return NewFakeGateway(), nil
+	}
+	return nil, fmt.Errorf("unknown payment processor %q", name)
+}
@@ -0,0 +1,119 @@
+package pricing
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Address is what can be read from a free-form billing address
+type Address struct {
+	// Country is the ISO 3166-1 alpha-2 code, or "" when it cannot be told
+	Country string
+	// Region is the US state or Canadian province code, or "" when it cannot be told
+	Region string
+}
+
+// usStates are the two-letter codes of US states and the District of Columbia
+var usStates = map[string]bool{
+	"AL": true, "AK": true, "AZ": true, "AR": true, "CA": true, "CO": true, "CT": true, "DE": true,
+	"DC": true, "FL": true, "GA": true, "HI": true, "ID": true, "IL": true, "IN": true, "IA": true,
+	"KS": true, "KY": true, "LA": true, "ME": true, "MD": true, "MA": true, "MI": true, "MN": true,
+	"MS": true, "MO": true, "MT": true, "NE": true, "NV": true, "NH": true, "NJ": true, "NM": true,
+	"NY": true, "NC": true, "ND": true, "OH": true, "OK": true, "OR": true, "PA": true, "RI": true,
+	"SC": true, "SD": true, "TN": true, "TX": true, "UT": true, "VT": true, "VA": true, "WA": true,
+	"WV": true, "WI": true, "WY": true,
+}
+
+// caProvinces are the Canadian province and territory codes
+var caProvinces = map[string]bool{
+	"AB": true, "BC": true, "MB": true, "NB": true, "NL": true, "NS": true, "NT": true, "NU": true,
+	"ON": true, "PE": true, "QC": true, "SK": true, "YT": true,
+}
+
+// countryNames are the ways a billing address commonly spells out a country, by ISO code.
+// "CA" is missing on purpose: on its own it is read as California.
+var countryNames = map[string]string{
+	"US": "US", "USA": "US", "UNITED STATES": "US", "UNITED STATES OF AMERICA": "US",
+	"CANADA": "CA",
+}
+
+var (
+	// usZIPPattern finds a state code followed by a ZIP code, as in "Springfield, IL 62704"
+	usZIPPattern = regexp.MustCompile(`\b([A-Z]{2})[\s,]+\d{5}(?:-\d{4})?\b`)
+	// caPostalPattern finds a postal code, optionally after a province code, as in
+	// "Toronto, ON M5V 3L9"
+	caPostalPattern = regexp.MustCompile(`(?:\b([A-Z]{2})[\s,]+)?\b[ABCEGHJ-NPRSTVXY]\d[ABCEGHJ-NPRSTV-Z][\s-]?\d[ABCEGHJ-NPRSTV-Z]\d\b`)
+
+	countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// ParseAddress reads the country and region of a free-form billing address. A country name
+// at the end wins. Otherwise a Canadian postal code places the address in Canada and a US
+// state and ZIP code in the US; without either, a trailing state or province code is used,
+// and any other trailing two-letter code is the country. "CA" on its own is California,
+// unless the part before it is a Canadian province, as in "Toronto, ON, CA".
+func ParseAddress(address string) Address {
+	upper := strings.ToUpper(address)
+	var parts []string
+	for _, part := range strings.Split(upper, ",") {
+		if part = strings.Join(strings.Fields(strings.ReplaceAll(part, ".", "")), " "); part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	var country string
+	if len(parts) > 0 {
+		if named, ok := countryNames[parts[len(parts)-1]]; ok {
+			country = named
+			parts = parts[:len(parts)-1]
+		}
+	}
+
+	if postal := parsePostalCode(upper); postal.Country != "" {
+		if country == "" || country == postal.Country {
+			return postal
+		}
+		return Address{Country: country}
+	}
+
+	if len(parts) == 0 {
+		return Address{Country: country}
+	}
+	code := parts[len(parts)-1]
+	switch {
+	case code == "CA" && country == "" && len(parts) > 1 && caProvinces[parts[len(parts)-2]]:
+		return Address{Country: "CA", Region: parts[len(parts)-2]}
+	case usStates[code] && (country == "" || country == "US"):
+		return Address{Country: "US", Region: code}
+	case caProvinces[code] && (country == "" || country == "CA"):
+		return Address{Country: "CA", Region: code}
+	case country == "" && countryCodePattern.MatchString(code):
+		return Address{Country: code}
+	}
+	return Address{Country: country}
+}
+
+// parsePostalCode finds a Canadian postal code or a US ZIP code in an upper-cased address.
+// The last one wins, since the postal code usually comes after the street and city.
+func parsePostalCode(address string) Address {
+	if matches := caPostalPattern.FindAllStringSubmatch(address, -1); len(matches) > 0 {
+		province := matches[len(matches)-1][1]
+		if !caProvinces[province] {
+			province = ""
+		}
+		return Address{Country: "CA", Region: province}
+	}
+	matches := usZIPPattern.FindAllStringSubmatch(address, -1)
+	for i := len(matches) - 1; i >= 0; i-- {
+		if state := matches[i][1]; usStates[state] {
+			return Address{Country: "US", Region: state}
+		}
+	}
+	return Address{}
+}
+
+// ParseRegion extracts the state or province code from a free-form billing address, or
+// returns "" when none can be found
+func ParseRegion(address string) string {
+	return ParseAddress(address).Region
+}
@@ -0,0 +1,36 @@
+package pricing
+
+import "testing"
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    Address
+	}{
+		{"123 Main St, Springfield, IL 62704", Address{"US", "IL"}},
+		{"1 Infinite Loop, Cupertino, ca 95014-2083", Address{"US", "CA"}},
+		{"500 Broadway, Los Angeles, CA", Address{"US", "CA"}},
+		{"1 Main St, Austin, TX, USA", Address{"US", "TX"}},
+		{"1 Main St, Austin, Texas, United States of America", Address{"US", ""}},
+		{"1 Main St, Austin, TX 78701, U.S.A.", Address{"US", "TX"}},
+		// "CA" after a Canadian province or postal code is Canada, not California
+		{"290 Bremner Blvd, Toronto, ON M5V 3L9, CA", Address{"CA", "ON"}},
+		{"290 Bremner Blvd, Toronto, ON, CA", Address{"CA", "ON"}},
+		{"1000 Rue Sherbrooke O, Montreal, QC h3a 3g4", Address{"CA", "QC"}},
+		{"1000 Rue Sherbrooke O, Montreal H3A-3G4", Address{"CA", ""}},
+		{"290 Bremner Blvd, Toronto, Canada", Address{"CA", ""}},
+		{"800 Robson St, Vancouver, BC, Canada", Address{"CA", "BC"}},
+		{"10 Downing St, London SW1A 2AA, GB", Address{"GB", ""}},
+		{"55 Rue du Faubourg Saint-Honore, 75008 Paris, fr", Address{"FR", ""}},
+		// A state and ZIP code in an address that names another country are not a US region
+		{"1 Main St, Austin, TX 78701, Canada", Address{"CA", ""}},
+		{"1000 N King St, Wilmington, DE", Address{"US", "DE"}},
+		{"10 Downing St, London", Address{}},
+		{"", Address{}},
+	}
+	for _, tt := range tests {
+		if got := ParseAddress(tt.address); got != tt.want {
+			t.Errorf("ParseAddress(%q) = %+v, want %+v", tt.address, got, tt.want)
+		}
+	}
+}
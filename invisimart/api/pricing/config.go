@@ -0,0 +1,144 @@
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+
+	"invisimart-api/money"
+)
+
+// Shipping methods supported by the pipeline
+const (
+	ShippingFlat   = "flat"
+	ShippingWeight = "weight"
+	ShippingFree   = "free"
+)
+
+// Config is the pricing rules file. Amounts and rates are decimal strings so they are read
+// exactly; rates are fractions, so "0.0725" is 7.25%.
+type Config struct {
+	Tax      TaxConfig      `json:"tax"`
+	Shipping ShippingConfig `json:"shipping"`
+}
+
+// TaxConfig holds tax rate tables keyed by region code (for example "CA")
+type TaxConfig struct {
+	// TaxShipping applies tax to the shipping charge as well as to the items
+	TaxShipping bool `json:"taxShipping"`
+	// Default applies when the billing region is unknown or has no table
+	Default []TaxRate `json:"default"`
+	// Regions maps a region code to the taxes levied there
+	Regions map[string][]TaxRate `json:"regions"`
+}
+
+// TaxRate is one named tax in a region's rate table
+type TaxRate struct {
+	Name string `json:"name"`
+	Rate string `json:"rate"`
+
+	rate *big.Rat
+}
+
+// ShippingConfig selects and parameterizes the shipping method
+type ShippingConfig struct {
+	// Method is one of "flat", "weight" or "free"
+	Method string `json:"method"`
+	// FlatRate is charged per order by the flat method
+	FlatRate string `json:"flatRate"`
+	// BaseRate plus PerKilogram times the order weight is charged by the weight method
+	BaseRate    string `json:"baseRate"`
+	PerKilogram string `json:"perKilogram"`
+	// FreeOverThreshold makes shipping free once the subtotal reaches it; empty disables it
+	FreeOverThreshold string `json:"freeOverThreshold"`
+
+	flatRate          money.Money
+	baseRate          money.Money
+	perKilogram       money.Money
+	freeOverThreshold *money.Money
+}
+
+// DefaultConfig preserves the original checkout behavior: no tax and free shipping
+func DefaultConfig() *Config {
+	return &Config{Shipping: ShippingConfig{Method: ShippingFree}}
+}
+
+// LoadConfig reads and validates a pricing rules file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read pricing config: %w", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse pricing config: %w", err)
+	}
+
+	if err := config.compile(); err != nil {
+		return nil, fmt.Errorf("invalid pricing config: %w", err)
+	}
+	return &config, nil
+}
+
+// compile parses the decimal strings in the config and checks the shipping method
+func (c *Config) compile() error {
+	if err := compileRates(c.Tax.Default); err != nil {
+		return fmt.Errorf("default tax: %w", err)
+	}
+	for region, rates := range c.Tax.Regions {
+		if err := compileRates(rates); err != nil {
+			return fmt.Errorf("tax region %s: %w", region, err)
+		}
+	}
+
+	s := &c.Shipping
+	amounts := []struct {
+		name  string
+		value string
+		dest  *money.Money
+	}{
+		{"flatRate", s.FlatRate, &s.flatRate},
+		{"baseRate", s.BaseRate, &s.baseRate},
+		{"perKilogram", s.PerKilogram, &s.perKilogram},
+	}
+	for _, amount := range amounts {
+		if amount.value == "" {
+			continue
+		}
+		parsed, err := money.Parse(amount.value, money.DefaultCurrency)
+		if err != nil {
+			return fmt.Errorf("shipping %s: %w", amount.name, err)
+		}
+		*amount.dest = parsed
+	}
+
+	if s.FreeOverThreshold != "" {
+		threshold, err := money.Parse(s.FreeOverThreshold, money.DefaultCurrency)
+		if err != nil {
+			return fmt.Errorf("shipping freeOverThreshold: %w", err)
+		}
+		s.freeOverThreshold = &threshold
+	}
+
+	switch s.Method {
+	case ShippingFlat, ShippingWeight, ShippingFree:
+	case "":
+		s.Method = ShippingFree
+	default:
+		return fmt.Errorf("unknown shipping method %q", s.Method)
+	}
+	return nil
+}
+
+func compileRates(rates []TaxRate) error {
+	for i := range rates {
+		rate, ok := new(big.Rat).SetString(rates[i].Rate)
+		if !ok || rate.Sign() < 0 {
+			return fmt.Errorf("invalid rate %q for %s", rates[i].Rate, rates[i].Name)
+		}
+		rates[i].rate = rate
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package pricing
+
+import (
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"invisimart-api/money"
+)
+
+// Line is one priced order line
+type Line struct {
+	ProductID   string
+	Quantity    int
+	UnitPrice   money.Money
+	WeightGrams int
+	Category    string
+}
+
+// Discount is a reduction applied before shipping and tax, such as a promo code
+type Discount struct {
+	Code         string
+	Amount       money.Money
+	FreeShipping bool
+}
+
+// TaxLine is one tax charged on an order
+type TaxLine struct {
+	Name   string      `json:"name"`
+	Rate   string      `json:"rate"`
+	Amount money.Money `json:"amount"`
+}
+
+// Breakdown is the full price of an order
+type Breakdown struct {
+	Subtotal       money.Money `json:"subtotal"`
+	Discount       money.Money `json:"discount"`
+	PromoCode      string      `json:"promoCode,omitempty"`
+	Shipping       money.Money `json:"shipping"`
+	ShippingMethod string      `json:"shippingMethod"`
+	Tax            money.Money `json:"tax"`
+	TaxRegion      string      `json:"taxRegion,omitempty"`
+	TaxLines       []TaxLine   `json:"taxLines"`
+	Total          money.Money `json:"total"`
+}
+
+var (
+	mu         sync.Mutex
+	configPath string
+	modTime    time.Time
+	current    = DefaultConfig()
+)
+
+// Init loads pricing rules from path. With an empty path the built-in defaults are used.
+// The file is re-read whenever its modification time changes, so rules can be edited
+// without a redeploy.
+func Init(path string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	configPath = path
+	if path == "" {
+		current = DefaultConfig()
+		return nil
+	}
+	return reloadLocked()
+}
+
+// config returns the current rules, reloading them first if the file has changed. A file
+// that fails to load leaves the previous rules in place.
+func config() *Config {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if configPath != "" {
+		if info, err := os.Stat(configPath); err == nil && !info.ModTime().Equal(modTime) {
+			if err := reloadLocked(); err != nil {
+				log.Printf("Failed to reload pricing config, keeping previous rules: %v", err)
+			}
+		}
+	}
+	return current
+}
+
+func reloadLocked() error {
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return err
+	}
+	loaded, err := LoadConfig(configPath)
+	if err != nil {
+		modTime = info.ModTime()
+		return err
+	}
+	current = loaded
+	modTime = info.ModTime()
+	log.Printf("Loaded pricing config from %s", configPath)
+	return nil
+}
+
+// Calculate prices an order: subtotal less any discount, shipping and tax for the region in
+// the billing address
+func Calculate(lines []Line, billingAddress string, discount Discount) Breakdown {
+	return config().Calculate(lines, billingAddress, discount)
+}
+
+// Calculate prices an order using these rules
+func (c *Config) Calculate(lines []Line, billingAddress string, discount Discount) Breakdown {
+	b := Breakdown{TaxLines: []TaxLine{}, PromoCode: discount.Code}
+
+	weightGrams := 0
+	for _, line := range lines {
+		b.Subtotal = b.Subtotal.Add(line.UnitPrice.Mul(int64(line.Quantity)))
+		weightGrams += line.WeightGrams * line.Quantity
+	}
+
+	// The discount can never exceed the subtotal
+	b.Discount = discount.Amount
+	if b.Discount.Cmp(b.Subtotal) > 0 {
+		b.Discount = b.Subtotal
+	}
+	discounted := b.Subtotal.Sub(b.Discount)
+
+	b.ShippingMethod, b.Shipping = c.Shipping.charge(discounted, weightGrams)
+	if discount.FreeShipping {
+		b.ShippingMethod, b.Shipping = ShippingFree, money.New(0, b.Subtotal.Currency)
+	}
+
+	b.TaxRegion = ParseRegion(billingAddress)
+	rates, ok := c.Tax.Regions[b.TaxRegion]
+	if !ok {
+		rates = c.Tax.Default
+	}
+
+	taxable := discounted
+	if c.Tax.TaxShipping {
+		taxable = taxable.Add(b.Shipping)
+	}
+	for _, rate := range rates {
+		amount := taxable.MulRat(rate.rate)
+		b.Tax = b.Tax.Add(amount)
+		b.TaxLines = append(b.TaxLines, TaxLine{Name: rate.Name, Rate: rate.Rate, Amount: amount})
+	}
+
+	b.Total = discounted.Add(b.Shipping).Add(b.Tax)
+	return b
+}
+
+// PartialRefund is the amount returned for refunded items worth items from an order whose
+// items came to subtotal: the items less their share of the order's discount, plus their share
+// of its tax. Shipping is only returned when the whole order is.
+func PartialRefund(items, subtotal, discount, tax money.Money) money.Money {
+	if subtotal.IsZero() {
+		return items
+	}
+	share := big.NewRat(items.Minor, subtotal.Minor)
+	return items.Sub(discount.MulRat(share)).Add(tax.MulRat(share))
+}
+
+// Convert restates a breakdown priced from lines in another currency. Each line's unit price
+// is converted and the subtotal added up again from them, so the order's lines still sum to
+// its subtotal; the discount, shipping and each tax are converted on their own, and the total
+// is added up again from the converted parts.
+func (b Breakdown) Convert(rate money.Rate, lines []Line) Breakdown {
+	converted := b
+	converted.Subtotal = money.New(0, rate.To)
+	for _, line := range lines {
+		converted.Subtotal = converted.Subtotal.Add(rate.Convert(line.UnitPrice).Mul(int64(line.Quantity)))
+	}
+	converted.Discount = rate.Convert(b.Discount)
+	if converted.Discount.Cmp(converted.Subtotal) > 0 {
+		converted.Discount = converted.Subtotal
+	}
+	converted.Shipping = rate.Convert(b.Shipping)
+
+	converted.Tax = money.New(0, rate.To)
+	converted.TaxLines = make([]TaxLine, 0, len(b.TaxLines))
+	for _, tax := range b.TaxLines {
+		tax.Amount = rate.Convert(tax.Amount)
+		converted.Tax = converted.Tax.Add(tax.Amount)
+		converted.TaxLines = append(converted.TaxLines, tax)
+	}
+
+	converted.Total = converted.Subtotal.Sub(converted.Discount).Add(converted.Shipping).Add(converted.Tax)
+	return converted
+}
+
+// charge returns the shipping method applied and its cost
+func (s ShippingConfig) charge(subtotal money.Money, weightGrams int) (string, money.Money) {
+	zero := money.New(0, subtotal.Currency)
+	if s.freeOverThreshold != nil && subtotal.Cmp(*s.freeOverThreshold) >= 0 {
+		return ShippingFree, zero
+	}
+
+	switch s.Method {
+	case ShippingFlat:
+		return ShippingFlat, s.flatRate
+	case ShippingWeight:
+		perWeight := s.perKilogram.MulRat(big.NewRat(int64(weightGrams), 1000))
+		return ShippingWeight, s.baseRate.Add(perWeight)
+	}
+	return ShippingFree, zero
+}
@@ -0,0 +1,163 @@
+package pricing
+
+import (
+	"testing"
+
+	"invisimart-api/money"
+)
+
+func testConfig(t *testing.T, shipping ShippingConfig, taxShipping bool) *Config {
+	t.Helper()
+	config := &Config{
+		Tax: TaxConfig{
+			TaxShipping: taxShipping,
+			Default:     []TaxRate{{Name: "Default tax", Rate: "0.05"}},
+			Regions: map[string][]TaxRate{
+				"NY": {{Name: "State", Rate: "0.04"}, {Name: "City", Rate: "0.045"}},
+				"ON": {{Name: "HST", Rate: "0.13"}},
+			},
+		},
+		Shipping: shipping,
+	}
+	if err := config.compile(); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func usd(minor int64) money.Money {
+	return money.New(minor, "USD")
+}
+
+func TestCalculateTax(t *testing.T) {
+	lines := []Line{
+		{ProductID: "1", Quantity: 2, UnitPrice: usd(1999)},
+		{ProductID: "2", Quantity: 1, UnitPrice: usd(500)},
+	}
+	flat := ShippingConfig{Method: ShippingFlat, FlatRate: "10.00"}
+
+	tests := []struct {
+		name        string
+		address     string
+		taxShipping bool
+		wantRegion  string
+		wantTax     int64
+		wantLines   int
+	}{
+		// 8.5% of 44.98 in two lines: 1.7992 and 2.0241
+		{"region table", "1 Main St, New York, NY 10001", false, "NY", 382, 2},
+		{"province table", "290 Bremner Blvd, Toronto, ON M5V 3L9", false, "ON", 585, 1},
+		{"default table", "1 Main St, Austin, TX 78701", false, "TX", 225, 1},
+		{"unknown region", "10 Downing St, London", false, "", 225, 1},
+		// Shipping is taxed too: 13% of 54.98
+		{"taxed shipping", "290 Bremner Blvd, Toronto, ON M5V 3L9", true, "ON", 715, 1},
+	}
+	for _, tt := range tests {
+		b := testConfig(t, flat, tt.taxShipping).Calculate(lines, tt.address, Discount{})
+		if b.TaxRegion != tt.wantRegion {
+			t.Errorf("%s: tax region %q, want %q", tt.name, b.TaxRegion, tt.wantRegion)
+		}
+		if b.Tax != usd(tt.wantTax) || len(b.TaxLines) != tt.wantLines {
+			t.Errorf("%s: tax %s in %d lines, want %d minor units in %d lines", tt.name, b.Tax, len(b.TaxLines), tt.wantTax, tt.wantLines)
+		}
+		if b.Subtotal != usd(4498) || b.Total != b.Subtotal.Add(b.Shipping).Add(b.Tax) {
+			t.Errorf("%s: subtotal %s, total %s does not add up", tt.name, b.Subtotal, b.Total)
+		}
+	}
+}
+
+func TestCalculateShipping(t *testing.T) {
+	tests := []struct {
+		name       string
+		shipping   ShippingConfig
+		unitPrice  int64
+		quantity   int
+		weight     int
+		wantMethod string
+		want       int64
+	}{
+		{"flat", ShippingConfig{Method: ShippingFlat, FlatRate: "7.99"}, 1000, 1, 500, ShippingFlat, 799},
+		// 4.99 plus 1.25 per kilogram for 3 x 750g
+		{"weight", ShippingConfig{Method: ShippingWeight, BaseRate: "4.99", PerKilogram: "1.25"}, 1000, 3, 750, ShippingWeight, 780},
+		{"free", ShippingConfig{Method: ShippingFree}, 1000, 1, 500, ShippingFree, 0},
+		{"under threshold", ShippingConfig{Method: ShippingFlat, FlatRate: "7.99", FreeOverThreshold: "100.00"}, 9999, 1, 0, ShippingFlat, 799},
+		{"at threshold", ShippingConfig{Method: ShippingFlat, FlatRate: "7.99", FreeOverThreshold: "100.00"}, 5000, 2, 0, ShippingFree, 0},
+	}
+	for _, tt := range tests {
+		lines := []Line{{ProductID: "1", Quantity: tt.quantity, UnitPrice: usd(tt.unitPrice), WeightGrams: tt.weight}}
+		b := testConfig(t, tt.shipping, false).Calculate(lines, "", Discount{})
+		if b.ShippingMethod != tt.wantMethod || b.Shipping != usd(tt.want) {
+			t.Errorf("%s: shipping %s %s, want %s %d minor units", tt.name, b.ShippingMethod, b.Shipping, tt.wantMethod, tt.want)
+		}
+	}
+}
+
+func TestCompileRejectsBadRules(t *testing.T) {
+	tests := []Config{
+		{Shipping: ShippingConfig{Method: "teleport"}},
+		{Shipping: ShippingConfig{Method: ShippingFlat, FlatRate: "abc"}},
+		{Tax: TaxConfig{Default: []TaxRate{{Name: "Negative", Rate: "-0.01"}}}},
+		{Tax: TaxConfig{Regions: map[string][]TaxRate{"NY": {{Name: "Bad", Rate: "x"}}}}},
+	}
+	for i, config := range tests {
+		if err := config.compile(); err == nil {
+			t.Errorf("config %d: compile accepted %+v", i, config)
+		}
+	}
+}
+
+func TestCalculateDiscount(t *testing.T) {
+	lines := []Line{{ProductID: "1", Quantity: 2, UnitPrice: usd(6000)}}
+	shipping := ShippingConfig{Method: ShippingFlat, FlatRate: "7.99", FreeOverThreshold: "100.00"}
+
+	tests := []struct {
+		name         string
+		discount     Discount
+		wantDiscount int64
+		wantShipping int64
+		wantTax      int64
+	}{
+		{"none", Discount{}, 0, 0, 600},
+		// The discount is taken before the free shipping threshold and tax: 20.01 off 120.00
+		// drops the order under 100.00, and 5% tax is charged on 99.99
+		{"under threshold", Discount{Code: "SAVE", Amount: usd(2001)}, 2001, 799, 500},
+		{"capped at subtotal", Discount{Code: "ALL", Amount: usd(50000)}, 12000, 799, 0},
+		{"free shipping", Discount{Code: "SHIP", Amount: usd(2001), FreeShipping: true}, 2001, 0, 500},
+	}
+	for _, tt := range tests {
+		b := testConfig(t, shipping, false).Calculate(lines, "", tt.discount)
+		if b.Discount.Minor != tt.wantDiscount || b.Shipping.Minor != tt.wantShipping || b.Tax.Minor != tt.wantTax {
+			t.Errorf("%s: discount %s, shipping %s, tax %s, want %d, %d and %d minor units",
+				tt.name, b.Discount, b.Shipping, b.Tax, tt.wantDiscount, tt.wantShipping, tt.wantTax)
+		}
+		if want := b.Subtotal.Sub(b.Discount).Add(b.Shipping).Add(b.Tax); b.Total != want {
+			t.Errorf("%s: total %s, want %s", tt.name, b.Total, want)
+		}
+		if b.PromoCode != tt.discount.Code {
+			t.Errorf("%s: promo code %q, want %q", tt.name, b.PromoCode, tt.discount.Code)
+		}
+	}
+}
+
+func TestPartialRefund(t *testing.T) {
+	tests := []struct {
+		name                           string
+		items, subtotal, discount, tax int64
+		want                           int64
+	}{
+		{"no discount or tax", 2500, 10000, 0, 0, 2500},
+		// A quarter of the items gets back a quarter of the discount and of the tax
+		{"prorated", 2500, 10000, 1000, 720, 2430},
+		// 1/3 of 10.00 off is 3.333..., rounded to 3.33; 1/3 of 8.25 tax is 2.75
+		{"rounded share", 3000, 9000, 1000, 825, 2942},
+		{"whole subtotal", 9000, 9000, 1000, 825, 8825},
+		// Orders from before subtotals were stored refund the items at face value
+		{"no subtotal", 2500, 0, 0, 0, 2500},
+	}
+	for _, tt := range tests {
+		got := PartialRefund(usd(tt.items), usd(tt.subtotal), usd(tt.discount), usd(tt.tax))
+		if got != usd(tt.want) {
+			t.Errorf("%s: refund %s, want %d minor units", tt.name, got, tt.want)
+		}
+	}
+}
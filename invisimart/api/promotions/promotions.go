@@ -0,0 +1,241 @@
+package promotions
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"invisimart-api/money"
+	"invisimart-api/pricing"
+)
+
+// Discount types
+const (
+	TypePercent      = "percent"
+	TypeFixed        = "fixed"
+	TypeBuyXGetY     = "buy_x_get_y"
+	TypeFreeShipping = "free_shipping"
+)
+
+// Promotion is a coupon code and the rules for applying it
+type Promotion struct {
+	ID          int    `json:"id"`
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	// PercentOff is a decimal percentage such as "15" or "12.5", used by percent promotions
+	PercentOff string `json:"percentOff,omitempty"`
+	// AmountOff is taken off the eligible subtotal by fixed promotions
+	AmountOff money.Money `json:"amountOff"`
+	// BuyQuantity and GetQuantity define buy-X-get-Y: every X+Y eligible units, Y are free
+	BuyQuantity int `json:"buyQuantity,omitempty"`
+	GetQuantity int `json:"getQuantity,omitempty"`
+
+	StartsAt *time.Time `json:"startsAt,omitempty"`
+	EndsAt   *time.Time `json:"endsAt,omitempty"`
+
+	// MaxRedemptions and MaxRedemptionsPerCustomer are unlimited when nil
+	MaxRedemptions            *int `json:"maxRedemptions,omitempty"`
+	MaxRedemptionsPerCustomer *int `json:"maxRedemptionsPerCustomer,omitempty"`
+
+	// ProductIDs and Categories restrict the promotion; when both are empty it applies to every product
+	ProductIDs []string `json:"productIds"`
+	Categories []string `json:"categories"`
+
+	Active          bool   `json:"active"`
+	RedemptionCount int    `json:"redemptionCount"`
+	CreatedAt       string `json:"createdAt,omitempty"`
+	UpdatedAt       string `json:"updatedAt,omitempty"`
+}
+
+// Error explains why a promotion cannot be used. Its message is safe to show to customers.
+type Error struct {
+	Code   string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Promo code %s %s", e.Code, e.Reason)
+}
+
+// NormalizeCode returns the canonical form of a promo code
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Validate checks that a promotion definition is complete and consistent
+func (p *Promotion) Validate() error {
+	p.Code = NormalizeCode(p.Code)
+	if p.Code == "" {
+		return fmt.Errorf("code is required")
+	}
+
+	switch p.Type {
+	case TypePercent:
+		pct, ok := new(big.Rat).SetString(p.PercentOff)
+		if !ok || pct.Sign() <= 0 || pct.Cmp(big.NewRat(100, 1)) > 0 {
+			return fmt.Errorf("percentOff must be greater than 0 and at most 100")
+		}
+	case TypeFixed:
+		if p.AmountOff.Minor <= 0 {
+			return fmt.Errorf("amountOff must be positive")
+		}
+	case TypeBuyXGetY:
+		if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+			return fmt.Errorf("buyQuantity and getQuantity must be positive")
+		}
+	case TypeFreeShipping:
+	default:
+		return fmt.Errorf("unknown promotion type %q", p.Type)
+	}
+
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		return fmt.Errorf("endsAt must be after startsAt")
+	}
+	if p.MaxRedemptions != nil && *p.MaxRedemptions <= 0 {
+		return fmt.Errorf("maxRedemptions must be positive")
+	}
+	if p.MaxRedemptionsPerCustomer != nil && *p.MaxRedemptionsPerCustomer <= 0 {
+		return fmt.Errorf("maxRedemptionsPerCustomer must be positive")
+	}
+	return nil
+}
+
+// CheckUsable reports whether the promotion can be redeemed now by a customer who has
+// already redeemed it customerRedemptions times
+func (p *Promotion) CheckUsable(now time.Time, customerRedemptions int) error {
+	switch {
+	case !p.Active:
+		return &Error{Code: p.Code, Reason: "is not active"}
+	case p.StartsAt != nil && now.Before(*p.StartsAt):
+		return &Error{Code: p.Code, Reason: "is not valid yet"}
+	case p.EndsAt != nil && !now.Before(*p.EndsAt):
+		return &Error{Code: p.Code, Reason: "has expired"}
+	case p.MaxRedemptions != nil && p.RedemptionCount >= *p.MaxRedemptions:
+		return &Error{Code: p.Code, Reason: "has reached its usage limit"}
+	case p.MaxRedemptionsPerCustomer != nil && customerRedemptions >= *p.MaxRedemptionsPerCustomer:
+		return &Error{Code: p.Code, Reason: "has already been used the maximum number of times for this customer"}
+	}
+	return nil
+}
+
+// Store is what Redeem reads promotions from: the purchase transaction
+type Store interface {
+	// LockPromotion returns the promotion with the given code, or nil if there is none. The
+	// promotion stays locked until the transaction ends, so concurrent orders cannot both
+	// take its last redemption.
+	LockPromotion(code string) (*Promotion, error)
+	// CountRedemptions returns how many times an email address has redeemed a promotion,
+	// comparing addresses case-insensitively
+	CountRedemptions(promotionID int, email string) (int, error)
+}
+
+// Redeem checks that a customer can use a promo code now and computes its discount on the
+// order lines. The usage limits are checked against the locked promotion, so they hold when
+// several orders use the code at once.
+func Redeem(store Store, code, customerEmail string, lines []pricing.Line, now time.Time) (*Promotion, pricing.Discount, error) {
+	code = NormalizeCode(code)
+
+	promo, err := store.LockPromotion(code)
+	if err != nil {
+		return nil, pricing.Discount{}, fmt.Errorf("failed to load promotion: %w", err)
+	}
+	if promo == nil {
+		return nil, pricing.Discount{}, &Error{Code: code, Reason: "is not valid"}
+	}
+
+	customerRedemptions, err := store.CountRedemptions(promo.ID, customerEmail)
+	if err != nil {
+		return nil, pricing.Discount{}, fmt.Errorf("failed to count promotion redemptions: %w", err)
+	}
+
+	if err := promo.CheckUsable(now, customerRedemptions); err != nil {
+		return nil, pricing.Discount{}, err
+	}
+
+	discount, err := promo.Apply(lines)
+	if err != nil {
+		return nil, pricing.Discount{}, err
+	}
+	return promo, discount, nil
+}
+
+// Apply computes the discount the promotion gives on the order lines
+func (p *Promotion) Apply(lines []pricing.Line) (pricing.Discount, error) {
+	discount := pricing.Discount{Code: p.Code}
+
+	var eligible []pricing.Line
+	var eligibleSubtotal money.Money
+	for _, line := range lines {
+		if p.appliesTo(line) {
+			eligible = append(eligible, line)
+			eligibleSubtotal = eligibleSubtotal.Add(line.UnitPrice.Mul(int64(line.Quantity)))
+		}
+	}
+
+	if p.Type == TypeFreeShipping {
+		discount.FreeShipping = true
+		return discount, nil
+	}
+	if len(eligible) == 0 {
+		return discount, &Error{Code: p.Code, Reason: "does not apply to any item in this order"}
+	}
+
+	switch p.Type {
+	case TypePercent:
+		pct, _ := new(big.Rat).SetString(p.PercentOff)
+		discount.Amount = eligibleSubtotal.MulRat(pct.Quo(pct, big.NewRat(100, 1)))
+	case TypeFixed:
+		discount.Amount = p.AmountOff
+		if discount.Amount.Cmp(eligibleSubtotal) > 0 {
+			discount.Amount = eligibleSubtotal
+		}
+	case TypeBuyXGetY:
+		discount.Amount = p.buyXGetY(eligible)
+		if discount.Amount.IsZero() {
+			return discount, &Error{Code: p.Code, Reason: fmt.Sprintf("requires at least %d eligible items", p.BuyQuantity+p.GetQuantity)}
+		}
+	}
+	return discount, nil
+}
+
+// buyXGetY makes the cheapest Y units of every group of X+Y eligible units free, grouping
+// the most expensive units first
+func (p *Promotion) buyXGetY(lines []pricing.Line) money.Money {
+	var units []money.Money
+	for _, line := range lines {
+		for i := 0; i < line.Quantity; i++ {
+			units = append(units, line.UnitPrice)
+		}
+	}
+	sort.Slice(units, func(i, j int) bool { return units[i].Minor > units[j].Minor })
+
+	var free money.Money
+	groupSize := p.BuyQuantity + p.GetQuantity
+	for start := 0; start+groupSize <= len(units); start += groupSize {
+		for _, unit := range units[start+p.BuyQuantity : start+groupSize] {
+			free = free.Add(unit)
+		}
+	}
+	return free
+}
+
+// appliesTo reports whether a line is within the promotion's product and category scope
+func (p *Promotion) appliesTo(line pricing.Line) bool {
+	if len(p.ProductIDs) == 0 && len(p.Categories) == 0 {
+		return true
+	}
+	for _, id := range p.ProductIDs {
+		if id == line.ProductID {
+			return true
+		}
+	}
+	for _, category := range p.Categories {
+		if line.Category != "" && strings.EqualFold(category, line.Category) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package promotions
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"invisimart-api/money"
+	"invisimart-api/pricing"
+)
+
+func usd(minor int64) money.Money {
+	return money.New(minor, "USD")
+}
+
+func limit(n int) *int {
+	return &n
+}
+
+// fakeStore is a Store over in-memory promotions that records the calls made to it
+type fakeStore struct {
+	promotions  map[string]*Promotion
+	redemptions map[int][]string
+	calls       []string
+}
+
+func (s *fakeStore) LockPromotion(code string) (*Promotion, error) {
+	s.calls = append(s.calls, "lock "+code)
+	return s.promotions[code], nil
+}
+
+func (s *fakeStore) CountRedemptions(promotionID int, email string) (int, error) {
+	s.calls = append(s.calls, "count")
+	count := 0
+	for _, redeemedBy := range s.redemptions[promotionID] {
+		if strings.EqualFold(redeemedBy, email) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func TestRedeemUsageLimits(t *testing.T) {
+	lines := []pricing.Line{{ProductID: "1", Quantity: 1, UnitPrice: usd(10000)}}
+	newStore := func() *fakeStore {
+		return &fakeStore{
+			promotions: map[string]*Promotion{
+				"TOTAL": {ID: 1, Code: "TOTAL", Type: TypePercent, PercentOff: "10", Active: true,
+					MaxRedemptions: limit(3), RedemptionCount: 2},
+				"SOLDOUT": {ID: 2, Code: "SOLDOUT", Type: TypePercent, PercentOff: "10", Active: true,
+					MaxRedemptions: limit(3), RedemptionCount: 3},
+				"ONCE": {ID: 3, Code: "ONCE", Type: TypePercent, PercentOff: "10", Active: true,
+					MaxRedemptionsPerCustomer: limit(1)},
+			},
+			redemptions: map[int][]string{3: {"Ann@Example.com"}},
+		}
+	}
+
+	tests := []struct {
+		code       string
+		email      string
+		wantReason string
+	}{
+		{" total ", "bob@example.com", ""},
+		{"SOLDOUT", "bob@example.com", "has reached its usage limit"},
+		{"ONCE", "bob@example.com", ""},
+		// Per-customer counts match the email address case-insensitively
+		{"ONCE", "ann@example.com", "has already been used the maximum number of times for this customer"},
+		{"MISSING", "bob@example.com", "is not valid"},
+	}
+	for _, tt := range tests {
+		store := newStore()
+		promo, discount, err := Redeem(store, tt.code, tt.email, lines, time.Now())
+		if tt.wantReason != "" {
+			var promoErr *Error
+			if !errors.As(err, &promoErr) || promoErr.Reason != tt.wantReason {
+				t.Errorf("Redeem(%q, %q) error = %v, want %q", tt.code, tt.email, err, tt.wantReason)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Redeem(%q, %q) returned error: %v", tt.code, tt.email, err)
+			continue
+		}
+		if promo.Code != NormalizeCode(tt.code) || discount.Amount != usd(1000) {
+			t.Errorf("Redeem(%q, %q) = %s, %+v", tt.code, tt.email, promo.Code, discount)
+		}
+		// The limits must be read from the locked row, so the lock comes first
+		if want := []string{"lock " + promo.Code, "count"}; strings.Join(store.calls, ",") != strings.Join(want, ",") {
+			t.Errorf("Redeem(%q) made calls %v, want %v", tt.code, store.calls, want)
+		}
+	}
+}
+
+func TestCheckUsable(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	start, end := now.Add(-time.Hour), now.Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		promo      Promotion
+		customer   int
+		wantReason string
+	}{
+		{"usable", Promotion{Active: true, StartsAt: &start, EndsAt: &end}, 0, ""},
+		{"inactive", Promotion{Active: false}, 0, "is not active"},
+		{"not started", Promotion{Active: true, StartsAt: &end}, 0, "is not valid yet"},
+		{"ends now", Promotion{Active: true, EndsAt: &now}, 0, "has expired"},
+		{"under limit", Promotion{Active: true, MaxRedemptions: limit(5), RedemptionCount: 4}, 0, ""},
+		{"at limit", Promotion{Active: true, MaxRedemptions: limit(5), RedemptionCount: 5}, 0, "has reached its usage limit"},
+		{"customer under limit", Promotion{Active: true, MaxRedemptionsPerCustomer: limit(2)}, 1, ""},
+		{"customer at limit", Promotion{Active: true, MaxRedemptionsPerCustomer: limit(2)}, 2,
+			"has already been used the maximum number of times for this customer"},
+	}
+	for _, tt := range tests {
+		err := tt.promo.CheckUsable(now, tt.customer)
+		var promoErr *Error
+		switch {
+		case tt.wantReason == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.wantReason != "" && (!errors.As(err, &promoErr) || promoErr.Reason != tt.wantReason):
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantReason)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	lines := []pricing.Line{
+		{ProductID: "1", Category: "bicycles", Quantity: 1, UnitPrice: usd(50000)},
+		{ProductID: "2", Category: "helmets", Quantity: 3, UnitPrice: usd(4000)},
+		{ProductID: "3", Category: "locks", Quantity: 1, UnitPrice: usd(2500)},
+	}
+
+	tests := []struct {
+		name    string
+		promo   Promotion
+		want    int64
+		wantErr bool
+	}{
+		{"percent of order", Promotion{Type: TypePercent, PercentOff: "10"}, 6450, false},
+		{"percent of category", Promotion{Type: TypePercent, PercentOff: "12.5", Categories: []string{"Helmets"}}, 1500, false},
+		{"fixed", Promotion{Type: TypeFixed, AmountOff: usd(1000), ProductIDs: []string{"3"}}, 1000, false},
+		{"fixed capped at eligible items", Promotion{Type: TypeFixed, AmountOff: usd(5000), ProductIDs: []string{"3"}}, 2500, false},
+		// Buy 2 get 1: the helmets and lock are grouped most expensive first, so one helmet is free
+		{"buy x get y", Promotion{Type: TypeBuyXGetY, BuyQuantity: 2, GetQuantity: 1, ProductIDs: []string{"2", "3"}}, 4000, false},
+		{"buy x get y too few items", Promotion{Type: TypeBuyXGetY, BuyQuantity: 4, GetQuantity: 1, ProductIDs: []string{"2"}}, 0, true},
+		{"nothing eligible", Promotion{Type: TypePercent, PercentOff: "10", ProductIDs: []string{"9"}}, 0, true},
+	}
+	for _, tt := range tests {
+		discount, err := tt.promo.Apply(lines)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: Apply = %+v, want error", tt.name, discount)
+			}
+			continue
+		}
+		if err != nil || discount.Amount != usd(tt.want) {
+			t.Errorf("%s: Apply = %+v, %v, want %d minor units", tt.name, discount, err, tt.want)
+		}
+	}
+
+	discount, err := (&Promotion{Type: TypeFreeShipping, ProductIDs: []string{"9"}}).Apply(lines)
+	if err != nil || !discount.FreeShipping || !discount.Amount.IsZero() {
+		t.Errorf("free shipping: Apply = %+v, %v", discount, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		promo   Promotion
+		wantErr bool
+	}{
+		{"percent", Promotion{Code: " spring15 ", Type: TypePercent, PercentOff: "15"}, false},
+		{"percent over 100", Promotion{Code: "X", Type: TypePercent, PercentOff: "100.5"}, true},
+		{"fixed without amount", Promotion{Code: "X", Type: TypeFixed}, true},
+		{"buy x get y without get", Promotion{Code: "X", Type: TypeBuyXGetY, BuyQuantity: 2}, true},
+		{"no code", Promotion{Type: TypeFreeShipping}, true},
+		{"unknown type", Promotion{Code: "X", Type: "bogo"}, true},
+		{"ends before it starts", Promotion{Code: "X", Type: TypeFreeShipping, StartsAt: &start, EndsAt: &start}, true},
+		{"zero usage limit", Promotion{Code: "X", Type: TypeFreeShipping, MaxRedemptions: limit(0)}, true},
+		{"zero customer limit", Promotion{Code: "X", Type: TypeFreeShipping, MaxRedemptionsPerCustomer: limit(0)}, true},
+	}
+	for _, tt := range tests {
+		err := tt.promo.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package receipts
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Page geometry for US Letter in points, with a monospaced body so columns line up without
+// font metrics
+const (
+	pageWidth    = 612
+	pageHeight   = 792
+	margin       = 50
+	bodySize     = 10
+	lineHeight   = 14
+	bodyColumns  = 85
+	titleSize    = 18
+	titleSpacing = 26
+)
+
+// PDF font resource names, defined in writePDF
+const (
+	fontBody  = "F1"
+	fontBold  = "F2"
+	fontTitle = "F3"
+)
+
+// pdfLine is one line of text on the page
+type pdfLine struct {
+	font string
+	size int
+	text string
+}
+
+// RenderPDF renders the receipt as a PDF document. It uses only the standard PDF fonts, so the
+// file has no embedded fonts and no external dependencies.
+func RenderPDF(receipt Receipt) []byte {
+	return writePDF(paginate(receiptLines(receipt)))
+}
+
+// receiptLines lays the receipt out as fixed-width text
+func receiptLines(r Receipt) []pdfLine {
+	var lines []pdfLine
+	body := func(format string, args ...interface{}) {
+		lines = append(lines, pdfLine{font: fontBody, size: bodySize, text: fmt.Sprintf(format, args...)})
+	}
+	bold := func(format string, args ...interface{}) {
+		lines = append(lines, pdfLine{font: fontBold, size: bodySize, text: fmt.Sprintf(format, args...)})
+	}
+	total := func(label, amount string) {
+		body("%*s %18s", bodyColumns-19, label, amount)
+	}
+
+	lines = append(lines, pdfLine{font: fontTitle, size: titleSize, text: "Invisimart"})
+	bold("Receipt")
+	body("")
+	body("Invoice number: %s", r.InvoiceNumber)
+	body("Order:          %s", r.OrderID)
+	body("Date:           %s", r.IssuedAt.Format("January 2, 2006"))
+	body("Status:         %s", r.Status)
+	body("")
+
+	bold("Billed to")
+	body("%s", r.CustomerName)
+	body("%s", r.CustomerEmail)
+	for _, line := range strings.Split(r.BillingAddress, "\n") {
+		for _, wrapped := range wrap(strings.TrimSpace(line), bodyColumns) {
+			body("%s", wrapped)
+		}
+	}
+	if r.MaskedCard != "" {
+		body("")
+		body("Paid with card %s", r.MaskedCard)
+		if r.CardExpiry != "" {
+			body("Card expires %s", r.CardExpiry)
+		}
+	}
+	body("")
+
+	bold("%-40s %5s %18s %18s", "Item", "Qty", "Unit price", "Amount")
+	body("%s", strings.Repeat("-", bodyColumns-1))
+	for _, line := range r.Lines {
+		description := wrap(line.Description, 40)
+		body("%-40s %5d %18s %18s", description[0], line.Quantity, line.UnitPrice, line.Amount)
+		for _, rest := range description[1:] {
+			body("%s", rest)
+		}
+	}
+	body("%s", strings.Repeat("-", bodyColumns-1))
+
+	total("Subtotal", r.Subtotal.String())
+	if !r.Discount.IsZero() {
+		label := "Discount"
+		if r.PromoCode != "" {
+			label += " (" + r.PromoCode + ")"
+		}
+		total(label, "-"+r.Discount.String())
+	}
+	shipping := "Shipping"
+	if r.ShippingMethod != "" {
+		shipping += " (" + r.ShippingMethod + ")"
+	}
+	total(shipping, r.Shipping.String())
+	if len(r.TaxLines) == 0 {
+		total("Tax", r.Tax.String())
+	}
+	for _, tax := range r.TaxLines {
+		total(fmt.Sprintf("%s (%s)", tax.Name, FormatRate(tax.Rate)), tax.Amount.String())
+	}
+	lines = append(lines, pdfLine{font: fontBold, size: bodySize,
+		text: fmt.Sprintf("%*s %18s", bodyColumns-19, "Total", r.Total)})
+	if !r.Refunded.IsZero() {
+		total("Refunded", "-"+r.Refunded.String())
+	}
+	return lines
+}
+
+// wrap splits text into lines of at most width characters, breaking on spaces where possible
+func wrap(text string, width int) []string {
+	var lines []string
+	for utf8.RuneCountInString(text) > width {
+		runes := []rune(text)
+		cut := width
+		for i := width; i > 0; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		lines = append(lines, strings.TrimSpace(string(runes[:cut])))
+		text = strings.TrimSpace(string(runes[cut:]))
+	}
+	return append(lines, text)
+}
+
+// paginate splits lines into pages that fit between the margins
+func paginate(lines []pdfLine) [][]pdfLine {
+	var pages [][]pdfLine
+	var page []pdfLine
+	used := 0
+	for _, line := range lines {
+		height := lineHeight
+		if line.size == titleSize {
+			height = titleSpacing
+		}
+		if used+height > pageHeight-2*margin && len(page) > 0 {
+			pages = append(pages, page)
+			page, used = nil, 0
+		}
+		page = append(page, line)
+		used += height
+	}
+	return append(pages, page)
+}
+
+// writePDF serializes pages of text as a PDF 1.4 document
+func writePDF(pages [][]pdfLine) []byte {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// Objects 1-5 are fixed; each page then adds a page object and its content stream
+	const firstPage = 6
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] "+
+			"/Resources << /Font << /%s 3 0 R /%s 4 0 R /%s 5 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, fontBody, fontBold, fontTitle, firstPage+2*i+1))
+
+		var content bytes.Buffer
+		y := pageHeight - margin
+		for _, line := range page {
+			if line.size == titleSize {
+				y -= titleSpacing - lineHeight
+			}
+			fmt.Fprintf(&content, "BT /%s %d Tf %d %d Td (%s) Tj ET\n", line.font, line.size, margin, y, pdfString(line.text))
+			y -= lineHeight
+		}
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
+
+// pdfString escapes text for a PDF literal string in WinAnsiEncoding. Characters outside
+// Latin-1 have no glyph in the standard fonts and are replaced with "?".
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			b.WriteString(fmt.Sprintf("\\%03o", r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
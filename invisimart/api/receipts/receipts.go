@@ -0,0 +1,75 @@
+package receipts
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	"invisimart-api/money"
+	"invisimart-api/pricing"
+)
+
+//go:embed templates/*
+var templateFS embed.FS
+
+var receiptHTML = template.Must(template.New("receipt.html").
+	Funcs(template.FuncMap{"percent": FormatRate}).
+	ParseFS(templateFS, "templates/receipt.html"))
+
+// Line is one item on a receipt
+type Line struct {
+	ProductID   string
+	Description string
+	Quantity    int
+	UnitPrice   money.Money
+	Amount      money.Money
+}
+
+// Receipt is everything printed on an order's receipt. MaskedCard must already be masked;
+// CardExpiry is MM/YYYY, or empty when the customer did not give one.
+type Receipt struct {
+	InvoiceNumber  string
+	OrderID        string
+	IssuedAt       time.Time
+	Status         string
+	CustomerName   string
+	CustomerEmail  string
+	BillingAddress string
+	Lines          []Line
+	Subtotal       money.Money
+	Discount       money.Money
+	PromoCode      string
+	Shipping       money.Money
+	ShippingMethod string
+	TaxLines       []pricing.TaxLine
+	Tax            money.Money
+	Total          money.Money
+	Refunded       money.Money
+	MaskedCard     string
+	CardExpiry     string
+}
+
+// FormatInvoiceNumber renders a sequential invoice number for display
+func FormatInvoiceNumber(number int64) string {
+	return fmt.Sprintf("%08d", number)
+}
+
+// FormatRate renders a tax rate fraction such as "0.0725" as a percentage such as "7.25%"
+func FormatRate(rate string) string {
+	r, ok := new(big.Rat).SetString(rate)
+	if !ok {
+		return rate
+	}
+	pct := new(big.Rat).Mul(r, big.NewRat(100, 1)).FloatString(4)
+	pct = strings.TrimRight(strings.TrimRight(pct, "0"), ".")
+	return pct + "%"
+}
+
+// RenderHTML writes the printable HTML receipt
+func RenderHTML(w io.Writer, receipt Receipt) error {
+	return receiptHTML.Execute(w, receipt)
+}
@@ -0,0 +1,165 @@
+package validation
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Card brands detected by CardBrand
+const (
+	BrandVisa       = "visa"
+	BrandMastercard = "mastercard"
+	BrandAmex       = "amex"
+	BrandDiscover   = "discover"
+	BrandDiners     = "diners"
+	BrandJCB        = "jcb"
+	BrandUnknown    = "unknown"
+)
+
+// brandNames are the display names of the card brands
+var brandNames = map[string]string{
+	BrandVisa:       "Visa",
+	BrandMastercard: "Mastercard",
+	BrandAmex:       "American Express",
+	BrandDiscover:   "Discover",
+	BrandDiners:     "Diners Club",
+	BrandJCB:        "JCB",
+}
+
+// BrandName returns the display name of a card brand, or "" for an unknown brand
+func BrandName(brand string) string {
+	return brandNames[brand]
+}
+
+// maxCardExpiryYears is how far in the future a card expiry may be
+const maxCardExpiryYears = 20
+
+// cardRange maps an inclusive range of card number prefixes to a brand and its valid lengths
+type cardRange struct {
+	low, high int
+	brand     string
+	lengths   []int
+}
+
+// cardRanges lists the IIN ranges of the supported brands. Prefixes of different widths are
+// compared against the same number of leading digits.
+var cardRanges = []cardRange{
+	{4, 4, BrandVisa, []int{13, 16, 19}},
+	{51, 55, BrandMastercard, []int{16}},
+	{2221, 2720, BrandMastercard, []int{16}},
+	{34, 34, BrandAmex, []int{15}},
+	{37, 37, BrandAmex, []int{15}},
+	{6011, 6011, BrandDiscover, []int{16, 19}},
+	{644, 649, BrandDiscover, []int{16, 19}},
+	{65, 65, BrandDiscover, []int{16, 19}},
+	{300, 305, BrandDiners, []int{14}},
+	{36, 36, BrandDiners, []int{14}},
+	{38, 39, BrandDiners, []int{14}},
+	{3528, 3589, BrandJCB, []int{16, 19}},
+}
+
+// NormalizeCardNumber strips the spaces and dashes customers type between card digits
+func NormalizeCardNumber(number string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(number))
+}
+
+// Luhn reports whether a string of digits passes the Luhn (mod 10) checksum
+func Luhn(digits string) bool {
+	if len(digits) < 2 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		c := digits[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// CardBrand detects the brand of a normalized card number from its prefix and length, or
+// returns BrandUnknown
+func CardBrand(digits string) string {
+	for _, r := range cardRanges {
+		width := len(strconv.Itoa(r.low))
+		if len(digits) < width {
+			continue
+		}
+		prefix, err := strconv.Atoi(digits[:width])
+		if err != nil || prefix < r.low || prefix > r.high {
+			continue
+		}
+		for _, length := range r.lengths {
+			if len(digits) == length {
+				return r.brand
+			}
+		}
+	}
+	return BrandUnknown
+}
+
+// CheckCard validates a card number, including that its brand is supported, and returns it
+// normalized
+func (e *Errors) CheckCard(field, number string) string {
+	digits := NormalizeCardNumber(number)
+	if !e.Required(field, digits, "Card number") {
+		return digits
+	}
+	if !Luhn(digits) {
+		e.Add(field, CodeInvalidCardNumber, "Card number is not valid")
+		return digits
+	}
+	if CardBrand(digits) == BrandUnknown {
+		e.Add(field, CodeUnsupportedCardBrand, "Card type is not supported")
+	}
+	return digits
+}
+
+// CheckCardExpiry validates an optional card expiry and returns the year in four digits.
+// Both fields are zero when no expiry was given; otherwise both are required, a two-digit
+// year is taken to be in this century, and the card must not have expired before now.
+func (e *Errors) CheckCardExpiry(monthField, yearField string, month, year int, now time.Time) (int, int) {
+	if month == 0 && year == 0 {
+		return 0, 0
+	}
+	if month == 0 {
+		e.Add(monthField, CodeRequired, "Expiry month is required when an expiry year is given")
+		return month, year
+	}
+	if year == 0 {
+		e.Add(yearField, CodeRequired, "Expiry year is required when an expiry month is given")
+		return month, year
+	}
+
+	if year > 0 && year < 100 {
+		year += 2000
+	}
+	valid := true
+	if month < 1 || month > 12 {
+		e.Add(monthField, CodeInvalidCardExpiry, "Expiry month must be between 1 and 12")
+		valid = false
+	}
+	if year < now.Year() || year > now.Year()+maxCardExpiryYears {
+		e.Addf(yearField, CodeInvalidCardExpiry, "Expiry year must be between %d and %d",
+			now.Year(), now.Year()+maxCardExpiryYears)
+		valid = false
+	}
+	// A card is valid through the last day of its expiry month
+	if valid && year == now.Year() && month < int(now.Month()) {
+		e.Add(monthField, CodeCardExpired, "Card has expired")
+	}
+	return month, year
+}
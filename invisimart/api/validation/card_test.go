@@ -0,0 +1,158 @@
+package validation
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLuhn(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   bool
+	}{
+		{"4111111111111111", true},
+		{"4111111111111112", false},
+		{"5555555555554444", true},
+		{"378282246310005", true},
+		{"6011111111111117", true},
+		{"30569309025904", true},
+		{"3530111333300000", true},
+		{"79927398713", true},
+		{"79927398710", false},
+		// A doubled digit above 9 has 9 taken off: 18 counts as 9
+		{"91", true},
+		{"00", true},
+		{"0", false},
+		{"", false},
+		{"4111 1111 1111 1111", false},
+		{"411111111111111a", false},
+	}
+	for _, tt := range tests {
+		if got := Luhn(tt.digits); got != tt.want {
+			t.Errorf("Luhn(%q) = %v, want %v", tt.digits, got, tt.want)
+		}
+	}
+}
+
+func TestCardBrand(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   string
+	}{
+		{"4111111111111111", BrandVisa},
+		{"4222222222222", BrandVisa},
+		{"4111111111111111111", BrandVisa},
+		{"411111111111111", BrandUnknown},
+		{"5105105105105100", BrandMastercard},
+		{"5555555555554444", BrandMastercard},
+		{"2221000000000009", BrandMastercard},
+		{"2720990000000007", BrandMastercard},
+		{"2220990000000000", BrandUnknown},
+		{"2721000000000000", BrandUnknown},
+		{"5655555555554444", BrandUnknown},
+		{"378282246310005", BrandAmex},
+		{"341111111111111", BrandAmex},
+		{"3782822463100050", BrandUnknown},
+		{"6011111111111117", BrandDiscover},
+		{"6445644564456445", BrandDiscover},
+		{"6500000000000002", BrandDiscover},
+		{"6011000000000000004", BrandDiscover},
+		{"30569309025904", BrandDiners},
+		{"36000000000008", BrandDiners},
+		{"38520000023237", BrandDiners},
+		{"30600000000000", BrandUnknown},
+		{"3530111333300000", BrandJCB},
+		{"3589000000000000", BrandJCB},
+		{"3527000000000000", BrandUnknown},
+		{"", BrandUnknown},
+		{"4", BrandUnknown},
+	}
+	for _, tt := range tests {
+		if got := CardBrand(tt.digits); got != tt.want {
+			t.Errorf("CardBrand(%q) = %q, want %q", tt.digits, got, tt.want)
+		}
+	}
+}
+
+func TestCheckCard(t *testing.T) {
+	tests := []struct {
+		number   string
+		want     string
+		wantCode string
+	}{
+		{"4111 1111-1111 1111", "4111111111111111", ""},
+		{"", "", CodeRequired},
+		{"4111111111111112", "4111111111111112", CodeInvalidCardNumber},
+		// Passes Luhn but matches no supported brand
+		{"79927398713", "79927398713", CodeUnsupportedCardBrand},
+	}
+	for _, tt := range tests {
+		var errs Errors
+		got := errs.CheckCard("creditCard", tt.number)
+		if got != tt.want {
+			t.Errorf("CheckCard(%q) = %q, want %q", tt.number, got, tt.want)
+		}
+		code := ""
+		if len(errs) > 0 {
+			code = errs[0].Code
+		}
+		if len(errs) > 1 || code != tt.wantCode {
+			t.Errorf("CheckCard(%q) errors = %+v, want code %q", tt.number, errs, tt.wantCode)
+		}
+	}
+}
+
+func TestCheckCardExpiry(t *testing.T) {
+	now := time.Date(2026, time.June, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		month     int
+		year      int
+		wantMonth int
+		wantYear  int
+		// wantCodes lists the expected error codes by field
+		wantCodes map[string]string
+	}{
+		{name: "no expiry", month: 0, year: 0},
+		{name: "four-digit year", month: 9, year: 2028, wantMonth: 9, wantYear: 2028},
+		{name: "two-digit year", month: 9, year: 28, wantMonth: 9, wantYear: 2028},
+		{name: "current month is still valid", month: 6, year: 2026, wantMonth: 6, wantYear: 2026},
+		{name: "last month has expired", month: 5, year: 26, wantMonth: 5, wantYear: 2026,
+			wantCodes: map[string]string{"month": CodeCardExpired}},
+		{name: "last year", month: 12, year: 2025, wantMonth: 12, wantYear: 2025,
+			wantCodes: map[string]string{"year": CodeInvalidCardExpiry}},
+		{name: "twenty years out", month: 1, year: 2046, wantMonth: 1, wantYear: 2046},
+		{name: "too far out", month: 1, year: 2047, wantMonth: 1, wantYear: 2047,
+			wantCodes: map[string]string{"year": CodeInvalidCardExpiry}},
+		{name: "month out of range", month: 13, year: 2028, wantMonth: 13, wantYear: 2028,
+			wantCodes: map[string]string{"month": CodeInvalidCardExpiry}},
+		{name: "both out of range", month: -1, year: 2020, wantMonth: -1, wantYear: 2020,
+			wantCodes: map[string]string{"month": CodeInvalidCardExpiry, "year": CodeInvalidCardExpiry}},
+		{name: "month without year", month: 9, year: 0, wantMonth: 9, wantYear: 0,
+			wantCodes: map[string]string{"year": CodeRequired}},
+		{name: "year without month", month: 0, year: 2028, wantMonth: 0, wantYear: 2028,
+			wantCodes: map[string]string{"month": CodeRequired}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs Errors
+			month, year := errs.CheckCardExpiry("month", "year", tt.month, tt.year, now)
+			if month != tt.wantMonth || year != tt.wantYear {
+				t.Errorf("expiry = %d/%d, want %d/%d", month, year, tt.wantMonth, tt.wantYear)
+			}
+
+			got := map[string]string{}
+			for _, e := range errs {
+				got[e.Field] = e.Code
+			}
+			if len(got) != len(tt.wantCodes) || len(errs) != len(tt.wantCodes) {
+				t.Fatalf("errors = %+v, want %v", errs, tt.wantCodes)
+			}
+			for field, code := range tt.wantCodes {
+				if got[field] != code {
+					t.Errorf("%s error = %q, want %q", field, got[field], code)
+				}
+			}
+		})
+	}
+}
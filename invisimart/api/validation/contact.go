@@ -0,0 +1,99 @@
+package validation
+
+import (
+	"net/mail"
+	"strings"
+)
+
+const (
+	// DefaultCountryCode is assumed for phone numbers entered without one
+	DefaultCountryCode = "1"
+
+	// maxE164Digits is the longest number E.164 allows, country code included
+	maxE164Digits = 15
+
+	// minE164Digits is shorter than any real subscriber number with its country code
+	minE164Digits = 8
+)
+
+// NormalizeEmail parses an RFC 5322 address and returns the bare address. Display names
+// ("Jane <jane@example.com>") are rejected because the field holds a single address.
+func NormalizeEmail(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Name != "" || addr.Address != value {
+		return "", false
+	}
+
+	at := strings.LastIndex(addr.Address, "@")
+	domain := addr.Address[at+1:]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", false
+	}
+	// Domains are case-insensitive; the local part is left as typed
+	return addr.Address[:at+1] + strings.ToLower(domain), true
+}
+
+// NormalizePhone converts a phone number to E.164 ("+14155550123"). Punctuation is ignored;
+// numbers without a leading "+" are assumed to be in DefaultCountryCode, and a national
+// number that already starts with that code is not prefixed twice.
+func NormalizePhone(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	international := strings.HasPrefix(value, "+")
+
+	var digits strings.Builder
+	for i, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+		case strings.ContainsRune(" -.()", r):
+		default:
+			return "", false
+		}
+	}
+
+	number := digits.String()
+	if !international {
+		// National numbers in the default region are ten digits, optionally with the country code
+		switch {
+		case len(number) == 10:
+			number = DefaultCountryCode + number
+		case len(number) == 11 && strings.HasPrefix(number, DefaultCountryCode):
+		default:
+			return "", false
+		}
+	}
+
+	if len(number) < minE164Digits || len(number) > maxE164Digits || number[0] == '0' {
+		return "", false
+	}
+	return "+" + number, true
+}
+
+// CheckEmail validates an email address and returns it normalized
+func (e *Errors) CheckEmail(field, value string) string {
+	if !e.Required(field, value, "Email address") {
+		return value
+	}
+	normalized, ok := NormalizeEmail(value)
+	if !ok {
+		e.Add(field, CodeInvalidEmail, "Email address is not valid")
+		return value
+	}
+	e.MaxLength(field, normalized, "Email address", 255)
+	return normalized
+}
+
+// CheckPhone validates a phone number and returns it in E.164 form
+func (e *Errors) CheckPhone(field, value string) string {
+	if !e.Required(field, value, "Phone number") {
+		return value
+	}
+	normalized, ok := NormalizePhone(value)
+	if !ok {
+		e.Add(field, CodeInvalidPhone, "Phone number is not valid")
+		return value
+	}
+	return normalized
+}
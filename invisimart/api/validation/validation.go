@@ -0,0 +1,60 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error codes reported in FieldError.Code
+const (
+	CodeRequired             = "required"
+	CodeTooLong              = "too_long"
+	CodeInvalidEmail         = "invalid_email"
+	CodeInvalidPhone         = "invalid_phone"
+	CodeInvalidCardNumber    = "invalid_card_number"
+	CodeUnsupportedCardBrand = "unsupported_card_brand"
+	CodeInvalidCardExpiry    = "invalid_card_expiry"
+	CodeCardExpired          = "card_expired"
+	CodeInvalidQuantity      = "invalid_quantity"
+	CodeQuantityTooLarge     = "quantity_too_large"
+	CodeDuplicate            = "duplicate"
+	CodeUnsupportedValue     = "unsupported_value"
+	CodeInvalidCurrency      = "invalid_currency"
+)
+
+// FieldError describes one invalid input. Field uses the JSON name of the request field, with
+// an index for list entries, such as "items[2].quantity".
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Errors collects every problem found in a request so they can all be reported at once
+type Errors []FieldError
+
+// Add records a problem with a field
+func (e *Errors) Add(field, code, message string) {
+	*e = append(*e, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Addf records a problem with a field using a formatted message
+func (e *Errors) Addf(field, code, format string, args ...interface{}) {
+	e.Add(field, code, fmt.Sprintf(format, args...))
+}
+
+// Required records a missing value and reports whether value was present
+func (e *Errors) Required(field, value, label string) bool {
+	if strings.TrimSpace(value) == "" {
+		e.Addf(field, CodeRequired, "%s is required", label)
+		return false
+	}
+	return true
+}
+
+// MaxLength records a value longer than max characters
+func (e *Errors) MaxLength(field, value, label string, max int) {
+	if len([]rune(value)) > max {
+		e.Addf(field, CodeTooLong, "%s must be at most %d characters", label, max)
+	}
+}
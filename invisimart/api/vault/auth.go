@@ -0,0 +1,228 @@
+package vault
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// Auth methods selected with VAULT_AUTH_METHOD
+const (
+	AuthToken      = "token"
+	AuthTokenFile  = "token_file"
+	AuthAppRole    = "approle"
+	AuthJWT        = "jwt"
+	AuthKubernetes = "kubernetes"
+)
+
+// defaultKubernetesTokenFile is where Kubernetes mounts the pod's service account token
+const defaultKubernetesTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// authMethod obtains a Vault token. login is given a client without a token and returns a
+// secret whose Auth holds the new token, its TTL and whether it can be renewed.
+type authMethod interface {
+	login(c *vault.Client) (*vault.Secret, error)
+}
+
+// authFromEnv builds the auth method named by VAULT_AUTH_METHOD, defaulting to a static
+// VAULT_TOKEN as before. VAULT_AUTH_MOUNT overrides where the method is mounted.
+func authFromEnv() (authMethod, error) {
+	method := strings.ToLower(strings.TrimSpace(os.Getenv("VAULT_AUTH_METHOD")))
+	if method == "" {
+		method = AuthToken
+	}
+	mount := strings.Trim(os.Getenv("VAULT_AUTH_MOUNT"), "/")
+	if mount == "" {
+		mount = method
+	}
+
+	switch method {
+	case AuthToken:
+		token := os.Getenv("VAULT_TOKEN")
+		if token == "" {
+			return nil, fmt.Errorf("VAULT_TOKEN is required for the token auth method")
+		}
+		return staticToken{token: token}, nil
+
+	case AuthTokenFile:
+		path := os.Getenv("VAULT_TOKEN_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("VAULT_TOKEN_FILE is required for the token_file auth method")
+		}
+		return &tokenFile{path: path}, nil
+
+	case AuthAppRole:
+		roleID := os.Getenv("VAULT_ROLE_ID")
+		if roleID == "" {
+			return nil, fmt.Errorf("VAULT_ROLE_ID is required for the approle auth method")
+		}
+		return appRole{
+			mount:        mount,
+			roleID:       roleID,
+			secretID:     os.Getenv("VAULT_SECRET_ID"),
+			secretIDFile: os.Getenv("VAULT_SECRET_ID_FILE"),
+		}, nil
+
+	case AuthJWT:
+		jwt, jwtFile := os.Getenv("VAULT_JWT"), os.Getenv("VAULT_JWT_FILE")
+		if jwt == "" && jwtFile == "" {
+			return nil, fmt.Errorf("VAULT_JWT or VAULT_JWT_FILE is required for the jwt auth method")
+		}
+		return roleLogin{mount: mount, role: os.Getenv("VAULT_AUTH_ROLE"), jwt: jwt, jwtFile: jwtFile}, nil
+
+	case AuthKubernetes:
+		role := os.Getenv("VAULT_AUTH_ROLE")
+		if role == "" {
+			return nil, fmt.Errorf("VAULT_AUTH_ROLE is required for the kubernetes auth method")
+		}
+		jwtFile := os.Getenv("VAULT_K8S_TOKEN_FILE")
+		if jwtFile == "" {
+			jwtFile = defaultKubernetesTokenFile
+		}
+		return roleLogin{mount: mount, role: role, jwtFile: jwtFile}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown VAULT_AUTH_METHOD %q", method)
+	}
+}
+
+// staticToken uses a token handed to the API, such as VAULT_TOKEN. It can be renewed but
+// not replaced, so once it reaches its max TTL Vault access is lost.
+type staticToken struct {
+	token string
+}
+
+func (t staticToken) login(c *vault.Client) (*vault.Secret, error) {
+	return lookupToken(c, t.token)
+}
+
+// tokenFile reads the token a Vault Agent sink writes. The agent keeps the file current, so
+// the token is read again whenever the file changes.
+type tokenFile struct {
+	path    string
+	modTime time.Time
+}
+
+func (t *tokenFile) login(c *vault.Client) (*vault.Secret, error) {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read Vault token file: %w", err)
+	}
+	token, err := readCredential(t.path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read Vault token file: %w", err)
+	}
+	secret, err := lookupToken(c, token)
+	if err != nil {
+		return nil, err
+	}
+	t.modTime = info.ModTime()
+	return secret, nil
+}
+
+// changed reports whether the file has been rewritten since the token was last read
+func (t *tokenFile) changed() bool {
+	info, err := os.Stat(t.path)
+	return err == nil && !info.ModTime().Equal(t.modTime)
+}
+
+// appRole logs in with a role ID and, unless the role does not require one, a secret ID
+type appRole struct {
+	mount        string
+	roleID       string
+	secretID     string
+	secretIDFile string
+}
+
+func (a appRole) login(c *vault.Client) (*vault.Secret, error) {
+	data := map[string]interface{}{"role_id": a.roleID}
+
+	secretID := a.secretID
+	if a.secretIDFile != "" {
+		var err error
+		if secretID, err = readCredential(a.secretIDFile); err != nil {
+			return nil, fmt.Errorf("unable to read AppRole secret ID: %w", err)
+		}
+	}
+	if secretID != "" {
+		data["secret_id"] = secretID
+	}
+	return write(c, a.mount, data)
+}
+
+// roleLogin exchanges a JWT for a token under a role. The jwt and kubernetes methods share
+// it; their JWTs are rotated on disk, so a file is read again on every login.
+type roleLogin struct {
+	mount   string
+	role    string
+	jwt     string
+	jwtFile string
+}
+
+func (l roleLogin) login(c *vault.Client) (*vault.Secret, error) {
+	jwt := l.jwt
+	if l.jwtFile != "" {
+		var err error
+		if jwt, err = readCredential(l.jwtFile); err != nil {
+			return nil, fmt.Errorf("unable to read JWT for Vault login: %w", err)
+		}
+	}
+
+	data := map[string]interface{}{"jwt": jwt}
+	if l.role != "" {
+		data["role"] = l.role
+	}
+	return write(c, l.mount, data)
+}
+
+// write logs in at auth/<mount>/login
+func write(c *vault.Client, mount string, data map[string]interface{}) (*vault.Secret, error) {
+	secret, err := c.Logical().Write(fmt.Sprintf("auth/%s/login", mount), data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to log in to Vault at auth/%s: %w", mount, err)
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return nil, fmt.Errorf("no token returned by Vault login at auth/%s", mount)
+	}
+	return secret, nil
+}
+
+// lookupToken checks an existing token and describes it the way a login response would, so
+// it can be renewed like one
+func lookupToken(c *vault.Client, token string) (*vault.Secret, error) {
+	c.SetToken(token)
+	info, err := c.Auth().Token().LookupSelf()
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up Vault token: %w", err)
+	}
+
+	ttl, err := info.TokenTTL()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read Vault token TTL: %w", err)
+	}
+	renewable, err := info.TokenIsRenewable()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read Vault token renewability: %w", err)
+	}
+	return &vault.Secret{Auth: &vault.SecretAuth{
+		ClientToken:   token,
+		LeaseDuration: int(ttl.Seconds()),
+		Renewable:     renewable,
+	}}, nil
+}
+
+// readCredential reads a token or ID from a file, ignoring surrounding whitespace
+func readCredential(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	credential := strings.TrimSpace(string(data))
+	if credential == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return credential, nil
+}
@@ -0,0 +1,166 @@
+package vault
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// authEnv lists every variable authFromEnv reads
+var authEnv = []string{
+	"VAULT_AUTH_METHOD", "VAULT_AUTH_MOUNT", "VAULT_AUTH_ROLE", "VAULT_TOKEN", "VAULT_TOKEN_FILE",
+	"VAULT_ROLE_ID", "VAULT_SECRET_ID", "VAULT_SECRET_ID_FILE", "VAULT_JWT", "VAULT_JWT_FILE",
+	"VAULT_K8S_TOKEN_FILE",
+}
+
+func TestAuthFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    authMethod
+		wantErr bool
+	}{
+		{
+			name: "defaults to a static token",
+			env:  map[string]string{"VAULT_TOKEN": "s.token"},
+			want: staticToken{token: "s.token"},
+		},
+		{
+			name:    "token without VAULT_TOKEN",
+			env:     map[string]string{"VAULT_AUTH_METHOD": "token"},
+			wantErr: true,
+		},
+		{
+			name: "token file",
+			env:  map[string]string{"VAULT_AUTH_METHOD": "token_file", "VAULT_TOKEN_FILE": "/run/vault/token"},
+			want: &tokenFile{path: "/run/vault/token"},
+		},
+		{
+			name:    "token file without a path",
+			env:     map[string]string{"VAULT_AUTH_METHOD": "token_file"},
+			wantErr: true,
+		},
+		{
+			name: "approle on its default mount",
+			env:  map[string]string{"VAULT_AUTH_METHOD": "AppRole", "VAULT_ROLE_ID": "role", "VAULT_SECRET_ID": "secret"},
+			want: appRole{mount: "approle", roleID: "role", secretID: "secret"},
+		},
+		{
+			name: "approle on a custom mount",
+			env: map[string]string{"VAULT_AUTH_METHOD": "approle", "VAULT_AUTH_MOUNT": "/auth-apps/",
+				"VAULT_ROLE_ID": "role", "VAULT_SECRET_ID_FILE": "/run/vault/secret-id"},
+			want: appRole{mount: "auth-apps", roleID: "role", secretIDFile: "/run/vault/secret-id"},
+		},
+		{
+			name:    "approle without a role ID",
+			env:     map[string]string{"VAULT_AUTH_METHOD": "approle", "VAULT_SECRET_ID": "secret"},
+			wantErr: true,
+		},
+		{
+			name: "jwt from a file",
+			env:  map[string]string{"VAULT_AUTH_METHOD": "jwt", "VAULT_AUTH_ROLE": "api", "VAULT_JWT_FILE": "/run/jwt"},
+			want: roleLogin{mount: "jwt", role: "api", jwtFile: "/run/jwt"},
+		},
+		{
+			name:    "jwt without a token",
+			env:     map[string]string{"VAULT_AUTH_METHOD": "jwt", "VAULT_AUTH_ROLE": "api"},
+			wantErr: true,
+		},
+		{
+			name: "kubernetes uses the service account token",
+			env:  map[string]string{"VAULT_AUTH_METHOD": "kubernetes", "VAULT_AUTH_ROLE": "invisimart"},
+			want: roleLogin{mount: "kubernetes", role: "invisimart", jwtFile: defaultKubernetesTokenFile},
+		},
+		{
+			name: "kubernetes with another token file",
+			env: map[string]string{"VAULT_AUTH_METHOD": "kubernetes", "VAULT_AUTH_ROLE": "invisimart",
+				"VAULT_K8S_TOKEN_FILE": "/var/run/vault-token"},
+			want: roleLogin{mount: "kubernetes", role: "invisimart", jwtFile: "/var/run/vault-token"},
+		},
+		{
+			name:    "kubernetes without a role",
+			env:     map[string]string{"VAULT_AUTH_METHOD": "kubernetes"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown method",
+			env:     map[string]string{"VAULT_AUTH_METHOD": "ldap"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range authEnv {
+				t.Setenv(key, tt.env[key])
+			}
+
+			got, err := authFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("authFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("authFromEnv() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenFileChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("s.first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		file    *tokenFile
+		prepare func(t *testing.T)
+		want    bool
+	}{
+		{
+			name: "never read",
+			file: &tokenFile{path: path},
+			want: true,
+		},
+		{
+			name: "unchanged since it was read",
+			file: &tokenFile{path: path, modTime: info.ModTime()},
+			want: false,
+		},
+		{
+			name: "rewritten since it was read",
+			file: &tokenFile{path: path, modTime: info.ModTime()},
+			prepare: func(t *testing.T) {
+				later := info.ModTime().Add(time.Minute)
+				if err := os.Chtimes(path, later, later); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: true,
+		},
+		{
+			// A missing file keeps the current token rather than forcing a login that would fail
+			name: "missing",
+			file: &tokenFile{path: filepath.Join(t.TempDir(), "missing"), modTime: info.ModTime()},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.prepare != nil {
+				tt.prepare(t)
+			}
+			if got := tt.file.changed(); got != tt.want {
+				t.Errorf("changed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,37 +4,72 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
+	"log"
 	"os"
+	"strings"
 
 	vault "github.com/hashicorp/vault/api"
 )
 
-var client *vault.Client
+var (
+	client *vault.Client
+	auth   authMethod
+	// loginSecret is the token obtained at startup, handed over to the lifetime watcher
+	loginSecret *vault.Secret
+)
 
-// InitVault initializes the Vault client with configuration from environment variables
+// InitVault initializes the Vault client with configuration from environment variables and
+// logs in with the method named by VAULT_AUTH_METHOD. A failed login is retried by Start, so
+// only configuration problems are returned.
 func InitVault() error {
+	// DefaultConfig reads VAULT_CACERT and VAULT_CAPATH, and NewClient reads VAULT_NAMESPACE
 	config := vault.DefaultConfig()
+	if config.Error != nil {
+		return fmt.Errorf("unable to configure Vault client: %w", config.Error)
+	}
 
 	vaultAddr := os.Getenv("VAULT_ADDR")
 	if vaultAddr != "" {
 		config.Address = vaultAddr
 	}
 
-	var err error
-	client, err = vault.NewClient(config)
+	method, err := authFromEnv()
 	if err != nil {
-		return fmt.Errorf("unable to initialize Vault client: %w", err)
+		return err
 	}
 
-	// Set token from environment variable if available
-	vaultToken := os.Getenv("VAULT_TOKEN")
-	if vaultToken != "" {
-		client.SetToken(vaultToken)
+	c, err := vault.NewClient(config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize Vault client: %w", err)
 	}
+	// NewClient picks up VAULT_TOKEN; the auth method decides which token is used
+	c.ClearToken()
+	client, auth = c, method
 
+	loginSecret, err = login()
+	if err != nil {
+		log.Printf("Vault login failed, retrying in the background: %v", err)
+	}
 	return nil
 }
 
+// login obtains a new token with the auth method and switches the client to it. The login
+// runs on a copy of the client so requests in flight keep the current token until then.
+func login() (*vault.Secret, error) {
+	loginClient, err := client.CloneWithHeaders()
+	if err != nil {
+		return nil, fmt.Errorf("unable to copy Vault client: %w", err)
+	}
+	loginClient.ClearToken()
+
+	secret, err := auth.login(loginClient)
+	if err != nil {
+		return nil, err
+	}
+	client.SetToken(secret.Auth.ClientToken)
+	return secret, nil
+}
+
 // GetClient returns the initialized Vault client
 func GetClient() (*vault.Client, error) {
 	if client == nil {
@@ -43,14 +78,23 @@ func GetClient() (*vault.Client, error) {
 	return client, nil
 }
 
-// IsAvailable checks if Vault client is available and configured
+// IsAvailable checks if Vault client is available, configured and logged in
 func IsAvailable() bool {
-	return client != nil && os.Getenv("VAULT_ADDR") != ""
+	return client != nil && os.Getenv("VAULT_ADDR") != "" && client.Token() != ""
 }
 
+// mockPrefix marks values produced by MockEncrypt
+const mockPrefix = "mock:v1:"
+
 // MockEncrypt provides a mock encryption for when Vault is not available
 // This uses a simple hash for demonstration purposes only
 func MockEncrypt(plaintext string) string {
 	hash := sha256.Sum256([]byte(plaintext))
-	return fmt.Sprintf("mock:v1:%s", base64.StdEncoding.EncodeToString(hash[:]))
+	return fmt.Sprintf("%s%s", mockPrefix, base64.StdEncoding.EncodeToString(hash[:]))
+}
+
+// IsMockCiphertext reports whether a value came from MockEncrypt. Such values are hashes and
+// cannot be decrypted.
+func IsMockCiphertext(ciphertext string) bool {
+	return strings.HasPrefix(ciphertext, mockPrefix)
 }
@@ -0,0 +1,96 @@
+package vault
+
+import (
+	"context"
+	"log"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+const (
+	// loginRetryMin and loginRetryMax bound the backoff between failed logins
+	loginRetryMin = 5 * time.Second
+	loginRetryMax = 5 * time.Minute
+
+	// tokenFileInterval is how often a Vault Agent token file is checked for a new token
+	tokenFileInterval = 30 * time.Second
+)
+
+// Start keeps the Vault token valid until ctx is cancelled. It renews the token while Vault
+// allows it and logs in again once it cannot, such as when the token reaches its max TTL. A
+// static VAULT_TOKEN cannot be replaced, so when it runs out Start only logs a warning.
+func Start(ctx context.Context) {
+	if client == nil || auth == nil {
+		return
+	}
+
+	var fileChecks <-chan time.Time
+	if _, ok := auth.(*tokenFile); ok {
+		ticker := time.NewTicker(tokenFileInterval)
+		defer ticker.Stop()
+		fileChecks = ticker.C
+	}
+
+	secret := loginSecret
+	retry := loginRetryMin
+	for {
+		if secret == nil {
+			var err error
+			if secret, err = login(); err != nil {
+				log.Printf("Vault login failed, retrying in %s: %v", retry, err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(retry):
+				}
+				retry = min(retry*2, loginRetryMax)
+				continue
+			}
+			retry = loginRetryMin
+			log.Printf("Logged in to Vault, token valid for %s", time.Duration(secret.Auth.LeaseDuration)*time.Second)
+		}
+
+		if !watch(ctx, secret, fileChecks) {
+			return
+		}
+		if _, ok := auth.(staticToken); ok {
+			log.Printf("Warning: VAULT_TOKEN is about to expire and cannot be renewed; Vault access will be lost. Use a VAULT_AUTH_METHOD that can log in again.")
+			return
+		}
+		secret = nil
+	}
+}
+
+// watch renews secret's token until it can no longer be renewed or, for a token file, until
+// the file changes. It returns false when ctx is cancelled.
+func watch(ctx context.Context, secret *vault.Secret, fileChecks <-chan time.Time) bool {
+	// A token without a TTL, such as a root token, never expires
+	var done <-chan error
+	if secret.Auth.LeaseDuration > 0 {
+		watcher, err := client.NewLifetimeWatcher(&vault.LifetimeWatcherInput{Secret: secret})
+		if err != nil {
+			log.Printf("Unable to watch Vault token, logging in again: %v", err)
+			return true
+		}
+		go watcher.Start()
+		defer watcher.Stop()
+		done = watcher.DoneCh()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case err := <-done:
+			if err != nil {
+				log.Printf("Vault token renewal failed: %v", err)
+			}
+			return true
+		case <-fileChecks:
+			if auth.(*tokenFile).changed() {
+				return true
+			}
+		}
+	}
+}
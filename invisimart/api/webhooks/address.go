@@ -0,0 +1,105 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// lookupTimeout bounds the DNS lookup made when a subscription URL is validated
+const lookupTimeout = 5 * time.Second
+
+// blockedPrefixes are the special-use ranges from the IANA IPv4 and IPv6 special-purpose
+// registries that deliveries may not reach, with the reason reported when one is refused.
+var blockedPrefixes = []struct {
+	prefix netip.Prefix
+	reason string
+}{
+	{netip.MustParsePrefix("0.0.0.0/8"), `a "this network" address`},
+	{netip.MustParsePrefix("10.0.0.0/8"), "a private address"},
+	{netip.MustParsePrefix("100.64.0.0/10"), "a shared (carrier-grade NAT) address"},
+	{netip.MustParsePrefix("127.0.0.0/8"), "a loopback address"},
+	{netip.MustParsePrefix("169.254.0.0/16"), "a link-local address"},
+	{netip.MustParsePrefix("172.16.0.0/12"), "a private address"},
+	{netip.MustParsePrefix("192.0.0.0/24"), "a protocol assignment address"},
+	{netip.MustParsePrefix("192.0.2.0/24"), "a documentation address"},
+	{netip.MustParsePrefix("192.88.99.0/24"), "a 6to4 relay address"},
+	{netip.MustParsePrefix("192.168.0.0/16"), "a private address"},
+	{netip.MustParsePrefix("198.18.0.0/15"), "a benchmarking address"},
+	{netip.MustParsePrefix("198.51.100.0/24"), "a documentation address"},
+	{netip.MustParsePrefix("203.0.113.0/24"), "a documentation address"},
+	{netip.MustParsePrefix("224.0.0.0/4"), "a multicast address"},
+	{netip.MustParsePrefix("240.0.0.0/4"), "a reserved address"},
+	{netip.MustParsePrefix("::/128"), "the unspecified address"},
+	{netip.MustParsePrefix("::1/128"), "a loopback address"},
+	{netip.MustParsePrefix("64:ff9b::/96"), "a NAT64 address"},
+	{netip.MustParsePrefix("64:ff9b:1::/48"), "a NAT64 address"},
+	{netip.MustParsePrefix("100::/64"), "a discard-only address"},
+	{netip.MustParsePrefix("2001::/23"), "a protocol assignment address"},
+	{netip.MustParsePrefix("2001:db8::/32"), "a documentation address"},
+	{netip.MustParsePrefix("2002::/16"), "a 6to4 address"},
+	{netip.MustParsePrefix("fc00::/7"), "a private address"},
+	{netip.MustParsePrefix("fe80::/10"), "a link-local address"},
+	{netip.MustParsePrefix("fec0::/10"), "a site-local address"},
+	{netip.MustParsePrefix("ff00::/8"), "a multicast address"},
+}
+
+// blockedAddress reports why deliveries may not go to addr, or "" if they may. Subscription
+// URLs come from admins, but a URL that resolves to the API's own network would let anyone
+// with the admin token probe internal services and cloud metadata endpoints. IPv4-mapped
+// IPv6 addresses are checked as the IPv4 address they carry.
+func blockedAddress(addr netip.Addr) string {
+	addr = addr.Unmap().WithZone("")
+	for _, blocked := range blockedPrefixes {
+		if blocked.prefix.Contains(addr) {
+			return blocked.reason
+		}
+	}
+	return ""
+}
+
+// checkHost rejects a subscription host that is, or resolves to, an address deliveries may
+// not reach. A name that does not resolve yet is accepted; every delivery is checked again
+// when it connects.
+func checkHost(host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if reason := blockedAddress(addr); reason != "" {
+			return fmt.Errorf("url host %s is %s", host, reason)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if reason := blockedAddress(addr); reason != "" {
+			return fmt.Errorf("url host %s resolves to %s, which is %s", host, addr, reason)
+		}
+	}
+	return nil
+}
+
+// checkDial is the dialer's Control hook. It runs after DNS resolution for every address
+// a delivery connects to, so a name that is re-pointed at an internal address after the
+// subscription was validated is still refused.
+func checkDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("webhook delivery to unresolved address %s refused", address)
+	}
+	if reason := blockedAddress(addr); reason != "" {
+		return fmt.Errorf("webhook delivery to %s refused: it is %s", address, reason)
+	}
+	return nil
+}
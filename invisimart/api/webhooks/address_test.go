@@ -0,0 +1,98 @@
+package webhooks
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestBlockedAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		blocked bool
+	}{
+		{"0.0.0.0", true},
+		{"0.1.2.3", true},
+		{"10.1.2.3", true},
+		{"100.64.0.1", true},
+		{"100.100.100.200", true},
+		{"100.127.255.255", true},
+		{"100.63.255.255", false},
+		{"100.128.0.0", false},
+		{"127.0.0.1", true},
+		{"169.254.169.254", true},
+		{"172.16.0.1", true},
+		{"172.32.0.1", false},
+		{"192.0.0.170", true},
+		{"192.0.2.10", true},
+		{"192.168.1.1", true},
+		{"198.18.0.1", true},
+		{"203.0.113.5", true},
+		{"224.0.0.1", true},
+		{"255.255.255.255", true},
+		{"8.8.8.8", false},
+		{"93.184.216.34", false},
+		{"::", true},
+		{"::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:169.254.169.254", true},
+		{"::ffff:8.8.8.8", false},
+		{"64:ff9b::a00:1", true},
+		{"2001:db8::1", true},
+		{"2002:c0a8:101::1", true},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"fe80::1%eth0", true},
+		{"ff02::1", true},
+		{"2606:4700:4700::1111", false},
+	}
+
+	for _, tt := range tests {
+		reason := blockedAddress(netip.MustParseAddr(tt.addr))
+		if (reason != "") != tt.blocked {
+			t.Errorf("blockedAddress(%s) = %q, want blocked %v", tt.addr, reason, tt.blocked)
+		}
+	}
+}
+
+func TestCheckHostLiteral(t *testing.T) {
+	tests := []struct {
+		host    string
+		wantErr bool
+	}{
+		{"169.254.169.254", true},
+		{"100.64.1.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"93.184.216.34", false},
+		{"2606:4700:4700::1111", false},
+	}
+
+	for _, tt := range tests {
+		if err := checkHost(tt.host); (err != nil) != tt.wantErr {
+			t.Errorf("checkHost(%s) error = %v, wantErr %v", tt.host, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckDial(t *testing.T) {
+	tests := []struct {
+		address string
+		wantErr bool
+	}{
+		{"127.0.0.1:80", true},
+		{"0.0.0.0:443", true},
+		{"100.64.0.1:443", true},
+		{"[::1]:443", true},
+		{"[fe80::1%eth0]:443", true},
+		{"[::ffff:192.168.0.1]:443", true},
+		{"93.184.216.34:443", false},
+		{"[2606:4700:4700::1111]:443", false},
+		{"example.com:443", true},
+		{"no-port", true},
+	}
+
+	for _, tt := range tests {
+		if err := checkDial("tcp", tt.address, nil); (err != nil) != tt.wantErr {
+			t.Errorf("checkDial(%s) error = %v, wantErr %v", tt.address, err, tt.wantErr)
+		}
+	}
+}
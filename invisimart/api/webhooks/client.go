@@ -0,0 +1,74 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// requestTimeout bounds a single delivery attempt
+const requestTimeout = 10 * time.Second
+
+// maxDrainBody is how much of a response is read, and discarded, so the connection can be reused
+const maxDrainBody = 4096
+
+var client = &http.Client{
+	Timeout: requestTimeout,
+	Transport: &http.Transport{
+		// Deliveries connect directly, so the dialer sees, and can refuse, the subscriber's address
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout:   requestTimeout,
+			KeepAlive: 30 * time.Second,
+			Control:   checkDial,
+		}).DialContext,
+		TLSHandshakeTimeout: requestTimeout,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	// Subscribers must answer at the registered URL; following redirects would let a
+	// compromised endpoint bounce signed payloads elsewhere
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// DeliveryError is returned when a subscriber does not acknowledge a delivery. Only the status
+// code is kept: the response body is the subscriber's, and may echo back anything.
+type DeliveryError struct {
+	StatusCode int
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("subscriber responded with status %d", e.StatusCode)
+}
+
+// Send posts a signed event to a subscriber. Any 2xx response acknowledges the delivery. It
+// returns the response status code, or 0 if no response was received.
+func Send(ctx context.Context, targetURL, secret, deliveryID, eventType string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Invisimart-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, eventType)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderSignature, Sign(secret, time.Now(), body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBody))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, &DeliveryError{StatusCode: resp.StatusCode}
+	}
+	return resp.StatusCode, nil
+}
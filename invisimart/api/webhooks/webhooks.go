@@ -0,0 +1,169 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Event types a subscription can filter on
+const (
+	EventOrderCreated       = "order.created"
+	EventOrderStatusChanged = "order.status_changed"
+	EventStockLow           = "inventory.low_stock"
+	EventStockOut           = "inventory.out_of_stock"
+	EventStockRestocked     = "inventory.restocked"
+)
+
+// EventTypes lists every event type that can be delivered
+var EventTypes = []string{
+	EventOrderCreated,
+	EventOrderStatusChanged,
+	EventStockLow,
+	EventStockOut,
+	EventStockRestocked,
+}
+
+// Delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Invisimart-Event"
+	HeaderDelivery  = "X-Invisimart-Delivery"
+	HeaderSignature = "X-Invisimart-Signature"
+)
+
+const (
+	secretPrefix   = "whsec_"
+	maxURLLength   = 2048
+	initialBackoff = 30 * time.Second
+	maxBackoff     = 6 * time.Hour
+)
+
+// Subscription is a partner endpoint and the events it receives. An empty EventTypes list
+// receives every event.
+type Subscription struct {
+	ID          int      `json:"id"`
+	URL         string   `json:"url"`
+	EventTypes  []string `json:"eventTypes"`
+	Description string   `json:"description,omitempty"`
+	// Secret is only returned when the subscription is created
+	Secret    string `json:"secret,omitempty"`
+	Active    bool   `json:"active"`
+	CreatedAt string `json:"createdAt,omitempty"`
+	UpdatedAt string `json:"updatedAt,omitempty"`
+}
+
+// Validate checks that a subscription definition is complete and consistent, and that its URL
+// does not point at a loopback, private or link-local address
+func (s *Subscription) Validate() error {
+	s.URL = strings.TrimSpace(s.URL)
+	if s.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	if len(s.URL) > maxURLLength {
+		return fmt.Errorf("url must be at most %d characters", maxURLLength)
+	}
+	parsed, err := url.Parse(s.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if err := checkHost(parsed.Hostname()); err != nil {
+		return err
+	}
+
+	for _, eventType := range s.EventTypes {
+		if !isEventType(eventType) {
+			return fmt.Errorf("unknown event type %q", eventType)
+		}
+	}
+	return nil
+}
+
+// isEventType reports whether eventType is one of EventTypes
+func isEventType(eventType string) bool {
+	for _, known := range EventTypes {
+		if known == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is the JSON body posted to subscribers
+type Event struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt string          `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// NewEvent wraps data in an event envelope
+func NewEvent(id, eventType string, data interface{}) ([]byte, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+	return json.Marshal(Event{
+		ID:        id,
+		Type:      eventType,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Data:      encoded,
+	})
+}
+
+// GenerateSecret returns a new random signing secret
+func GenerateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return secretPrefix + hex.EncodeToString(buf), nil
+}
+
+// Sign returns the X-Invisimart-Signature value for a body sent at timestamp. The signature is
+// the hex HMAC-SHA256 of "<unix timestamp>.<body>" keyed with the subscription secret, so
+// receivers can reject both forged and replayed requests.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := timestamp.Unix()
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", unix)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", unix, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// Backoff returns how long to wait before retrying a delivery that has failed attempts times.
+// It doubles from 30 seconds up to 6 hours.
+func Backoff(attempts int) time.Duration {
+	wait := initialBackoff
+	for i := 1; i < attempts && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxBackoff)
+}
+
+// StockEvent returns the event type for a stock change that crosses threshold, or "" if the
+// change crosses nothing. Running out takes precedence over running low.
+func StockEvent(previous, current, threshold int) string {
+	switch {
+	case current <= 0 && previous > 0:
+		return EventStockOut
+	case current <= threshold && previous > threshold:
+		return EventStockLow
+	case current > threshold && previous <= threshold:
+		return EventStockRestocked
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,56 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	timestamp := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"evt_1","type":"order.created"}`)
+
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte("1700000000." + string(body)))
+	want := fmt.Sprintf("t=1700000000,v1=%s", hex.EncodeToString(mac.Sum(nil)))
+
+	got := Sign("whsec_test", timestamp, body)
+	if got != want {
+		t.Fatalf("Sign() = %s, want %s", got, want)
+	}
+	if !strings.HasPrefix(got, "t=1700000000,v1=") || len(got) != len("t=1700000000,v1=")+64 {
+		t.Errorf("Sign() = %s, want t=<unix>,v1=<64 hex chars>", got)
+	}
+
+	if Sign("whsec_other", timestamp, body) == got {
+		t.Error("Sign() did not change with the secret")
+	}
+	if Sign("whsec_test", timestamp.Add(time.Second), body) == got {
+		t.Error("Sign() did not change with the timestamp")
+	}
+	if Sign("whsec_test", timestamp, []byte(`{"id":"evt_2","type":"order.created"}`)) == got {
+		t.Error("Sign() did not change with the body")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{20, 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
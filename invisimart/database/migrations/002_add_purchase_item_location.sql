@@ -0,0 +1,3 @@
+-- Record the inventory location each purchase line was fulfilled from so
+-- cancellations and returns can restock the same location
+ALTER TABLE purchase_items ADD COLUMN IF NOT EXISTS location VARCHAR(100);
@@ -0,0 +1,13 @@
+-- Idempotency keys for POST /purchase so client retries replay the original
+-- response instead of creating a duplicate order
+CREATE TABLE IF NOT EXISTS purchase_idempotency_keys (
+    idempotency_key VARCHAR(255) PRIMARY KEY,
+    request_fingerprint CHAR(64) NOT NULL,
+    order_id VARCHAR(100),
+    status_code INTEGER,
+    response_body TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_idempotency_keys_expires_at ON purchase_idempotency_keys(expires_at);
@@ -0,0 +1,15 @@
+-- Status history for the order lifecycle state machine
+CREATE TABLE IF NOT EXISTS purchase_status_history (
+    id SERIAL PRIMARY KEY,
+    purchase_id INTEGER NOT NULL REFERENCES purchases(id) ON DELETE CASCADE,
+    from_status VARCHAR(50),
+    to_status VARCHAR(50) NOT NULL,
+    changed_by VARCHAR(255) NOT NULL,
+    note TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_status_history_purchase_id ON purchase_status_history(purchase_id, created_at);
+
+-- Orders were previously always written as "completed", which is now "paid"
+UPDATE purchases SET status = 'paid' WHERE status = 'completed';
@@ -0,0 +1,27 @@
+-- Cancellations and refunds recorded against purchases so finance can
+-- reconcile them against purchases.total_amount
+CREATE TABLE IF NOT EXISTS purchase_adjustments (
+    id SERIAL PRIMARY KEY,
+    purchase_id INTEGER NOT NULL REFERENCES purchases(id) ON DELETE CASCADE,
+    adjustment_type VARCHAR(20) NOT NULL,
+    amount NUMERIC(10,2) NOT NULL,
+    reason TEXT,
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS purchase_adjustment_items (
+    id SERIAL PRIMARY KEY,
+    adjustment_id INTEGER NOT NULL REFERENCES purchase_adjustments(id) ON DELETE CASCADE,
+    purchase_item_id INTEGER NOT NULL REFERENCES purchase_items(id) ON DELETE CASCADE,
+    product_id VARCHAR(50) NOT NULL,
+    quantity INTEGER NOT NULL,
+    amount NUMERIC(10,2) NOT NULL,
+    location VARCHAR(100) NOT NULL
+);
+
+ALTER TABLE purchase_items ADD COLUMN IF NOT EXISTS returned_quantity INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS refunded_amount NUMERIC(10,2) NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_purchase_adjustments_purchase_id ON purchase_adjustments(purchase_id);
+CREATE INDEX IF NOT EXISTS idx_purchase_adjustment_items_adjustment_id ON purchase_adjustment_items(adjustment_id);
@@ -0,0 +1,14 @@
+-- Product weights for weight-based shipping
+ALTER TABLE products ADD COLUMN IF NOT EXISTS weight_grams INTEGER NOT NULL DEFAULT 0;
+
+-- Price breakdown computed by the pricing pipeline at checkout.
+-- total_amount = subtotal_amount + shipping_amount + tax_amount
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS subtotal_amount NUMERIC(10,2);
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS shipping_amount NUMERIC(10,2) NOT NULL DEFAULT 0;
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS shipping_method VARCHAR(20);
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS tax_amount NUMERIC(10,2) NOT NULL DEFAULT 0;
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS tax_region VARCHAR(20);
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS tax_lines JSONB NOT NULL DEFAULT '[]';
+
+-- Orders placed before the pipeline existed had no tax or shipping
+UPDATE purchases SET subtotal_amount = total_amount WHERE subtotal_amount IS NULL;
@@ -0,0 +1,39 @@
+-- Product categories, used to scope promotions
+ALTER TABLE products ADD COLUMN IF NOT EXISTS category VARCHAR(100);
+
+-- Coupon codes and promotions
+CREATE TABLE IF NOT EXISTS promotions (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) NOT NULL UNIQUE,
+    description TEXT,
+    discount_type VARCHAR(20) NOT NULL,
+    percent_off NUMERIC(5,2),
+    amount_off NUMERIC(10,2),
+    buy_quantity INTEGER,
+    get_quantity INTEGER,
+    starts_at TIMESTAMP,
+    ends_at TIMESTAMP,
+    max_redemptions INTEGER,
+    max_redemptions_per_customer INTEGER,
+    product_ids TEXT[] NOT NULL DEFAULT '{}',
+    categories TEXT[] NOT NULL DEFAULT '{}',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    redemption_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One row per order that used a promotion
+CREATE TABLE IF NOT EXISTS promotion_redemptions (
+    id SERIAL PRIMARY KEY,
+    promotion_id INTEGER NOT NULL REFERENCES promotions(id) ON DELETE CASCADE,
+    purchase_id INTEGER NOT NULL REFERENCES purchases(id) ON DELETE CASCADE,
+    customer_email VARCHAR(255) NOT NULL,
+    discount_amount NUMERIC(10,2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_promotion_redemptions_promotion_email ON promotion_redemptions(promotion_id, LOWER(customer_email));
+
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS promo_code VARCHAR(50);
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS discount_amount NUMERIC(10,2) NOT NULL DEFAULT 0;
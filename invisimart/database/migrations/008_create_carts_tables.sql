@@ -0,0 +1,23 @@
+-- Server-side shopping carts
+CREATE TABLE IF NOT EXISTS carts (
+    id VARCHAR(36) PRIMARY KEY,
+    customer_email VARCHAR(255),
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    order_id VARCHAR(100),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS cart_items (
+    id SERIAL PRIMARY KEY,
+    cart_id VARCHAR(36) NOT NULL REFERENCES carts(id) ON DELETE CASCADE,
+    product_id VARCHAR(50) NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(cart_id, product_id)
+);
+
+-- Used by the expiry sweeper and abandonment reporting
+CREATE INDEX IF NOT EXISTS idx_carts_status_expires_at ON carts(status, expires_at);
@@ -0,0 +1,7 @@
+-- Payment processor record for each order. The card ciphertext is still stored, but the
+-- processor reference is what authorizes captures, voids and refunds.
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS payment_processor VARCHAR(50);
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS payment_reference VARCHAR(255);
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS payment_status VARCHAR(30);
+
+CREATE INDEX IF NOT EXISTS idx_purchases_payment_reference ON purchases(payment_reference);
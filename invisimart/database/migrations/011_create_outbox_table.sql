@@ -0,0 +1,17 @@
+-- Domain events written in the same transaction as the change that caused them, then
+-- dispatched to in-process handlers (emails, webhooks) with at-least-once delivery
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL,
+    aggregate_id VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL,
+    completed_handlers TEXT[] NOT NULL DEFAULT '{}',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    available_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    processed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(available_at, id) WHERE processed_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_processed_at ON outbox(processed_at) WHERE processed_at IS NOT NULL;
@@ -0,0 +1,28 @@
+-- Gap-free invoice numbering. The counter row is incremented in the purchase transaction just
+-- before commit, so a rolled-back purchase also rolls back its number.
+CREATE TABLE IF NOT EXISTS invoice_sequences (
+    name VARCHAR(50) PRIMARY KEY,
+    last_number BIGINT NOT NULL DEFAULT 0
+);
+
+INSERT INTO invoice_sequences (name, last_number) VALUES ('invoice', 0) ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS invoice_number BIGINT UNIQUE;
+
+-- Last four digits of the card, kept in clear so receipts can show a masked card
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS card_last4 VARCHAR(4);
+
+-- Number existing orders in the order they were placed, continuing from the counter
+WITH numbered AS (
+    SELECT id, ROW_NUMBER() OVER (ORDER BY created_at, id) AS n
+    FROM purchases
+    WHERE invoice_number IS NULL
+)
+UPDATE purchases
+SET invoice_number = numbered.n + (SELECT last_number FROM invoice_sequences WHERE name = 'invoice')
+FROM numbered
+WHERE purchases.id = numbered.id;
+
+UPDATE invoice_sequences
+SET last_number = GREATEST(last_number, (SELECT COALESCE(MAX(invoice_number), 0) FROM purchases))
+WHERE name = 'invoice';
@@ -0,0 +1,8 @@
+-- Failed guest lookups of each order. Once failed_attempts reaches the limit the order is
+-- locked until locked_until and the count starts again.
+CREATE TABLE IF NOT EXISTS order_lookup_failures (
+    purchase_id INTEGER PRIMARY KEY REFERENCES purchases(id) ON DELETE CASCADE,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
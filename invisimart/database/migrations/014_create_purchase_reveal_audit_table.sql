@@ -0,0 +1,30 @@
+-- One row per admin reveal of encrypted customer fields: who, which fields, why and when.
+-- Rows are append-only; the trigger below rejects updates, deletes and truncation.
+CREATE TABLE IF NOT EXISTS purchase_reveal_audit (
+    id BIGSERIAL PRIMARY KEY,
+    purchase_id INTEGER NOT NULL REFERENCES purchases(id),
+    order_id VARCHAR(100) NOT NULL,
+    revealed_by VARCHAR(100) NOT NULL,
+    fields TEXT[] NOT NULL,
+    reason TEXT NOT NULL,
+    request_id VARCHAR(100),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_reveal_audit_purchase_id ON purchase_reveal_audit(purchase_id);
+
+CREATE OR REPLACE FUNCTION reject_purchase_reveal_audit_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'purchase_reveal_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS purchase_reveal_audit_append_only ON purchase_reveal_audit;
+CREATE TRIGGER purchase_reveal_audit_append_only
+    BEFORE UPDATE OR DELETE ON purchase_reveal_audit
+    FOR EACH ROW EXECUTE FUNCTION reject_purchase_reveal_audit_change();
+
+DROP TRIGGER IF EXISTS purchase_reveal_audit_no_truncate ON purchase_reveal_audit;
+CREATE TRIGGER purchase_reveal_audit_no_truncate
+    BEFORE TRUNCATE ON purchase_reveal_audit
+    FOR EACH STATEMENT EXECUTE FUNCTION reject_purchase_reveal_audit_change();
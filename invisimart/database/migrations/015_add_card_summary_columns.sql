@@ -0,0 +1,6 @@
+-- Non-sensitive card details kept in clear next to the Transit ciphertext, so past orders can
+-- be displayed without decrypting. card_last4 was added in 012; the expiry is only stored
+-- when the customer gave one.
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS card_brand VARCHAR(20);
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS card_exp_month SMALLINT CHECK (card_exp_month BETWEEN 1 AND 12);
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS card_exp_year SMALLINT;
@@ -0,0 +1,15 @@
+-- Fraud screening. Phone and card numbers are stored as keyed hashes so past orders can be
+-- matched without decrypting; the score and the rules that fired are kept for reviewers.
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS customer_phone_hash VARCHAR(64);
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS card_fingerprint VARCHAR(64);
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS client_ip VARCHAR(45);
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS fraud_score INTEGER;
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS fraud_signals JSONB;
+
+-- Velocity rules count recent orders by each identifier
+CREATE INDEX IF NOT EXISTS idx_purchases_email_created_at ON purchases(LOWER(customer_email), created_at);
+CREATE INDEX IF NOT EXISTS idx_purchases_phone_hash_created_at ON purchases(customer_phone_hash, created_at);
+CREATE INDEX IF NOT EXISTS idx_purchases_client_ip_created_at ON purchases(client_ip, created_at);
+
+-- Orders held for review are listed oldest first
+CREATE INDEX IF NOT EXISTS idx_purchases_review ON purchases(created_at) WHERE status = 'review';
@@ -0,0 +1,28 @@
+-- Multi-currency. Products are listed in their own currency and orders are charged in the
+-- currency the customer chose; every amount stored on an order and its items, refunds and
+-- adjustments is in the order's currency. Existing rows were all priced in US dollars.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+
+-- One unit of base_currency is worth rate units of quote_currency from effective_from until
+-- the next rate for the pair takes effect. A pair is also used the other way round, inverted.
+-- Rates are added, never updated, so past orders can be traced to the rate they used:
+--   INSERT INTO exchange_rates (base_currency, quote_currency, rate, effective_from)
+--   VALUES ('USD', 'EUR', 0.92150000, '2026-10-01 00:00:00');
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    id SERIAL PRIMARY KEY,
+    base_currency CHAR(3) NOT NULL,
+    quote_currency CHAR(3) NOT NULL,
+    rate NUMERIC(18, 8) NOT NULL CHECK (rate > 0),
+    effective_from TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (base_currency, quote_currency, effective_from),
+    CHECK (base_currency <> quote_currency)
+);
+
+-- The rate an order was converted at from the base currency its prices were worked out in.
+-- Orders in the base currency have a rate of 1 and no exchange_rate_id.
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS base_currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS exchange_rate NUMERIC(18, 8) NOT NULL DEFAULT 1;
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS exchange_rate_id INTEGER REFERENCES exchange_rates(id);
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS exchange_rate_effective_from TIMESTAMP;
@@ -0,0 +1,22 @@
+-- Where each order ships from: one fulfillment per location, listing the order lines sent
+-- from it. A product is split over several purchase_items rows when it ships from more than
+-- one location, so every fulfillment item points at exactly one order line.
+CREATE TABLE IF NOT EXISTS fulfillments (
+    id SERIAL PRIMARY KEY,
+    purchase_id INTEGER NOT NULL REFERENCES purchases(id) ON DELETE CASCADE,
+    location VARCHAR(100) NOT NULL,
+    policy VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (purchase_id, location)
+);
+
+CREATE TABLE IF NOT EXISTS fulfillment_items (
+    id SERIAL PRIMARY KEY,
+    fulfillment_id INTEGER NOT NULL REFERENCES fulfillments(id) ON DELETE CASCADE,
+    purchase_item_id INTEGER NOT NULL REFERENCES purchase_items(id) ON DELETE CASCADE,
+    product_id VARCHAR(50) NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_fulfillments_purchase_id ON fulfillments(purchase_id);
+CREATE INDEX IF NOT EXISTS idx_fulfillment_items_fulfillment_id ON fulfillment_items(fulfillment_id);
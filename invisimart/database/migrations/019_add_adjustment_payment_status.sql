@@ -0,0 +1,6 @@
+-- Adjustments are committed before the money is returned, so each one records how far its
+-- refund or void got: pending until the processor answers, then completed or failed. Rows
+-- left pending after a crash or a processor timeout need reconciling with the processor.
+-- Adjustments that moved no money have no payment_status.
+ALTER TABLE purchase_adjustments ADD COLUMN IF NOT EXISTS payment_status VARCHAR(20)
+    CHECK (payment_status IN ('pending', 'completed', 'failed'));
@@ -13,11 +13,26 @@ interface CheckoutFormData {
   billingAddress: string;
 }
 
+interface ValidationError {
+  field: string;
+  code: string;
+  message: string;
+}
+
+interface Problem {
+  code: string;
+  title: string;
+  detail?: string;
+  requestId?: string;
+  errors?: ValidationError[];
+}
+
 export default function CheckoutPage() {
   const { items, getTotalPrice, clearCart } = useCart();
   const router = useRouter();
   const [isProcessing, setIsProcessing] = useState(false);
   const [error, setError] = useState<string | null>(null);
+  const [fieldErrors, setFieldErrors] = useState<Record<string, string>>({});
   
   const [formData, setFormData] = useState<CheckoutFormData>({
     customerName: '',
@@ -27,6 +42,14 @@ export default function CheckoutPage() {
     billingAddress: '',
   });
 
+  const inputClass = (field: keyof CheckoutFormData) =>
+    `w-full px-4 py-3 border-2 rounded-2xl focus:outline-none font-semibold ${
+      fieldErrors[field] ? 'border-red-500 focus:border-red-600' : 'border-slate-300 focus:border-brand-orange'
+    }`;
+
+  const renderFieldError = (field: keyof CheckoutFormData) =>
+    fieldErrors[field] && <p className="mt-2 text-sm font-semibold text-red-700">{fieldErrors[field]}</p>;
+
   const handleInputChange = (e: React.ChangeEvent<HTMLInputElement | HTMLTextAreaElement>) => {
     const { name, value } = e.target;
     setFormData((prev) => ({ ...prev, [name]: value }));
@@ -58,6 +81,7 @@ export default function CheckoutPage() {
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
     setError(null);
+    setFieldErrors({});
     setIsProcessing(true);
 
     try {
@@ -106,8 +130,23 @@ export default function CheckoutPage() {
       });
 
       if (!response.ok) {
-        const errorText = await response.text();
-        throw new Error(errorText || 'Failed to process purchase');
+        // Errors are RFC 7807 problem documents; field-level validation errors are
+        // highlighted on the form
+        let problem: Problem | null = null;
+        try {
+          problem = await response.json();
+        } catch {
+          problem = null;
+        }
+        if (problem && Array.isArray(problem.errors)) {
+          const byField: Record<string, string> = {};
+          problem.errors.forEach((fieldError) => {
+            byField[fieldError.field] ??= fieldError.message;
+          });
+          setFieldErrors(byField);
+          throw new Error('Please correct the highlighted fields');
+        }
+        throw new Error(problem?.detail || problem?.title || 'Failed to process purchase');
       }
 
       const result = await response.json();
@@ -116,7 +155,11 @@ export default function CheckoutPage() {
       clearCart();
       
       // Redirect to confirmation page
-      router.push(`/confirmation?orderId=${result.orderId}`);
+      const confirmationParams = new URLSearchParams({
+        orderId: result.orderId,
+        token: result.lookupToken,
+      });
+      router.push(`/confirmation?${confirmationParams}`);
     } catch (err) {
       console.error('Purchase error:', err);
       setError(err instanceof Error ? err.message : 'Failed to process purchase');
@@ -192,9 +235,10 @@ export default function CheckoutPage() {
                     value={formData.customerName}
                     onChange={handleInputChange}
                     required
-                    className="w-full px-4 py-3 border-2 border-slate-300 rounded-2xl focus:border-brand-orange focus:outline-none font-semibold"
+                    className={inputClass('customerName')}
                     placeholder="John Doe"
                   />
+                  {renderFieldError('customerName')}
                 </div>
 
                 {/* Email */}
@@ -209,9 +253,10 @@ export default function CheckoutPage() {
                     value={formData.customerEmail}
                     onChange={handleInputChange}
                     required
-                    className="w-full px-4 py-3 border-2 border-slate-300 rounded-2xl focus:border-brand-orange focus:outline-none font-semibold"
+                    className={inputClass('customerEmail')}
                     placeholder="john@example.com"
                   />
+                  {renderFieldError('customerEmail')}
                 </div>
 
                 {/* Phone */}
@@ -228,9 +273,10 @@ export default function CheckoutPage() {
                     onChange={handlePhoneChange}
                     required
                     maxLength={14}
-                    className="w-full px-4 py-3 border-2 border-slate-300 rounded-2xl focus:border-brand-orange focus:outline-none font-semibold"
+                    className={inputClass('customerPhone')}
                     placeholder="(123) 456-7890"
                   />
+                  {renderFieldError('customerPhone')}
                 </div>
 
                 {/* Credit Card */}
@@ -247,9 +293,10 @@ export default function CheckoutPage() {
                     onChange={handleCreditCardChange}
                     required
                     maxLength={19}
-                    className="w-full px-4 py-3 border-2 border-slate-300 rounded-2xl focus:border-brand-orange focus:outline-none font-semibold"
+                    className={inputClass('creditCard')}
                     placeholder="1234 5678 9012 3456"
                   />
+                  {renderFieldError('creditCard')}
                 </div>
 
                 {/* Billing Address */}
@@ -264,9 +311,10 @@ export default function CheckoutPage() {
                     onChange={handleInputChange}
                     required
                     rows={3}
-                    className="w-full px-4 py-3 border-2 border-slate-300 rounded-2xl focus:border-brand-orange focus:outline-none font-semibold resize-none"
+                    className={`${inputClass('billingAddress')} resize-none`}
                     placeholder="123 Main St, Apt 4, City, State 12345"
                   />
+                  {renderFieldError('billingAddress')}
                 </div>
               </div>
 
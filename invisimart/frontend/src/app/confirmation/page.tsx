@@ -26,6 +26,7 @@ function ConfirmationContent() {
   const searchParams = useSearchParams();
   const router = useRouter();
   const orderId = searchParams.get('orderId');
+  const lookupToken = searchParams.get('token');
   const [orderDetails, setOrderDetails] = useState<OrderDetails | null>(null);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState<string | null>(null);
@@ -58,7 +59,9 @@ function ConfirmationContent() {
           console.log('Using fallback API URL (same origin):', apiUrl);
         }
 
-        const response = await fetch(`${apiUrl}/purchase?orderId=${orderId}`);
+        // The lookup token issued with the order proves this visitor placed it
+        const params = new URLSearchParams({ orderId: orderId ?? '', token: lookupToken ?? '' });
+        const response = await fetch(`${apiUrl}/purchase?${params}`);
         if (!response.ok) {
           throw new Error('Failed to fetch order details');
         }
@@ -74,7 +77,7 @@ function ConfirmationContent() {
     }
 
     fetchOrderDetails();
-  }, [orderId, router]);
+  }, [orderId, lookupToken, router]);
 
   if (loading) {
     return (
@@ -239,17 +239,23 @@ func simulatePurchase(db *sql.DB) {
 	quantity := rand.Intn(maxPurchase) + 1
 	newStock := item.Stock - quantity
 
-	// Update inventory
-	_, err = db.Exec(`
+	// Update inventory relative to the current row so concurrent API orders are never overwritten
+	err = db.QueryRow(`
 		UPDATE inventory
-		SET stock = $1, updated_at = CURRENT_TIMESTAMP
-		WHERE product_id = $2 AND location = $3
-	`, newStock, item.ProductID, item.Location)
+		SET stock = stock - $1, updated_at = CURRENT_TIMESTAMP
+		WHERE product_id = $2 AND location = $3 AND stock >= $1
+		RETURNING stock
+	`, quantity, item.ProductID, item.Location).Scan(&newStock)
 
 	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("Stock for product %s at %s changed before purchase, skipping", item.ProductID, item.Location)
+			return
+		}
 		log.Printf("Error updating inventory: %v", err)
 		return
 	}
+	item.Stock = newStock + quantity
 
 	// Log the event
 	_, err = db.Exec(`
@@ -307,17 +313,19 @@ func simulateRestock(db *sql.DB) {
 
 	newStock := item.Stock + quantity
 
-	// Update inventory
-	_, err = db.Exec(`
+	// Update inventory relative to the current row so concurrent API orders are never overwritten
+	err = db.QueryRow(`
 		UPDATE inventory
-		SET stock = $1, updated_at = CURRENT_TIMESTAMP
+		SET stock = stock + $1, updated_at = CURRENT_TIMESTAMP
 		WHERE product_id = $2 AND location = $3
-	`, newStock, item.ProductID, item.Location)
+		RETURNING stock
+	`, quantity, item.ProductID, item.Location).Scan(&newStock)
 
 	if err != nil {
 		log.Printf("Error updating inventory: %v", err)
 		return
 	}
+	item.Stock = newStock - quantity
 
 	// Log the event
 	_, err = db.Exec(`